@@ -1,17 +1,623 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	"github.com/AlexeyBeley/go_common/logger"
 	"github.com/AlexeyBeley/k8s_go/kub_api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var lg = &(logger.Logger{})
+var lg = &(logger.Logger{Level: logger.INFO})
+
+// Registered before kub_api.KubAPINew parses the command line.
+var (
+	metricsAddr       = flag.String("metrics-addr", "", "(optional) address to serve /metrics on in long-running commands, e.g. :9090")
+	traceOTLPEndpoint = flag.String("trace-otlp-endpoint", "", "(optional) OTLP/HTTP endpoint to export traces to, e.g. localhost:4318")
+	traceFile         = flag.String("trace-file", "", "(optional) file to write traces to as JSON, '-' for stdout")
+)
 
 func main() {
 
 	api, err := kub_api.KubAPINew()
+	// Key management works on local files only and does not need a cluster.
+	if handled, offlineErr := runOffline(flag.Args()); handled {
+		if offlineErr != nil {
+			lg.Errorf("%v", offlineErr)
+			os.Exit(1)
+		}
+		return
+	}
 	if err != nil {
+		lg.Errorf("%v", err)
 		panic(err)
 	}
-	api.GetPods()
+	api.SetLogHandler(kub_api.NewGoCommonLogHandler(lg))
+
+	tracerProvider, err := newTracerProvider()
+	if err != nil {
+		lg.Errorf("%v", err)
+		os.Exit(1)
+	}
+	if tracerProvider != nil {
+		api.TracerProvider = tracerProvider
+	}
+
+	err = run(api, flag.Args())
+	if tracerProvider != nil {
+		tracerProvider.Shutdown(context.Background())
+	}
+	if err != nil {
+		lg.Errorf("%v", err)
+		os.Exit(1)
+	}
+}
+
+// runOffline runs the commands that need no cluster connection and reports whether args named one.
+func runOffline(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+	switch args[0] + " " + args[1] {
+	case "secrets keygen":
+		flags := flag.NewFlagSet("secrets keygen", flag.ExitOnError)
+		keyPath := flags.String("key", "", "path of the key file to create")
+		flags.Parse(args[2:])
+		key, err := kub_api.GenerateSecretKey(*keyPath)
+		if err != nil {
+			return true, err
+		}
+		fmt.Printf("created key %s in %s\n", key.ID, *keyPath)
+		return true, nil
+	case "secrets encrypt":
+		flags := flag.NewFlagSet("secrets encrypt", flag.ExitOnError)
+		keyPath := flags.String("key", "", "path of the key file")
+		input := flags.String("in", "", "plain Secret manifest")
+		output := flags.String("out", "-", "encrypted manifest to write, '-' for stdout")
+		flags.Parse(args[2:])
+		key, err := kub_api.LoadSecretKey(*keyPath)
+		if err != nil {
+			return true, err
+		}
+		manifest, err := os.ReadFile(*input)
+		if err != nil {
+			return true, err
+		}
+		encrypted, err := kub_api.EncryptSecretManifest(manifest, key)
+		if err != nil {
+			return true, err
+		}
+		if *output == "-" {
+			_, err = os.Stdout.Write(encrypted)
+			return true, err
+		}
+		return true, os.WriteFile(*output, encrypted, 0o644)
+	case "secrets rotate":
+		flags := flag.NewFlagSet("secrets rotate", flag.ExitOnError)
+		oldKeyPaths := stringList{}
+		flags.Var(&oldKeyPaths, "old-key", "path of a key file the manifests are encrypted with, may be repeated")
+		newKeyPath := flags.String("new-key", "", "path of the key file to re-encrypt with")
+		flags.Parse(args[2:])
+		oldKeys, err := loadSecretKeys(oldKeyPaths)
+		if err != nil {
+			return true, err
+		}
+		newKey, err := kub_api.LoadSecretKey(*newKeyPath)
+		if err != nil {
+			return true, err
+		}
+		return true, kub_api.RotateSecretFiles(flags.Args(), newKey, oldKeys...)
+	}
+	return false, nil
+}
+
+func run(api *kub_api.KubAPI, args []string) error {
+	if len(args) == 0 {
+		args = []string{"pods", "list"}
+	}
+	if args[0] == "describe" {
+		if len(args) != 3 {
+			return fmt.Errorf("usage: kub_api [flags] describe <kind> <name>")
+		}
+		description, err := api.Describe(context.Background(), args[1], args[2])
+		if err != nil {
+			return err
+		}
+		return description.Render(os.Stdout)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: kub_api [flags] <pods|jobs|deployments|statefulsets|daemonsets|services|ingresses|gateways|routing|certs|configmaps|secrets> <command> [args] | describe <kind> <name>")
+	}
+
+	if kind, ok := workloadKinds[args[0]]; ok {
+		return runWorkload(api, kind, args)
+	}
+
+	switch args[0] + " " + args[1] {
+	case "pods list":
+		pods, err := api.GetPods()
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			fmt.Printf("%s\t%s\n", pod.Name, pod.Status.Phase)
+		}
+		return nil
+	case "pods prune":
+		flags := flag.NewFlagSet("pods prune", flag.ExitOnError)
+		jobName := flags.String("job", "", "name of the job whose finished pods are deleted")
+		flags.Parse(args[2:])
+		serveMetrics(api)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return api.PrunePods(ctx, jobName)
+	case "pods exec":
+		flags := flag.NewFlagSet("pods exec", flag.ExitOnError)
+		podName := flags.String("name", "", "name of the pod")
+		container := flags.String("container", "", "container name, the default container when empty")
+		stdin := flags.Bool("stdin", false, "pass standard input to the command")
+		flags.Parse(args[2:])
+		var stdinReader io.Reader
+		if *stdin {
+			stdinReader = os.Stdin
+		}
+		return api.Exec(context.Background(), *podName, *container, flags.Args(), stdinReader, os.Stdout, os.Stderr, false)
+	case "pods cp":
+		flags := flag.NewFlagSet("pods cp", flag.ExitOnError)
+		container := flags.String("container", "", "container name, the default container when empty")
+		flags.Parse(args[2:])
+		if flags.NArg() != 2 {
+			return fmt.Errorf("usage: pods cp [-container name] <pod>:<path> <dir> | <path> <pod>:<dir>")
+		}
+		src, dest := flags.Arg(0), flags.Arg(1)
+		var files int
+		var err error
+		if podName, podPath, ok := strings.Cut(src, ":"); ok {
+			files, err = api.CopyFromPod(context.Background(), podName, *container, podPath, dest)
+		} else if podName, podPath, ok := strings.Cut(dest, ":"); ok {
+			files, err = api.CopyToPod(context.Background(), podName, *container, src, podPath)
+		} else {
+			return fmt.Errorf("pods cp: one of the paths must be <pod>:<path>")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("files=%d\n", files)
+		return nil
+	case "pods forward":
+		flags := flag.NewFlagSet("pods forward", flag.ExitOnError)
+		target := flags.String("target", "", "pod/<name>, service/<name> or svc/<name>")
+		localPort := flags.Int("local", 0, "local port, a free port when 0")
+		remotePort := flags.Int("remote", 0, "pod port, or service port for a service target")
+		flags.Parse(args[2:])
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		session, err := api.PortForward(ctx, *target, *localPort, *remotePort)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("forwarding %s -> %s:%d\n", session.Address(), *target, *remotePort)
+		<-session.Done()
+		return nil
+	case "services endpoints":
+		flags := flag.NewFlagSet("services endpoints", flag.ExitOnError)
+		serviceName := flags.String("name", "", "name of the service")
+		waitReady := flags.Int("wait-ready", 0, "wait until at least this many endpoints are ready")
+		flags.Parse(args[2:])
+		var endpoints *kub_api.ServiceEndpoints
+		var err error
+		if *waitReady > 0 {
+			endpoints, err = api.WaitForServiceReady(context.Background(), *serviceName, *waitReady)
+		} else {
+			endpoints, err = api.GetServiceEndpoints(context.Background(), *serviceName)
+		}
+		if err != nil {
+			return err
+		}
+		if endpoints.SelectorMatchesNoPods {
+			fmt.Printf("warning: selector of service %s matches no pods\n", *serviceName)
+		}
+		for _, endpoint := range endpoints.Endpoints {
+			fmt.Printf("%s\t%s\tready=%t\tserving=%t\tterminating=%t\n", endpoint.Pod, strings.Join(endpoint.Addresses, ","), endpoint.Ready, endpoint.Serving, endpoint.Terminating)
+		}
+		return nil
+	case "ingresses inventory":
+		flags := flag.NewFlagSet("ingresses inventory", flag.ExitOnError)
+		output := flags.String("output", "table", "output format: table, json or csv")
+		flags.Parse(args[2:])
+		inventory, err := api.GetIngressInventory(context.Background())
+		if err != nil {
+			return err
+		}
+		switch *output {
+		case "json":
+			return inventory.WriteJSON(os.Stdout)
+		case "csv":
+			return inventory.WriteCSV(os.Stdout)
+		case "table":
+		default:
+			return fmt.Errorf("unknown output format %s", *output)
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAMESPACE\tINGRESS\tCLASS\tHOST\tPATH\tBACKEND\tTLS")
+		for _, route := range inventory.Routes {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s:%s\t%s\n", route.Namespace, route.Ingress, route.Class, route.Host, route.Path, route.Service, route.Port, route.TLSSecret)
+		}
+		writer.Flush()
+		for _, issue := range inventory.Issues {
+			fmt.Printf("%s: %s/%s: %s\n", issue.Type, issue.Namespace, issue.Ingress, issue.Message)
+		}
+		return nil
+	case "ingresses convert":
+		flags := flag.NewFlagSet("ingresses convert", flag.ExitOnError)
+		ingressName := flags.String("name", "", "name of the ingress")
+		gateway := flags.String("gateway", "", "name of the gateway the routes attach to")
+		gatewayNamespace := flags.String("gateway-namespace", "", "(optional) namespace of the gateway, defaults to the ingress namespace")
+		sectionName := flags.String("section", "", "(optional) gateway listener the routes attach to")
+		flags.Parse(args[2:])
+		routes, err := api.ConvertIngressToHTTPRoutes(context.Background(), *ingressName, kub_api.HTTPRouteParent{Namespace: *gatewayNamespace, Name: *gateway, SectionName: *sectionName})
+		if err != nil {
+			return err
+		}
+		return kub_api.WriteManifests(os.Stdout, routes)
+	case "gateways list":
+		classes, err := api.GetGatewayClasses(context.Background())
+		if err != nil {
+			return err
+		}
+		gateways, err := api.GetGateways(context.Background(), "")
+		if err != nil {
+			return err
+		}
+		routes, err := api.GetHTTPRoutes(context.Background(), "")
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, class := range classes {
+			fmt.Fprintf(writer, "GatewayClass\t%s\t%s\taccepted=%t\n", class.Name, class.Controller, class.Accepted)
+		}
+		for _, gateway := range gateways {
+			listeners := []string{}
+			for _, listener := range gateway.Listeners {
+				listeners = append(listeners, fmt.Sprintf("%s/%d/%s", listener.Protocol, listener.Port, listener.Hostname))
+			}
+			fmt.Fprintf(writer, "Gateway\t%s/%s\t%s\t%s\tprogrammed=%t\n", gateway.Namespace, gateway.Name, gateway.Class, strings.Join(listeners, ","), gateway.Programmed)
+		}
+		for _, route := range routes {
+			fmt.Fprintf(writer, "HTTPRoute\t%s/%s\t%s\t%s\taccepted=%t\n", route.Namespace, route.Name, strings.Join(route.Parents, ","), strings.Join(route.Hostnames, ","), route.Accepted)
+		}
+		return writer.Flush()
+	case "routing table":
+		table, err := api.GetRoutingTable(context.Background())
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "HOST\tPATH\tSOURCE\tNAME\tPARENT\tBACKEND")
+		for _, entry := range table {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Host, entry.Path, entry.Source, entry.Name, entry.Parent, entry.Backend)
+		}
+		return writer.Flush()
+	case "certs check":
+		flags := flag.NewFlagSet("certs check", flag.ExitOnError)
+		warnDays := flags.Int("days", 30, "report certificates expiring within this many days")
+		output := flags.String("output", "table", "output format: table or json")
+		flags.Parse(args[2:])
+		reports, err := api.ScanTLSCertificates(context.Background(), *warnDays)
+		if err != nil {
+			return err
+		}
+		switch *output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(reports)
+			if err != nil {
+				return err
+			}
+		case "table":
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "SECRET\tSTATUS\tDAYS LEFT\tSUBJECT\tISSUER\tINGRESSES\tUNCOVERED HOSTS")
+			for _, report := range reports {
+				fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", report.Secret, report.Status, report.DaysLeft, report.Subject, report.Issuer, strings.Join(report.Ingresses, ","), strings.Join(report.UncoveredHosts, ","))
+			}
+			writer.Flush()
+		default:
+			return fmt.Errorf("unknown output format %s", *output)
+		}
+		// A non-zero exit status lets cron and monitoring pick up the problems.
+		unhealthy := 0
+		for _, report := range reports {
+			if !report.Healthy() {
+				unhealthy++
+				fmt.Fprintln(os.Stderr, report.String())
+			}
+		}
+		if unhealthy > 0 {
+			return fmt.Errorf("%d of %d certificates need attention", unhealthy, len(reports))
+		}
+		return nil
+	case "configmaps apply", "secrets apply":
+		flags := flag.NewFlagSet(args[0]+" "+args[1], flag.ExitOnError)
+		name := flags.String("name", "", "name of the "+strings.TrimSuffix(args[0], "s"))
+		sources := kub_api.ConfigSources{}
+		flags.Var((*stringList)(&sources.Files), "from-file", "file or directory, optionally key=path, may be repeated")
+		flags.Var((*stringList)(&sources.EnvFiles), "from-env-file", "file of KEY=VALUE lines, may be repeated")
+		flags.Var((*stringList)(&sources.Literals), "from-literal", "key=value, may be repeated")
+		secretType := flags.String("type", "generic", "secrets only: generic, docker-registry, tls or basic-auth")
+		server := flags.String("docker-server", "", "docker-registry: registry server")
+		username := flags.String("username", "", "docker-registry and basic-auth: user name")
+		password := flags.String("password", "", "docker-registry and basic-auth: password")
+		email := flags.String("docker-email", "", "docker-registry: (optional) email")
+		certFile := flags.String("cert", "", "tls: PEM certificate file")
+		keyFile := flags.String("key", "", "tls: PEM private key file")
+		flags.Parse(args[2:])
+
+		if args[0] == "configmaps" {
+			configMap, err := kub_api.ConfigMapNew(*name, sources)
+			if err != nil {
+				return err
+			}
+			_, err = api.ApplyConfigMap(context.Background(), configMap)
+			return err
+		}
+		var secret *corev1.Secret
+		var err error
+		switch *secretType {
+		case "generic":
+			secret, err = kub_api.SecretNew(*name, sources)
+		case "docker-registry":
+			secret, err = kub_api.DockerRegistrySecretNew(*name, *server, *username, *password, *email)
+		case "basic-auth":
+			secret, err = kub_api.BasicAuthSecretNew(*name, *username, *password)
+		case "tls":
+			var certPEM, keyPEM []byte
+			certPEM, err = os.ReadFile(*certFile)
+			if err != nil {
+				return err
+			}
+			keyPEM, err = os.ReadFile(*keyFile)
+			if err != nil {
+				return err
+			}
+			secret, err = kub_api.TLSSecretNew(*name, certPEM, keyPEM)
+		default:
+			return fmt.Errorf("unknown secret type %s", *secretType)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = api.ApplySecret(context.Background(), secret)
+		return err
+	case "secrets apply-encrypted":
+		flags := flag.NewFlagSet("secrets apply-encrypted", flag.ExitOnError)
+		keyPaths := stringList{}
+		flags.Var(&keyPaths, "key", "path of a key file, may be repeated")
+		flags.Parse(args[2:])
+		keys, err := loadSecretKeys(keyPaths)
+		if err != nil {
+			return err
+		}
+		for _, path := range flags.Args() {
+			secret, err := api.ApplyEncryptedSecret(context.Background(), path, keys...)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("applied secret %s from %s\n", secret.Name, path)
+		}
+		return nil
+	case "jobs run":
+		flags := flag.NewFlagSet("jobs run", flag.ExitOnError)
+		templatePath := flags.String("template", "", "path to the job template YAML file")
+		setValues := stringList{}
+		flags.Var(&setValues, "set", "template parameter as key=value, may be repeated")
+		flags.Parse(args[2:])
+		if *templatePath == "" {
+			return fmt.Errorf("jobs run: -template is required")
+		}
+		tmpl, err := kub_api.LoadJobTemplate(*templatePath)
+		if err != nil {
+			return err
+		}
+		values, err := kub_api.ParseSetValues(setValues)
+		if err != nil {
+			return err
+		}
+		job, err := api.CreateJobFromTemplate(tmpl, values)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\n", *job.JobName, *job.UID)
+		return nil
+	case "jobs suspend", "jobs resume", "jobs cancel":
+		flags := flag.NewFlagSet(args[0]+" "+args[1], flag.ExitOnError)
+		jobName := flags.String("name", "", "name of the job")
+		propagation := flags.String("propagation", "Background", "deletion propagation policy for cancel: Background or Foreground")
+		flags.Parse(args[2:])
+		podsTerminated := 0
+		var err error
+		switch args[1] {
+		case "suspend":
+			podsTerminated, err = api.SuspendJob(context.Background(), *jobName)
+		case "resume":
+			err = api.ResumeJob(context.Background(), *jobName)
+		case "cancel":
+			podsTerminated, err = api.CancelJob(context.Background(), *jobName, metav1.DeletionPropagation(*propagation))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\tpodsTerminated=%d\n", *jobName, podsTerminated)
+		return nil
+	case "jobs wait":
+		flags := flag.NewFlagSet("jobs wait", flag.ExitOnError)
+		jobName := flags.String("name", "", "name of the job to wait for")
+		flags.Parse(args[2:])
+		serveMetrics(api)
+		batchJob, err := api.WaitForJob(context.Background(), *jobName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\tsucceeded=%d\tfailed=%d\n", batchJob.Name, batchJob.Status.Succeeded, batchJob.Status.Failed)
+		return nil
+	case "jobs describe":
+		flags := flag.NewFlagSet("jobs describe", flag.ExitOnError)
+		jobName := flags.String("name", "", "name of the job")
+		flags.Parse(args[2:])
+		report, err := api.GetJobFailureReport(context.Background(), *jobName)
+		if err != nil {
+			return err
+		}
+		fmt.Println(report.String())
+		timeline, err := api.GetJobTimeline(context.Background(), *jobName)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TIME\tTYPE\tOBJECT\tREASON\tMESSAGE")
+		for _, event := range timeline {
+			fmt.Fprintf(writer, "%s\t%s\t%s/%s\t%s\t%s\n", event.Time.Format(time.RFC3339), event.Type, event.Kind, event.Name, event.Reason, event.Message)
+		}
+		return writer.Flush()
+	case "jobs collect":
+		flags := flag.NewFlagSet("jobs collect", flag.ExitOnError)
+		jobName := flags.String("name", "", "name of the job")
+		destDir := flags.String("dest", ".", "local directory the artifacts are stored in")
+		paths := stringList{}
+		flags.Var(&paths, "path", "file or directory in the container, may be repeated")
+		flags.Parse(args[2:])
+		collected, err := api.CollectArtifacts(context.Background(), &kub_api.Job{JobName: jobName}, paths, *destDir)
+		for _, artifacts := range collected {
+			fmt.Printf("%s\t%s\tfiles=%d\n", artifacts.Pod, artifacts.Dir, artifacts.Files)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown command: %s %s", args[0], args[1])
+}
+
+var workloadKinds = map[string]string{
+	"deployments":  kub_api.WorkloadDeployment,
+	"statefulsets": kub_api.WorkloadStatefulSet,
+	"daemonsets":   kub_api.WorkloadDaemonSet,
+}
+
+func runWorkload(api *kub_api.KubAPI, kind string, args []string) error {
+	if args[1] == "list" {
+		workloads, err := api.ListWorkloads(context.Background(), kind)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tDESIRED\tREADY\tUPDATED\tAVAILABLE\tREVISION")
+		for _, workload := range workloads {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%d\t%s\n", workload.Name, workload.Desired, workload.Ready, workload.Updated, workload.Available, workload.Revision)
+		}
+		return writer.Flush()
+	}
+
+	flags := flag.NewFlagSet(args[0]+" "+args[1], flag.ExitOnError)
+	name := flags.String("name", "", "name of the "+strings.ToLower(kind))
+	replicas := flags.Int("replicas", -1, "number of replicas for scale")
+	revision := flags.Int64("revision", 0, "revision to roll back to for undo, 0 for the previous one")
+	flags.Parse(args[2:])
+	switch args[1] {
+	case "scale":
+		return api.Scale(context.Background(), kind, *name, int32(*replicas))
+	case "restart":
+		return api.RolloutRestart(context.Background(), kind, *name)
+	case "status":
+		serveMetrics(api)
+		state, err := api.RolloutStatus(context.Background(), kind, *name)
+		if state != nil {
+			fmt.Println(state.Message)
+		}
+		return err
+	case "undo":
+		rolledBack, err := api.RolloutUndo(context.Background(), kind, *name, *revision)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\trolled back to revision %d\n", *name, rolledBack)
+		return nil
+	}
+	return fmt.Errorf("unknown command: %s %s", args[0], args[1])
+}
+
+func loadSecretKeys(paths []string) ([]*kub_api.SecretKey, error) {
+	ret := []*kub_api.SecretKey{}
+	for _, path := range paths {
+		key, err := kub_api.LoadSecretKey(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, key)
+	}
+	return ret, nil
+}
+
+// stringList collects the values of a repeated flag.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func newTracerProvider() (*sdktrace.TracerProvider, error) {
+	switch {
+	case *traceOTLPEndpoint != "":
+		return kub_api.TracerProviderNewOTLP(context.Background(), *traceOTLPEndpoint, true)
+	case *traceFile == "-":
+		return kub_api.TracerProviderNewWriter(os.Stdout)
+	case *traceFile != "":
+		file, err := os.OpenFile(*traceFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return kub_api.TracerProviderNewWriter(file)
+	}
+	return nil, nil
+}
+
+// serveMetrics exposes api metrics on -metrics-addr for long-running commands.
+func serveMetrics(api *kub_api.KubAPI) {
+	if *metricsAddr == "" {
+		return
+	}
+	registry := prometheus.NewRegistry()
+	metrics, err := kub_api.MetricsNew(registry)
+	if err != nil {
+		lg.Errorf("%v", err)
+		return
+	}
+	api.Metrics = metrics
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		err := http.ListenAndServe(*metricsAddr, mux)
+		if err != nil {
+			lg.Errorf("metrics server: %v", err)
+		}
+	}()
 }
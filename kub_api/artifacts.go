@@ -0,0 +1,183 @@
+package kub_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Keep-alive sidecar added to jobs with Job.ArtifactsDir.
+const (
+	ArtifactsContainerName      = "artifacts"
+	ArtifactsVolumeName         = "artifacts"
+	ArtifactsCollectedMarker    = ".collected"
+	ArtifactsKeepAliveSeconds   = 3600
+	artifactsSidecarPollSeconds = 2
+)
+
+// ErrArtifactsNotReady is reported by CollectArtifacts for pods whose job container has not
+// exited yet, so they can be collected by a later call.
+var ErrArtifactsNotReady = errors.New("artifacts not ready")
+
+// ArtifactsSidecarImage runs the keep-alive loop, it only needs sh, test and sleep.
+var ArtifactsSidecarImage = "busybox:1.28"
+
+type PodArtifacts struct {
+	Pod string `json:"pod"`
+	// Index is the completion index or pod-group ordinal, empty for other pods.
+	Index string `json:"index,omitempty"`
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+}
+
+// addArtifactsSidecar shares an emptyDir at ArtifactsDir between the job container and a sidecar
+// that keeps the pod alive after the job container exits, until CollectArtifacts writes the
+// collected marker or the keep-alive timeout, counted from pod start, expires.
+func (job *Job) addArtifactsSidecar(batchJob *batchv1.Job) {
+	if job.ArtifactsDir == nil {
+		return
+	}
+	keepAlive := int32(ArtifactsKeepAliveSeconds)
+	if job.ArtifactsKeepAliveSeconds != nil {
+		keepAlive = *job.ArtifactsKeepAliveSeconds
+	}
+	mount := corev1.VolumeMount{Name: ArtifactsVolumeName, MountPath: *job.ArtifactsDir}
+	marker := path.Join(*job.ArtifactsDir, ArtifactsCollectedMarker)
+
+	podSpec := &batchJob.Spec.Template.Spec
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         ArtifactsVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, mount)
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  ArtifactsContainerName,
+		Image: ArtifactsSidecarImage,
+		Command: []string{"/bin/sh", "-c", fmt.Sprintf(
+			"elapsed=0; while [ ! -f '%s' ] && [ $elapsed -lt %d ]; do sleep %d; elapsed=$((elapsed+%d)); done",
+			marker, keepAlive, artifactsSidecarPollSeconds, artifactsSidecarPollSeconds)},
+		VolumeMounts: []corev1.VolumeMount{mount},
+	})
+}
+
+// CollectArtifacts copies paths out of the pods of the job into destDir/<index>/<pod>, or
+// destDir/<pod> for pods without a completion index, using tar over exec like kubectl cp.
+// Pods with the artifacts sidecar are collected once the job container has exited and then
+// released; other pods are collected while the job container still runs. Pods that cannot be
+// collected are reported in the error, the others are still copied; pods that are not ready yet
+// are reported with ErrArtifactsNotReady.
+func (kapi *KubAPI) CollectArtifacts(ctx context.Context, job *Job, paths []string, destDir string) ([]PodArtifacts, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no artifact paths given")
+	}
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + *job.JobName})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+
+	ret := []PodArtifacts{}
+	var errs []error
+	for index := range pods.Items {
+		pod := &pods.Items[index]
+		collected, err := kapi.collectPodArtifacts(ctx, pod, paths, destDir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pod %s: %w", pod.Name, err))
+			continue
+		}
+		ret = append(ret, *collected)
+	}
+	return ret, errors.Join(errs...)
+}
+
+func (kapi *KubAPI) collectPodArtifacts(ctx context.Context, pod *corev1.Pod, paths []string, destDir string) (*PodArtifacts, error) {
+	if len(pod.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("pod has no containers")
+	}
+	mainContainer := pod.Spec.Containers[0].Name
+	container := mainContainer
+	sidecar := artifactsSidecar(pod)
+	if sidecar != nil {
+		if !isContainerTerminated(pod, mainContainer) {
+			kapi.log().Warn("artifacts not collected, job container still running", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, pod.Name), slog.String("container", mainContainer))
+			return nil, fmt.Errorf("container %s has not exited yet: %w", mainContainer, ErrArtifactsNotReady)
+		}
+		container = ArtifactsContainerName
+	}
+	if !isContainerRunning(pod, container) {
+		return nil, fmt.Errorf("container %s is not running, artifacts are lost once it exits; set Job.ArtifactsDir to keep the pod alive", container)
+	}
+
+	ret := PodArtifacts{Pod: pod.Name, Index: podIndex(pod)}
+	ret.Dir = filepath.Join(destDir, pod.Name)
+	if ret.Index != "" {
+		ret.Dir = filepath.Join(destDir, ret.Index, pod.Name)
+	}
+	for _, artifactPath := range paths {
+		files, err := kapi.CopyFromPod(ctx, pod.Name, container, artifactPath, ret.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", artifactPath, err)
+		}
+		ret.Files += files
+	}
+
+	if sidecar != nil {
+		marker := path.Join(sidecar.VolumeMounts[0].MountPath, ArtifactsCollectedMarker)
+		_, err := kapi.execCapture(ctx, pod.Name, container, []string{"touch", marker})
+		if err != nil {
+			return nil, fmt.Errorf("release artifacts sidecar: %w", err)
+		}
+	}
+	kapi.log().Info("artifacts collected", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, pod.Name), slog.Int("files", ret.Files), slog.String("dir", ret.Dir))
+	return &ret, nil
+}
+
+func artifactsSidecar(pod *corev1.Pod) *corev1.Container {
+	for index := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[index]
+		if container.Name == ArtifactsContainerName && len(container.VolumeMounts) > 0 {
+			return container
+		}
+	}
+	return nil
+}
+
+func containerState(pod *corev1.Pod, container string) *corev1.ContainerState {
+	for index := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[index].Name == container {
+			return &pod.Status.ContainerStatuses[index].State
+		}
+	}
+	return nil
+}
+
+func isContainerRunning(pod *corev1.Pod, container string) bool {
+	state := containerState(pod, container)
+	return state != nil && state.Running != nil
+}
+
+func isContainerTerminated(pod *corev1.Pod, container string) bool {
+	state := containerState(pod, container)
+	return state != nil && state.Terminated != nil
+}
+
+// podIndex returns the completion index of an Indexed job pod or the pod-group ordinal.
+func podIndex(pod *corev1.Pod) string {
+	if index, ok := pod.Labels[batchv1.JobCompletionIndexAnnotation]; ok {
+		return index
+	}
+	if index, ok := pod.Annotations[batchv1.JobCompletionIndexAnnotation]; ok {
+		return index
+	}
+	return pod.Labels[PodGroupLabelOrdinal]
+}
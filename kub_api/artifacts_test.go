@@ -0,0 +1,89 @@
+package kub_api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGenerateBatchJobArtifactsSidecar(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		job := testQueueJob("test", nil)
+		artifactsDir := "/results"
+		job.ArtifactsDir = &artifactsDir
+
+		batchJob, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		containers := batchJob.Spec.Template.Spec.Containers
+		if len(containers) != 2 || containers[1].Name != ArtifactsContainerName {
+			t.Fatalf("expected artifacts sidecar, got %+v", containers)
+		}
+		if containers[0].VolumeMounts[0].MountPath != artifactsDir || containers[1].VolumeMounts[0].MountPath != artifactsDir {
+			t.Errorf("expected shared volume at %s", artifactsDir)
+		}
+		if !strings.Contains(containers[1].Command[2], "/results/.collected") {
+			t.Errorf("unexpected sidecar command %v", containers[1].Command)
+		}
+	})
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		finished := testJobPod("test-a", "test", corev1.PodRunning)
+		finished.Labels[batchv1.JobCompletionIndexAnnotation] = "0"
+		finished.Spec.Containers = []corev1.Container{
+			{Name: "test"},
+			{Name: ArtifactsContainerName, VolumeMounts: []corev1.VolumeMount{{Name: ArtifactsVolumeName, MountPath: "/results"}}},
+		}
+		finished.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "test", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+			{Name: ArtifactsContainerName, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}
+		running := finished.DeepCopy()
+		running.Name = "test-b"
+		running.Status.ContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+
+		archive := testTar(t, map[string]string{"out/report.txt": "done", "out/data/rows.csv": "a,b"})
+		commands := []string{}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(finished, running)}
+		api.executor = func(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+			commands = append(commands, pod+"/"+container+": "+strings.Join(command, " "))
+			if command[0] == "tar" {
+				_, err := stdout.Write(archive)
+				return err
+			}
+			return nil
+		}
+
+		destDir := t.TempDir()
+		collected, err := api.CollectArtifacts(context.Background(), testQueueJob("test", nil), []string{"/results/out"}, destDir)
+		if !errors.Is(err, ErrArtifactsNotReady) || !strings.Contains(err.Error(), "pod test-b") {
+			t.Errorf("expected test-b to be reported as not ready, got %v", err)
+		}
+		if len(collected) != 1 || collected[0].Pod != "test-a" || collected[0].Files != 2 {
+			t.Fatalf("unexpected artifacts %+v", collected)
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, "0", "test-a", "out", "report.txt"))
+		if err != nil || string(data) != "done" {
+			t.Errorf("unexpected artifact %q: %v", data, err)
+		}
+		expected := []string{
+			"test-a/artifacts: tar cf - -C /results out",
+			"test-a/artifacts: touch /results/.collected",
+		}
+		if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("unexpected commands %v", commands)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package kub_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+type AuditRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Cluster   string          `json:"cluster"`
+	Verb      string          `json:"verb"`
+	Namespace string          `json:"namespace,omitempty"`
+	Kind      string          `json:"kind"`
+	Name      string          `json:"name"`
+	Diff      json.RawMessage `json:"diff,omitempty"`
+	Result    string          `json:"result"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type AuditSink interface {
+	Write(record AuditRecord) error
+}
+
+// Auditor records every mutation made through KubAPI to its sinks.
+type Auditor struct {
+	Actor   string
+	Cluster string
+	Sinks   []AuditSink
+}
+
+// AuditorNew resolves actor and cluster from the current context of the kubeconfig.
+func AuditorNew(kubeconfig string, sinks ...AuditSink) (*Auditor, error) {
+	config, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	kubeContext, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("current context %q not found in %s", config.CurrentContext, kubeconfig)
+	}
+
+	ret := Auditor{Actor: kubeContext.AuthInfo, Cluster: kubeContext.Cluster, Sinks: sinks}
+	if authInfo, ok := config.AuthInfos[kubeContext.AuthInfo]; ok && authInfo.Username != "" {
+		ret.Actor = authInfo.Username
+	}
+	return &ret, nil
+}
+
+func (kapi *KubAPI) SetAuditSinks(sinks ...AuditSink) error {
+	auditor, err := AuditorNew(*kapi.Kubeconfig, sinks...)
+	if err != nil {
+		return err
+	}
+	kapi.Auditor = auditor
+	return nil
+}
+
+func isMutation(verb string) bool {
+	switch verb {
+	case "create", "update", "patch", "apply", "delete":
+		return true
+	}
+	return false
+}
+
+func (kapi *KubAPI) audit(op *operation, err error) {
+	if kapi.Auditor == nil || !isMutation(op.verb) {
+		return
+	}
+
+	record := AuditRecord{
+		Timestamp: op.start.UTC(),
+		Actor:     kapi.Auditor.Actor,
+		Cluster:   kapi.Auditor.Cluster,
+		Verb:      op.verb,
+		Namespace: op.namespace,
+		Kind:      op.kind,
+		Name:      op.name,
+		Result:    AuditResultSuccess,
+	}
+	if len(op.diff) > 0 && json.Valid(op.diff) {
+		record.Diff = op.diff
+	}
+	if err != nil {
+		record.Result = AuditResultFailure
+		record.Error = err.Error()
+	}
+
+	for _, sink := range kapi.Auditor.Sinks {
+		if sinkErr := sink.Write(record); sinkErr != nil {
+			kapi.log().Warn("failed writing audit record", slog.String(LogFieldKind, op.kind), slog.String(LogFieldName, op.name), slog.String(LogFieldError, sinkErr.Error()))
+		}
+	}
+}
+
+// MemoryAuditSink keeps records in memory, intended for tests.
+type MemoryAuditSink struct {
+	mutex   sync.Mutex
+	records []AuditRecord
+}
+
+func (sink *MemoryAuditSink) Write(record AuditRecord) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.records = append(sink.records, record)
+	return nil
+}
+
+func (sink *MemoryAuditSink) Records() []AuditRecord {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return append([]AuditRecord{}, sink.records...)
+}
+
+// JSONLinesAuditSink appends one JSON document per record to a file.
+type JSONLinesAuditSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func JSONLinesAuditSinkNew(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{file: file}, nil
+}
+
+func (sink *JSONLinesAuditSink) Write(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	_, err = sink.file.Write(append(data, '\n'))
+	return err
+}
+
+func (sink *JSONLinesAuditSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return sink.file.Close()
+}
+
+// RotatingFileAuditSink writes JSON lines to Path and rotates it to Path.1 .. Path.MaxBackups
+// once it grows beyond MaxBytes.
+type RotatingFileAuditSink struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+
+	mutex sync.Mutex
+}
+
+func (sink *RotatingFileAuditSink) Write(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	info, err := os.Stat(sink.Path)
+	if err == nil && sink.MaxBytes > 0 && info.Size()+int64(len(data)) > sink.MaxBytes {
+		err = sink.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(sink.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(data)
+	return err
+}
+
+func (sink *RotatingFileAuditSink) rotate() error {
+	if sink.MaxBackups < 1 {
+		return os.Truncate(sink.Path, 0)
+	}
+	for index := sink.MaxBackups - 1; index >= 1; index-- {
+		src := fmt.Sprintf("%s.%d", sink.Path, index)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		err := os.Rename(src, fmt.Sprintf("%s.%d", sink.Path, index+1))
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(sink.Path, sink.Path+".1")
+}
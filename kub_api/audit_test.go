@@ -0,0 +1,106 @@
+package kub_api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		sink := MemoryAuditSink{}
+		api := KubAPI{Namespace: &namespace, Auditor: &Auditor{Actor: "admin", Cluster: "kind", Sinks: []AuditSink{&sink}}}
+
+		op := api.startOperation(context.Background(), "patch", "Job", "test")
+		op.setDiff([]byte(`{"spec":{"parallelism":2}}`))
+		api.finishOperation(op, nil)
+
+		op = api.startOperation(context.Background(), "delete", "Job", "test")
+		api.finishOperation(op, errors.New("not found"))
+
+		op = api.startOperation(context.Background(), "list", "Pod", "")
+		api.finishOperation(op, nil)
+
+		records := sink.Records()
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got %d", len(records))
+		}
+		if records[0].Actor != "admin" || records[0].Cluster != "kind" || records[0].Namespace != "test" || string(records[0].Diff) != `{"spec":{"parallelism":2}}` {
+			t.Errorf("unexpected record %+v", records[0])
+		}
+		if records[1].Result != AuditResultFailure || records[1].Error != "not found" {
+			t.Errorf("unexpected record %+v", records[1])
+		}
+	})
+}
+
+func TestAuditorNew(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		kubeconfig := filepath.Join(t.TempDir(), "config")
+		data := `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: dev-user
+  user:
+    username: alice
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+`
+		if err := os.WriteFile(kubeconfig, []byte(data), 0600); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		auditor, err := AuditorNew(kubeconfig)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if auditor.Actor != "alice" || auditor.Cluster != "dev-cluster" {
+			t.Errorf("unexpected auditor %+v", auditor)
+		}
+	})
+}
+
+func TestRotatingFileAuditSink(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		sink := RotatingFileAuditSink{Path: path, MaxBytes: 300, MaxBackups: 2}
+
+		for range 10 {
+			err := sink.Write(AuditRecord{Verb: "create", Kind: "Job", Name: "test", Result: AuditResultSuccess})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+
+		for _, name := range []string{path, path + ".1", path + ".2"} {
+			file, err := os.Open(name)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				record := AuditRecord{}
+				if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Errorf("%v", err)
+				}
+			}
+			file.Close()
+		}
+		if _, err := os.Stat(path + ".3"); err == nil {
+			t.Errorf("expected at most 2 backups")
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package kub_api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ConfigSources are the inputs of a ConfigMap or Secret, as the --from-* flags of kubectl create.
+type ConfigSources struct {
+	// Files are "path" or "key=path". A directory adds each regular file directly in it,
+	// keyed by the file name.
+	Files []string
+	// EnvFiles hold KEY=VALUE lines; blank lines and lines starting with # are skipped and a
+	// line with a KEY only takes the value from the environment.
+	EnvFiles []string
+	// Literals are "key=value".
+	Literals []string
+}
+
+// LoadConfigSources reads the sources into one key set. A key given twice is an error.
+func LoadConfigSources(sources ConfigSources) (map[string][]byte, error) {
+	ret := map[string][]byte{}
+	add := func(key string, value []byte) error {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("invalid key %s: %s", key, strings.Join(errs, ", "))
+		}
+		if _, ok := ret[key]; ok {
+			return fmt.Errorf("key %s given twice", key)
+		}
+		ret[key] = value
+		return nil
+	}
+
+	for _, source := range sources.Files {
+		key, path, found := strings.Cut(source, "=")
+		if !found {
+			key, path = "", source
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if key == "" {
+				key = filepath.Base(path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if err = add(key, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if found {
+			return nil, fmt.Errorf("directory %s can not be given a key", path)
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(path, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if err = add(entry.Name(), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, path := range sources.EnvFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				value = os.Getenv(key)
+			}
+			if err = add(key, []byte(value)); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, literal := range sources.Literals {
+		key, value, found := strings.Cut(literal, "=")
+		if !found {
+			return nil, fmt.Errorf("literal %s is not key=value", literal)
+		}
+		if err := add(key, []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// ConfigMapNew builds a ConfigMap from the sources. Values that are not valid UTF-8 go to
+// binaryData, as kubectl does.
+func ConfigMapNew(name string, sources ConfigSources) (*corev1.ConfigMap, error) {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("configmap %s: invalid name: %v", name, errs)
+	}
+	data, err := LoadConfigSources(sources)
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s: %w", name, err)
+	}
+	ret := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}, Data: map[string]string{}}
+	for key, value := range data {
+		if utf8.Valid(value) {
+			ret.Data[key] = string(value)
+			continue
+		}
+		if ret.BinaryData == nil {
+			ret.BinaryData = map[string][]byte{}
+		}
+		ret.BinaryData[key] = value
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) CreateConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	op := kapi.startOperation(ctx, "create", "ConfigMap", configMap.Name)
+	op.setDiff(configMap)
+	ret, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Create(op.ctx, configMap, metav1.CreateOptions{})
+	if err != nil {
+		kapi.finishOperation(op, err)
+		return nil, err
+	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(ret.UID)))
+	return ret, nil
+}
+
+// ApplyConfigMap creates the ConfigMap or replaces the data of an existing one.
+func (kapi *KubAPI) ApplyConfigMap(ctx context.Context, configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	if configMap.ResourceVersion == "" {
+		op := kapi.startOperation(ctx, "get", "ConfigMap", configMap.Name)
+		existing, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Get(op.ctx, configMap.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Not a failure, the ConfigMap is created.
+			kapi.finishOperation(op, nil)
+			return kapi.CreateConfigMap(ctx, configMap)
+		}
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+		configMap = configMap.DeepCopy()
+		configMap.ResourceVersion = existing.ResourceVersion
+	}
+
+	op := kapi.startOperation(ctx, "update", "ConfigMap", configMap.Name)
+	op.setDiff(configMap)
+	ret, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Update(op.ctx, configMap, metav1.UpdateOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) GetConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	op := kapi.startOperation(ctx, "get", "ConfigMap", name)
+	ret, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) DeleteConfigMap(ctx context.Context, name string) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "delete", "ConfigMap", name)
+	err = kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	kapi.finishOperation(op, err)
+	return err
+}
+
+// MountConfigMap mounts the ConfigMap read-only at mountPath in the job container. Items
+// restrict the mount to these keys, each mounted as a file named after the key.
+func (job *Job) MountConfigMap(name, mountPath string, items ...string) {
+	source := &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}
+	for _, key := range items {
+		source.Items = append(source.Items, corev1.KeyToPath{Key: key, Path: key})
+	}
+	job.addVolume(corev1.Volume{Name: jobVolumeName("configmap", name), VolumeSource: corev1.VolumeSource{ConfigMap: source}}, mountPath)
+}
+
+// EnvFromConfigMap exposes every key of the ConfigMap as an environment variable, prefixed by prefix.
+func (job *Job) EnvFromConfigMap(name, prefix string) {
+	job.addEnvFrom(corev1.EnvFromSource{Prefix: prefix, ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}})
+}
+
+// EnvFromConfigMapKey sets the environment variable envName to one key of the ConfigMap.
+func (job *Job) EnvFromConfigMapKey(envName, name, key string) {
+	job.addEnv(corev1.EnvVar{Name: envName, ValueFrom: &corev1.EnvVarSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key},
+	}})
+}
+
+// jobVolumeName derives a volume name, a DNS label, from the name of a ConfigMap or Secret,
+// which may contain dots and be longer.
+func jobVolumeName(prefix, name string) string {
+	ret := strings.ReplaceAll(prefix+"-"+name, ".", "-")
+	if len(ret) > validation.DNS1123LabelMaxLength {
+		ret = strings.TrimRight(ret[:validation.DNS1123LabelMaxLength], "-")
+	}
+	return ret
+}
+
+func (job *Job) addVolume(volume corev1.Volume, mountPath string) {
+	if job.Volumes == nil {
+		job.Volumes = &[]corev1.Volume{}
+	}
+	if job.ContainerVolumeMounts == nil {
+		job.ContainerVolumeMounts = &[]corev1.VolumeMount{}
+	}
+	*job.Volumes = append(*job.Volumes, volume)
+	*job.ContainerVolumeMounts = append(*job.ContainerVolumeMounts, corev1.VolumeMount{Name: volume.Name, MountPath: mountPath, ReadOnly: true})
+}
+
+func (job *Job) addEnvFrom(source corev1.EnvFromSource) {
+	if job.ContainerEnvFrom == nil {
+		job.ContainerEnvFrom = &[]corev1.EnvFromSource{}
+	}
+	*job.ContainerEnvFrom = append(*job.ContainerEnvFrom, source)
+}
+
+func (job *Job) addEnv(env corev1.EnvVar) {
+	if job.ContainerEnv == nil {
+		job.ContainerEnv = &[]corev1.EnvVar{}
+	}
+	*job.ContainerEnv = append(*job.ContainerEnv, env)
+}
@@ -0,0 +1,137 @@
+package kub_api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadConfigSources(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("port: 8080\n"), 0o644)
+		os.Mkdir(filepath.Join(dir, "conf.d"), 0o755)
+		os.WriteFile(filepath.Join(dir, "conf.d", "a.conf"), []byte("a"), 0o644)
+		os.WriteFile(filepath.Join(dir, "conf.d", "b.bin"), []byte{0xff, 0xfe}, 0o644)
+		os.Mkdir(filepath.Join(dir, "conf.d", "nested"), 0o755)
+		os.WriteFile(filepath.Join(dir, "app.env"), []byte("# comment\n\nLEVEL=debug\nFROM_ENV\n"), 0o644)
+		t.Setenv("FROM_ENV", "inherited")
+
+		configMap, err := ConfigMapNew("app", ConfigSources{
+			Files:    []string{filepath.Join(dir, "app.yaml"), "settings.yaml=" + filepath.Join(dir, "app.yaml"), filepath.Join(dir, "conf.d")},
+			EnvFiles: []string{filepath.Join(dir, "app.env")},
+			Literals: []string{"mode=batch"},
+		})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for key, value := range map[string]string{"app.yaml": "port: 8080\n", "settings.yaml": "port: 8080\n", "a.conf": "a", "LEVEL": "debug", "FROM_ENV": "inherited", "mode": "batch"} {
+			if configMap.Data[key] != value {
+				t.Errorf("%s: expected %q, got %q", key, value, configMap.Data[key])
+			}
+		}
+		if len(configMap.BinaryData["b.bin"]) != 2 || len(configMap.Data) != 6 {
+			t.Errorf("unexpected configmap %+v", configMap)
+		}
+	})
+
+	t.Run("Invalid sources", func(t *testing.T) {
+		for description, sources := range map[string]ConfigSources{
+			"duplicate key": {Literals: []string{"a=1", "a=2"}},
+			"bad literal":   {Literals: []string{"a"}},
+			"bad key":       {Literals: []string{"a/b=1"}},
+			"missing file":  {Files: []string{"/nonexistent/file"}},
+		} {
+			_, err := LoadConfigSources(sources)
+			if err == nil {
+				t.Errorf("%s: expected error", description)
+			}
+		}
+	})
+}
+
+func TestConfigMapLifecycle(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		sink := MemoryAuditSink{}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(), Auditor: &Auditor{Sinks: []AuditSink{&sink}}}
+
+		configMap, err := ConfigMapNew("app", ConfigSources{Literals: []string{"mode=batch"}})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = api.CreateConfigMap(context.Background(), configMap)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		configMap.Data["mode"] = "stream"
+		_, err = api.ApplyConfigMap(context.Background(), configMap)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		fetched, err := api.GetConfigMap(context.Background(), "app")
+		if err != nil || fetched.Data["mode"] != "stream" {
+			t.Fatalf("unexpected configmap %+v: %v", fetched, err)
+		}
+		for _, record := range sink.Records() {
+			if record.Result == AuditResultFailure {
+				t.Errorf("unexpected failed audit record %+v", record)
+			}
+		}
+		err = api.DeleteConfigMap(context.Background(), "app")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	})
+
+	t.Run("Default namespace", func(t *testing.T) {
+		namespace := "default"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+
+		configMap, err := ConfigMapNew("app", ConfigSources{Literals: []string{"mode=batch"}})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = api.ApplyConfigMap(context.Background(), configMap)
+		if err == nil {
+			t.Errorf("expected apply in the default namespace to fail")
+		}
+	})
+}
+
+func TestJobConfigWiring(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		job := testQueueJob("test", map[string]string{})
+		job.MountConfigMap("app.config", "/etc/app", "app.yaml")
+		job.MountSecret("app-credentials", "/var/run/secrets/app")
+		job.EnvFromConfigMap("app.config", "APP_")
+		job.EnvFromSecretKey("DB_PASSWORD", "app-credentials", "password")
+		job.UseImagePullSecret("registry")
+
+		batchJob, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		podSpec := batchJob.Spec.Template.Spec
+		if len(podSpec.Volumes) != 2 || podSpec.Volumes[0].Name != "configmap-app-config" || podSpec.Volumes[0].ConfigMap.Items[0].Key != "app.yaml" {
+			t.Errorf("unexpected volumes %+v", podSpec.Volumes)
+		}
+		container := podSpec.Containers[0]
+		if len(container.VolumeMounts) != 2 || container.VolumeMounts[1].MountPath != "/var/run/secrets/app" || !container.VolumeMounts[1].ReadOnly {
+			t.Errorf("unexpected mounts %+v", container.VolumeMounts)
+		}
+		if container.EnvFrom[0].Prefix != "APP_" || container.Env[len(container.Env)-1].ValueFrom.SecretKeyRef.Key != "password" {
+			t.Errorf("unexpected env %+v %+v", container.EnvFrom, container.Env)
+		}
+		if podSpec.ImagePullSecrets[0].Name != "registry" {
+			t.Errorf("unexpected pull secrets %+v", podSpec.ImagePullSecrets)
+		}
+		if name := jobVolumeName("secret", strings.Repeat("a", 80)); len(name) != 63 {
+			t.Errorf("expected a truncated volume name, got %s", name)
+		}
+	})
+}
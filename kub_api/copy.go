@@ -0,0 +1,208 @@
+package kub_api
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CopyFromPod copies srcPath, a file or directory of the container, into destDir/<base of srcPath>
+// like kubectl cp. The container needs tar. Returns the number of files copied.
+func (kapi *KubAPI) CopyFromPod(ctx context.Context, pod, container, srcPath, destDir string) (int, error) {
+	srcPath = path.Clean(srcPath)
+	command := []string{"tar", "cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+
+	reader, writer := io.Pipe()
+	stderr := &limitedBuffer{limit: 4096}
+	execDone := make(chan error, 1)
+	go func() {
+		err := kapi.exec(ctx, pod, container, command, nil, writer, stderr, false)
+		writer.CloseWithError(err)
+		execDone <- err
+	}()
+
+	files, skipped, untarErr := untar(reader, destDir)
+	// Unblock the exec stream if extraction stopped early.
+	reader.CloseWithError(io.ErrClosedPipe)
+	execErr := <-execDone
+	for _, name := range skipped {
+		kapi.log().Warn("skipping link, links are not copied", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, pod), slog.String("entry", name))
+	}
+	// A failed extraction closes the stream, so the exec error would only be the closed pipe.
+	if untarErr != nil {
+		return files, untarErr
+	}
+	if execErr != nil {
+		return files, execError(execErr, stderr.String())
+	}
+	return files, nil
+}
+
+// CopyToPod copies srcPath, a local file or directory, into the directory destDir of the container,
+// creating destDir/<base of srcPath>. The container needs tar. Returns the number of files copied.
+func (kapi *KubAPI) CopyToPod(ctx context.Context, pod, container, srcPath, destDir string) (int, error) {
+	_, err := os.Stat(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	command := []string{"tar", "xmf", "-", "-C", destDir}
+
+	reader, writer := io.Pipe()
+	filesDone := make(chan int, 1)
+	go func() {
+		files, err := tarPath(writer, srcPath)
+		writer.CloseWithError(err)
+		filesDone <- files
+	}()
+
+	stderr := &limitedBuffer{limit: 4096}
+	err = kapi.exec(ctx, pod, container, command, reader, nil, stderr, false)
+	// Unblock the tar writer if the remote side stopped reading.
+	reader.CloseWithError(io.ErrClosedPipe)
+	files := <-filesDone
+	if err != nil {
+		return files, execError(err, stderr.String())
+	}
+	return files, nil
+}
+
+// tarPath writes srcPath as a tar archive with entries relative to its parent directory.
+// Symlinks are skipped, like untar skips them on the way back.
+func tarPath(writer io.Writer, srcPath string) (int, error) {
+	srcPath = filepath.Clean(srcPath)
+	parent := filepath.Dir(srcPath)
+	tarWriter := tar.NewWriter(writer)
+	files := 0
+
+	err := filepath.WalkDir(srcPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(parent, filePath)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		if err != nil {
+			return err
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return files, err
+	}
+	return files, tarWriter.Close()
+}
+
+// untar extracts a tar stream into destDir and returns the number of regular files written and
+// the names of the skipped links. As the stream comes from the container, entries escaping
+// destDir are rejected and links are skipped, like kubectl cp does.
+func untar(reader io.Reader, destDir string) (files int, skipped []string, err error) {
+	root, err := filepath.Abs(destDir)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return files, skipped, nil
+		}
+		if err != nil {
+			return files, skipped, err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(header.Name))
+		if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return files, skipped, fmt.Errorf("tar entry %s escapes %s", header.Name, destDir)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return files, skipped, err
+			}
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err != nil {
+				return files, skipped, err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return files, skipped, err
+			}
+			_, err = io.Copy(file, tarReader)
+			closeErr := file.Close()
+			if err != nil {
+				return files, skipped, err
+			}
+			if closeErr != nil {
+				return files, skipped, closeErr
+			}
+			files++
+		case tar.TypeSymlink, tar.TypeLink:
+			skipped = append(skipped, header.Name)
+		}
+	}
+}
+
+// limitedBuffer keeps the first limit bytes written to it, e.g. the head of a remote stderr.
+type limitedBuffer struct {
+	limit int
+	data  []byte
+}
+
+func (buffer *limitedBuffer) Write(data []byte) (int, error) {
+	room := buffer.limit - len(buffer.data)
+	if room > 0 {
+		buffer.data = append(buffer.data, data[:min(room, len(data))]...)
+	}
+	return len(data), nil
+}
+
+func (buffer *limitedBuffer) String() string {
+	return string(buffer.data)
+}
@@ -0,0 +1,129 @@
+package kub_api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testTar(t *testing.T, files map[string]string) []byte {
+	buffer := bytes.Buffer{}
+	writer := tar.NewWriter(&buffer)
+	for name, content := range files {
+		err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = writer.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCopyToFromPod(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		containerRoot := t.TempDir()
+		api := KubAPI{Namespace: &namespace}
+		// The fake container runs tar against containerRoot.
+		api.executor = func(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+			dir := filepath.Join(containerRoot, command[4])
+			switch command[1] {
+			case "xmf":
+				_, _, err := untar(stdin, dir)
+				return err
+			case "cf":
+				_, err := tarPath(stdout, filepath.Join(dir, command[5]))
+				return err
+			}
+			t.Fatalf("unexpected command %v", command)
+			return nil
+		}
+
+		srcDir := filepath.Join(t.TempDir(), "input")
+		err := os.MkdirAll(filepath.Join(srcDir, "nested"), 0755)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for name, content := range map[string]string{"a.txt": "a", "nested/b.txt": "b"} {
+			err = os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+
+		files, err := api.CopyToPod(context.Background(), "test", "test", srcDir, "/tmp")
+		if err != nil || files != 2 {
+			t.Fatalf("copy to pod: %d files, %v", files, err)
+		}
+		data, err := os.ReadFile(filepath.Join(containerRoot, "tmp", "input", "nested", "b.txt"))
+		if err != nil || string(data) != "b" {
+			t.Fatalf("unexpected file in container %q: %v", data, err)
+		}
+
+		destDir := t.TempDir()
+		files, err = api.CopyFromPod(context.Background(), "test", "test", "/tmp/input", destDir)
+		if err != nil || files != 2 {
+			t.Fatalf("copy from pod: %d files, %v", files, err)
+		}
+		data, err = os.ReadFile(filepath.Join(destDir, "input", "a.txt"))
+		if err != nil || string(data) != "a" {
+			t.Errorf("unexpected copied file %q: %v", data, err)
+		}
+	})
+}
+
+func TestUntar(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		buffer := bytes.Buffer{}
+		writer := tar.NewWriter(&buffer)
+		writer.WriteHeader(&tar.Header{Name: "out/link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+		writer.WriteHeader(&tar.Header{Name: "out/hard", Linkname: "out/a.txt", Typeflag: tar.TypeLink})
+		writer.WriteHeader(&tar.Header{Name: "out/a.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+		writer.Write([]byte("a"))
+		writer.Close()
+
+		destDir := t.TempDir()
+		files, skipped, err := untar(&buffer, destDir)
+		if err != nil || files != 1 || strings.Join(skipped, ",") != "out/link,out/hard" {
+			t.Fatalf("unexpected untar: %d files, skipped %v, %v", files, skipped, err)
+		}
+		if _, err = os.Lstat(filepath.Join(destDir, "out", "link")); !os.IsNotExist(err) {
+			t.Errorf("expected the link to be skipped, got %v", err)
+		}
+	})
+
+	t.Run("Path traversal", func(t *testing.T) {
+		_, _, err := untar(bytes.NewReader(testTar(t, map[string]string{"../escape.txt": "x"})), t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("expected path traversal to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestCopyFromPodUntarError(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace}
+		archive := testTar(t, map[string]string{"../escape.txt": strings.Repeat("x", 1<<20)})
+		api.executor = func(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+			_, err := stdout.Write(archive)
+			return err
+		}
+		_, err := api.CopyFromPod(context.Background(), "test", "test", "/tmp/out", t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("expected the untar error, got %v", err)
+		}
+	})
+}
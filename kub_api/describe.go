@@ -0,0 +1,554 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DescribeMaxEvents limits the events shown by Describe to the most recent ones.
+const DescribeMaxEvents = 20
+
+type DescriptionField struct {
+	Key   string
+	Value string
+}
+
+// DescriptionSection is a titled table, e.g. the containers of a pod.
+type DescriptionSection struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Description is a human readable summary of an object, rendered like kubectl describe.
+type Description struct {
+	Kind     string
+	Name     string
+	Fields   []DescriptionField
+	Sections []DescriptionSection
+	Events   []EventRecord
+}
+
+func (description *Description) addField(key, value string) {
+	description.Fields = append(description.Fields, DescriptionField{Key: key, Value: value})
+}
+
+func (description *Description) addSection(title string, header []string, rows [][]string) {
+	description.Sections = append(description.Sections, DescriptionSection{Title: title, Header: header, Rows: rows})
+}
+
+func (description *Description) addMeta(meta *metav1.ObjectMeta) {
+	description.addField("Name", meta.Name)
+	if meta.Namespace != "" {
+		description.addField("Namespace", meta.Namespace)
+	}
+	description.addField("Created", formatTimeAge(meta.CreationTimestamp.Time))
+	description.addField("Labels", formatMap(meta.Labels))
+	description.addField("Annotations", formatMap(meta.Annotations))
+	if len(meta.OwnerReferences) > 0 {
+		owners := []string{}
+		for _, owner := range meta.OwnerReferences {
+			owners = append(owners, owner.Kind+"/"+owner.Name)
+		}
+		description.addField("Owned by", strings.Join(owners, ", "))
+	}
+}
+
+// Render writes the description as aligned text.
+func (description *Description) Render(writer io.Writer) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	for _, field := range description.Fields {
+		fmt.Fprintf(tabWriter, "%s:\t%s\n", field.Key, field.Value)
+	}
+	for _, section := range description.Sections {
+		fmt.Fprintf(tabWriter, "%s:\n", section.Title)
+		if len(section.Rows) == 0 {
+			fmt.Fprintf(tabWriter, "  <none>\n")
+			continue
+		}
+		fmt.Fprintf(tabWriter, "  %s\n", strings.Join(section.Header, "\t"))
+		for _, row := range section.Rows {
+			fmt.Fprintf(tabWriter, "  %s\n", strings.Join(row, "\t"))
+		}
+	}
+	fmt.Fprintf(tabWriter, "Events:\n")
+	if len(description.Events) == 0 {
+		fmt.Fprintf(tabWriter, "  <none>\n")
+	} else {
+		fmt.Fprintf(tabWriter, "  TYPE\tREASON\tAGE\tFROM\tMESSAGE\n")
+		for _, event := range description.Events {
+			fmt.Fprintf(tabWriter, "  %s\t%s\t%s\t%s\t%s\n", event.Type, event.Reason, formatAge(event.Time), event.Source, event.Message)
+		}
+	}
+	return tabWriter.Flush()
+}
+
+// Describe summarizes the object of kind in the active namespace. Supported kinds are job, pod,
+// service, ingress, namespace, serviceaccount, role and rolebinding, with their kubectl short names.
+func (kapi *KubAPI) Describe(ctx context.Context, kind, name string) (*Description, error) {
+	var ret *Description
+	var uid types.UID
+	var err error
+	switch strings.ToLower(kind) {
+	case "job", "jobs":
+		ret, uid, err = kapi.describeJob(ctx, name)
+	case "pod", "pods", "po":
+		ret, uid, err = kapi.describePod(ctx, name)
+	case "service", "services", "svc":
+		ret, uid, err = kapi.describeService(ctx, name)
+	case "ingress", "ingresses", "ing":
+		ret, uid, err = kapi.describeIngress(ctx, name)
+	case "namespace", "namespaces", "ns":
+		ret, uid, err = kapi.describeNamespace(ctx, name)
+	case "serviceaccount", "serviceaccounts", "sa":
+		ret, uid, err = kapi.describeServiceAccount(ctx, name)
+	case "role", "roles":
+		ret, uid, err = kapi.describeRole(ctx, name)
+	case "rolebinding", "rolebindings":
+		ret, uid, err = kapi.describeRoleBinding(ctx, name)
+	default:
+		return nil, fmt.Errorf("describe: unsupported kind %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reference := corev1.ObjectReference{Kind: ret.Kind, Name: name, UID: uid}
+	if ret.Kind == "Namespace" {
+		// Events of cluster scoped objects are recorded in the default namespace.
+		reference.Namespace = metav1.NamespaceDefault
+	}
+	events, err := kapi.GetEvents(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > DescribeMaxEvents {
+		events = events[len(events)-DescribeMaxEvents:]
+	}
+	ret.Events = events
+	return ret, nil
+}
+
+func (kapi *KubAPI) describeJob(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Job", name)
+	batchJob, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Job", Name: name}
+	ret.addMeta(&batchJob.ObjectMeta)
+	spec := batchJob.Spec
+	ret.addField("Parallelism", formatInt32(spec.Parallelism))
+	ret.addField("Completions", formatInt32(spec.Completions))
+	ret.addField("Backoff Limit", formatInt32(spec.BackoffLimit))
+	ret.addField("Suspend", fmt.Sprint(IsJobSuspended(batchJob)))
+	if spec.ActiveDeadlineSeconds != nil {
+		ret.addField("Active Deadline", fmt.Sprintf("%ds", *spec.ActiveDeadlineSeconds))
+	}
+	if spec.TTLSecondsAfterFinished != nil {
+		ret.addField("TTL After Finished", fmt.Sprintf("%ds", *spec.TTLSecondsAfterFinished))
+	}
+	if batchJob.Status.StartTime != nil {
+		ret.addField("Start Time", formatTimeAge(batchJob.Status.StartTime.Time))
+	}
+	if batchJob.Status.CompletionTime != nil {
+		ret.addField("Completed At", formatTimeAge(batchJob.Status.CompletionTime.Time))
+	}
+	ret.addField("Pods Statuses", fmt.Sprintf("%d Active / %d Succeeded / %d Failed", batchJob.Status.Active, batchJob.Status.Succeeded, batchJob.Status.Failed))
+	ret.addSection("Containers", []string{"NAME", "IMAGE", "COMMAND"}, containerRows(batchJob.Spec.Template.Spec.Containers))
+
+	conditions := [][]string{}
+	for _, condition := range batchJob.Status.Conditions {
+		conditions = append(conditions, []string{string(condition.Type), string(condition.Status), condition.Reason, condition.Message})
+	}
+	ret.addSection("Conditions", []string{"TYPE", "STATUS", "REASON", "MESSAGE"}, conditions)
+
+	op = kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+	podRows := [][]string{}
+	for index := range pods.Items {
+		pod := &pods.Items[index]
+		reason := ""
+		if failure := ClassifyPodFailure(pod); failure != nil {
+			reason = failure.Reason
+		}
+		podRows = append(podRows, []string{pod.Name, string(pod.Status.Phase), reason, pod.Spec.NodeName})
+	}
+	ret.addSection("Pods", []string{"NAME", "PHASE", "FAILURE", "NODE"}, podRows)
+	return &ret, batchJob.UID, nil
+}
+
+func (kapi *KubAPI) describePod(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Pod", name)
+	pod, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Pod", Name: name}
+	ret.addMeta(&pod.ObjectMeta)
+	ret.addField("Node", pod.Spec.NodeName)
+	ret.addField("Service Account", pod.Spec.ServiceAccountName)
+	ret.addField("Status", string(pod.Status.Phase))
+	if pod.Status.Reason != "" {
+		ret.addField("Reason", pod.Status.Reason)
+	}
+	ret.addField("IP", pod.Status.PodIP)
+	ret.addField("Restart Policy", string(pod.Spec.RestartPolicy))
+	if failure := ClassifyPodFailure(pod); failure != nil {
+		ret.addField("Failure", fmt.Sprintf("%s %s", failure.Reason, failure.Message))
+	}
+
+	containers := [][]string{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		containers = append(containers, []string{status.Name, status.Image, formatContainerState(status.State), fmt.Sprint(status.Ready), fmt.Sprint(status.RestartCount)})
+	}
+	ret.addSection("Containers", []string{"NAME", "IMAGE", "STATE", "READY", "RESTARTS"}, containers)
+
+	conditions := [][]string{}
+	for _, condition := range pod.Status.Conditions {
+		conditions = append(conditions, []string{string(condition.Type), string(condition.Status), condition.Reason})
+	}
+	ret.addSection("Conditions", []string{"TYPE", "STATUS", "REASON"}, conditions)
+
+	volumes := [][]string{}
+	for _, volume := range pod.Spec.Volumes {
+		volumes = append(volumes, []string{volume.Name, volumeSourceType(volume.VolumeSource)})
+	}
+	ret.addSection("Volumes", []string{"NAME", "TYPE"}, volumes)
+	return &ret, pod.UID, nil
+}
+
+func (kapi *KubAPI) describeService(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Service", name)
+	service, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Service", Name: name}
+	ret.addMeta(&service.ObjectMeta)
+	ret.addField("Type", string(service.Spec.Type))
+	ret.addField("Cluster IP", service.Spec.ClusterIP)
+	ret.addField("Selector", formatMap(service.Spec.Selector))
+	ports := [][]string{}
+	for _, port := range service.Spec.Ports {
+		nodePort := ""
+		if port.NodePort != 0 {
+			nodePort = fmt.Sprint(port.NodePort)
+		}
+		ports = append(ports, []string{port.Name, fmt.Sprint(port.Port), port.TargetPort.String(), string(port.Protocol), nodePort})
+	}
+	ret.addSection("Ports", []string{"NAME", "PORT", "TARGET", "PROTOCOL", "NODE PORT"}, ports)
+
+	backends := [][]string{}
+	if len(service.Spec.Selector) > 0 {
+		op = kapi.startOperation(ctx, "list", "Pod", "")
+		pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String()})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, "", err
+		}
+		for index := range pods.Items {
+			pod := &pods.Items[index]
+			backends = append(backends, []string{pod.Name, pod.Status.PodIP, fmt.Sprint(isPodReady(pod))})
+		}
+	}
+	ret.addSection("Backend Pods", []string{"NAME", "IP", "READY"}, backends)
+	return &ret, service.UID, nil
+}
+
+func (kapi *KubAPI) describeIngress(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Ingress", name)
+	ingress, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Ingress", Name: name}
+	ret.addMeta(&ingress.ObjectMeta)
+	className := "<none>"
+	if ingress.Spec.IngressClassName != nil {
+		className = *ingress.Spec.IngressClassName
+	}
+	ret.addField("Ingress Class", className)
+	addresses := []string{}
+	for _, address := range ingress.Status.LoadBalancer.Ingress {
+		addresses = append(addresses, address.IP+address.Hostname)
+	}
+	ret.addField("Address", strings.Join(addresses, ", "))
+	if ingress.Spec.DefaultBackend != nil && ingress.Spec.DefaultBackend.Service != nil {
+		ret.addField("Default Backend", formatIngressBackend(ingress.Spec.DefaultBackend.Service.Name, ingress.Spec.DefaultBackend.Service.Port.Name, ingress.Spec.DefaultBackend.Service.Port.Number))
+	}
+
+	tls := [][]string{}
+	for _, entry := range ingress.Spec.TLS {
+		tls = append(tls, []string{entry.SecretName, strings.Join(entry.Hosts, ",")})
+	}
+	ret.addSection("TLS", []string{"SECRET", "HOSTS"}, tls)
+
+	rules := [][]string{}
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, httpPath := range rule.HTTP.Paths {
+			backend := ""
+			if httpPath.Backend.Service != nil {
+				backend = formatIngressBackend(httpPath.Backend.Service.Name, httpPath.Backend.Service.Port.Name, httpPath.Backend.Service.Port.Number)
+			}
+			rules = append(rules, []string{host, httpPath.Path, backend})
+		}
+	}
+	ret.addSection("Rules", []string{"HOST", "PATH", "BACKEND"}, rules)
+	return &ret, ingress.UID, nil
+}
+
+func (kapi *KubAPI) describeNamespace(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Namespace", name)
+	namespace, err := kapi.clientset.CoreV1().Namespaces().Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Namespace", Name: name}
+	ret.addMeta(&namespace.ObjectMeta)
+	ret.addField("Status", string(namespace.Status.Phase))
+
+	op = kapi.startOperation(ctx, "list", "ResourceQuota", "")
+	op.namespace = name
+	quotas, err := kapi.clientset.CoreV1().ResourceQuotas(name).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+	quotaRows := [][]string{}
+	for _, quota := range quotas.Items {
+		for _, resourceName := range slices.Sorted(maps.Keys(quota.Status.Hard)) {
+			used := quota.Status.Used[resourceName]
+			hard := quota.Status.Hard[resourceName]
+			quotaRows = append(quotaRows, []string{quota.Name, string(resourceName), used.String(), hard.String()})
+		}
+	}
+	ret.addSection("Resource Quotas", []string{"NAME", "RESOURCE", "USED", "HARD"}, quotaRows)
+	return &ret, namespace.UID, nil
+}
+
+func (kapi *KubAPI) describeServiceAccount(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "ServiceAccount", name)
+	serviceAccount, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "ServiceAccount", Name: name}
+	ret.addMeta(&serviceAccount.ObjectMeta)
+	secrets := []string{}
+	for _, secret := range serviceAccount.Secrets {
+		secrets = append(secrets, secret.Name)
+	}
+	ret.addField("Secrets", formatList(secrets))
+	pullSecrets := []string{}
+	for _, secret := range serviceAccount.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, secret.Name)
+	}
+	ret.addField("Image Pull Secrets", formatList(pullSecrets))
+
+	bindings, err := kapi.describeRoleBindingsWhere(ctx, func(subjects []string, _ string) bool {
+		return slices.Contains(subjects, "ServiceAccount/"+name)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	ret.addSection("Role Bindings", []string{"NAME", "ROLE"}, bindings)
+	return &ret, serviceAccount.UID, nil
+}
+
+func (kapi *KubAPI) describeRole(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "Role", name)
+	role, err := kapi.clientset.RbacV1().Roles(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "Role", Name: name}
+	ret.addMeta(&role.ObjectMeta)
+	rules := [][]string{}
+	for _, rule := range role.Rules {
+		resources := append(append([]string{}, rule.Resources...), rule.NonResourceURLs...)
+		rules = append(rules, []string{strings.Join(resources, ","), formatList(rule.ResourceNames), strings.Join(rule.Verbs, ","), strings.Join(rule.APIGroups, ",")})
+	}
+	ret.addSection("Rules", []string{"RESOURCES", "RESOURCE NAMES", "VERBS", "API GROUPS"}, rules)
+
+	bindings, err := kapi.describeRoleBindingsWhere(ctx, func(_ []string, roleRef string) bool {
+		return roleRef == "Role/"+name
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	ret.addSection("Role Bindings", []string{"NAME", "ROLE"}, bindings)
+	return &ret, role.UID, nil
+}
+
+func (kapi *KubAPI) describeRoleBinding(ctx context.Context, name string) (*Description, types.UID, error) {
+	op := kapi.startOperation(ctx, "get", "RoleBinding", name)
+	roleBinding, err := kapi.clientset.RbacV1().RoleBindings(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := Description{Kind: "RoleBinding", Name: name}
+	ret.addMeta(&roleBinding.ObjectMeta)
+	ret.addField("Role", roleBinding.RoleRef.Kind+"/"+roleBinding.RoleRef.Name)
+	subjects := [][]string{}
+	for _, subject := range roleBinding.Subjects {
+		subjects = append(subjects, []string{subject.Kind, subject.Name, subject.Namespace})
+	}
+	ret.addSection("Subjects", []string{"KIND", "NAME", "NAMESPACE"}, subjects)
+	return &ret, roleBinding.UID, nil
+}
+
+// describeRoleBindingsWhere lists the role bindings of the namespace accepted by match, which gets
+// the subjects as Kind/Name and the role reference as Kind/Name.
+func (kapi *KubAPI) describeRoleBindingsWhere(ctx context.Context, match func(subjects []string, roleRef string) bool) ([][]string, error) {
+	op := kapi.startOperation(ctx, "list", "RoleBinding", "")
+	roleBindings, err := kapi.clientset.RbacV1().RoleBindings(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	ret := [][]string{}
+	for _, roleBinding := range roleBindings.Items {
+		subjects := []string{}
+		for _, subject := range roleBinding.Subjects {
+			subjects = append(subjects, subject.Kind+"/"+subject.Name)
+		}
+		roleRef := roleBinding.RoleRef.Kind + "/" + roleBinding.RoleRef.Name
+		if match(subjects, roleRef) {
+			ret = append(ret, []string{roleBinding.Name, roleRef})
+		}
+	}
+	return ret, nil
+}
+
+func containerRows(containers []corev1.Container) [][]string {
+	ret := [][]string{}
+	for _, container := range containers {
+		ret = append(ret, []string{container.Name, container.Image, strings.Join(container.Command, " ")})
+	}
+	return ret
+}
+
+func formatContainerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil:
+		return "Waiting: " + state.Waiting.Reason
+	case state.Terminated != nil:
+		return fmt.Sprintf("Terminated: %s (exit %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	}
+	return "Unknown"
+}
+
+func volumeSourceType(source corev1.VolumeSource) string {
+	switch {
+	case source.EmptyDir != nil:
+		return "EmptyDir"
+	case source.ConfigMap != nil:
+		return "ConfigMap " + source.ConfigMap.Name
+	case source.Secret != nil:
+		return "Secret " + source.Secret.SecretName
+	case source.PersistentVolumeClaim != nil:
+		return "PersistentVolumeClaim " + source.PersistentVolumeClaim.ClaimName
+	case source.Projected != nil:
+		return "Projected"
+	case source.HostPath != nil:
+		return "HostPath " + source.HostPath.Path
+	}
+	return "Other"
+}
+
+func formatIngressBackend(service, portName string, portNumber int32) string {
+	if portName != "" {
+		return service + ":" + portName
+	}
+	return fmt.Sprintf("%s:%d", service, portNumber)
+}
+
+func formatMap(values map[string]string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	pairs := []string{}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		pairs = append(pairs, key+"="+values[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func formatList(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	return strings.Join(values, ", ")
+}
+
+func formatInt32(value *int32) string {
+	if value == nil {
+		return "<unset>"
+	}
+	return fmt.Sprint(*value)
+}
+
+func formatTimeAge(at time.Time) string {
+	if at.IsZero() {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s (%s ago)", at.UTC().Format(time.RFC3339), formatAge(at))
+}
+
+// formatAge renders the time since at with the largest unit, like kubectl.
+func formatAge(at time.Time) string {
+	if at.IsZero() {
+		return "<unknown>"
+	}
+	age := time.Since(at)
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
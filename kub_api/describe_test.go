@@ -0,0 +1,80 @@
+package kub_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDescribe(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		batchJob, err := testQueueJob("test", map[string]string{"team": "data"}).GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		batchJob.Namespace = namespace
+		batchJob.Status.Failed = 1
+		batchJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: FailureReasonBackoff}}
+		failedPod := testJobPod("test-a", "test", corev1.PodFailed)
+		failedPod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "test", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: ExitCodeOOMKilled}}},
+		}
+		clientset := fake.NewSimpleClientset(
+			batchJob,
+			failedPod,
+			testCoreEvent("1", "Job", "test", "BackoffLimitExceeded", time.Now()),
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: namespace}},
+			&rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "runner-binding", Namespace: namespace},
+				RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "runner"},
+				Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: "runner", Namespace: namespace}},
+			},
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		description, err := api.Describe(context.Background(), "job", "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		output := strings.Builder{}
+		err = description.Render(&output)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for _, expected := range []string{
+			"Labels:", "team=data",
+			"Pods Statuses:", "0 Active / 0 Succeeded / 1 Failed",
+			"Failed", "BackoffLimitExceeded",
+			"test-a", "OOMKilled",
+			"Events:",
+		} {
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("expected %q in:\n%s", expected, output.String())
+			}
+		}
+		if len(description.Events) != 1 {
+			t.Errorf("expected 1 event, got %d", len(description.Events))
+		}
+
+		description, err = api.Describe(context.Background(), "sa", "runner")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(description.Sections) != 1 || len(description.Sections[0].Rows) != 1 || description.Sections[0].Rows[0][0] != "runner-binding" {
+			t.Errorf("unexpected role bindings %+v", description.Sections)
+		}
+
+		_, err = api.Describe(context.Background(), "widget", "test")
+		if err == nil {
+			t.Errorf("expected error for unsupported kind")
+		}
+	})
+}
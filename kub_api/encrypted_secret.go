@@ -0,0 +1,261 @@
+package kub_api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Encrypted Secret manifests keep their metadata readable for reviews and diffs and replace
+// every value with
+//
+//	ENC[AES256_GCM,key:<key id>,data:<base64 of nonce, ciphertext and tag>]
+//
+// A value is bound to its namespace, secret name and key, so values can not be moved between
+// secrets or keys without failing to decrypt.
+const SecretKeySize = 32
+
+var encryptedValuePattern = regexp.MustCompile(`^ENC\[AES256_GCM,key:([0-9a-f]+),data:([A-Za-z0-9+/=]+)\]$`)
+
+// SecretKey is an AES-256 key read from a local key file holding its base64 encoding.
+type SecretKey struct {
+	// ID identifies the key in encrypted values, so the right key is picked on decryption.
+	ID  string
+	key []byte
+}
+
+// GenerateSecretKey writes a new random key to path, readable by the owner only. An existing
+// file is not overwritten.
+func GenerateSecretKey(path string) (*SecretKey, error) {
+	key := make([]byte, SecretKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secretKeyNew(key), nil
+}
+
+func LoadSecretKey(path string) (*SecretKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("key file %s: expected a %d byte key, got %d", path, SecretKeySize, len(key))
+	}
+	return secretKeyNew(key), nil
+}
+
+func secretKeyNew(key []byte) *SecretKey {
+	sum := sha256.Sum256(key)
+	return &SecretKey{ID: hex.EncodeToString(sum[:8]), key: key}
+}
+
+func (key *SecretKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSecretManifest is the file layout, a Secret whose data values are encrypted strings.
+type encryptedSecretManifest struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Type       corev1.SecretType `json:"type,omitempty"`
+	Data       map[string]string `json:"data"`
+}
+
+func secretValueBinding(metadata *metav1.ObjectMeta, key string) []byte {
+	return []byte(metadata.Namespace + "/" + metadata.Name + "/" + key)
+}
+
+// EncryptSecretManifest encrypts the values of a plain Secret manifest, data and stringData alike.
+func EncryptSecretManifest(manifest []byte, key *SecretKey) ([]byte, error) {
+	secret := corev1.Secret{}
+	err := yaml.UnmarshalStrict(manifest, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("parsing secret manifest: %w", err)
+	}
+	if secret.Kind != "Secret" {
+		return nil, fmt.Errorf("expected a Secret manifest, got kind %q", secret.Kind)
+	}
+	return encryptSecret(&secret, key)
+}
+
+func encryptSecret(secret *corev1.Secret, key *SecretKey) ([]byte, error) {
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+	metadata := *secret.ObjectMeta.DeepCopy()
+	// Server populated fields do not belong in source control.
+	metadata.ResourceVersion, metadata.UID, metadata.CreationTimestamp, metadata.ManagedFields = "", "", metav1.Time{}, nil
+	ret := encryptedSecretManifest{APIVersion: "v1", Kind: "Secret", Metadata: metadata, Type: secret.Type, Data: map[string]string{}}
+
+	values := map[string][]byte{}
+	for name, value := range secret.Data {
+		values[name] = value
+	}
+	for name, value := range secret.StringData {
+		values[name] = []byte(value)
+	}
+	for name, value := range values {
+		nonce := make([]byte, aead.NonceSize())
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return nil, err
+		}
+		sealed := aead.Seal(nonce, nonce, value, secretValueBinding(&metadata, name))
+		ret.Data[name] = fmt.Sprintf("ENC[AES256_GCM,key:%s,data:%s]", key.ID, base64.StdEncoding.EncodeToString(sealed))
+	}
+	return yaml.Marshal(ret)
+}
+
+// DecryptSecretManifest decrypts an encrypted manifest with whichever of keys it was encrypted with.
+func DecryptSecretManifest(manifest []byte, keys ...*SecretKey) (*corev1.Secret, error) {
+	encrypted := encryptedSecretManifest{}
+	err := yaml.UnmarshalStrict(manifest, &encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("parsing encrypted secret manifest: %w", err)
+	}
+	if encrypted.Kind != "Secret" {
+		return nil, fmt.Errorf("expected a Secret manifest, got kind %q", encrypted.Kind)
+	}
+	keysByID := map[string]*SecretKey{}
+	for _, key := range keys {
+		keysByID[key.ID] = key
+	}
+
+	ret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: encrypted.Metadata,
+		Type:       encrypted.Type,
+		Data:       map[string][]byte{},
+	}
+	for name, value := range encrypted.Data {
+		match := encryptedValuePattern.FindStringSubmatch(value)
+		if match == nil {
+			return nil, fmt.Errorf("secret %s: value of %s is not encrypted", encrypted.Metadata.Name, name)
+		}
+		key, ok := keysByID[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("secret %s: value of %s is encrypted with key %s, which was not given", encrypted.Metadata.Name, name, match[1])
+		}
+		sealed, err := base64.StdEncoding.DecodeString(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: value of %s: %w", encrypted.Metadata.Name, name, err)
+		}
+		aead, err := key.aead()
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, fmt.Errorf("secret %s: value of %s is truncated", encrypted.Metadata.Name, name)
+		}
+		plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], secretValueBinding(&encrypted.Metadata, name))
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: value of %s does not decrypt, it was altered or moved", encrypted.Metadata.Name, name)
+		}
+		ret.Data[name] = plain
+	}
+	return ret, nil
+}
+
+// ReencryptSecretManifest decrypts the manifest with oldKeys and encrypts it with newKey, for
+// key rotation. Every value gets a fresh nonce.
+func ReencryptSecretManifest(manifest []byte, newKey *SecretKey, oldKeys ...*SecretKey) ([]byte, error) {
+	secret, err := DecryptSecretManifest(manifest, oldKeys...)
+	if err != nil {
+		return nil, err
+	}
+	return encryptSecret(secret, newKey)
+}
+
+// RotateSecretFiles re-encrypts the manifest files in place with newKey. Every file is decrypted
+// before any is written, so a missing old key leaves all files untouched.
+func RotateSecretFiles(paths []string, newKey *SecretKey, oldKeys ...*SecretKey) error {
+	rotated := map[string][]byte{}
+	for _, path := range paths {
+		manifest, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rotated[path], err = ReencryptSecretManifest(manifest, newKey, oldKeys...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, path := range paths {
+		err := writeFileAtomic(path, rotated[path])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path through a temporary file, so a crash never leaves it half written.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	temporary := path + ".tmp"
+	err := os.WriteFile(temporary, data, mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
+
+// ApplyEncryptedSecret decrypts the manifest file and applies the secret to the active namespace.
+// A manifest naming another namespace is rejected.
+func (kapi *KubAPI) ApplyEncryptedSecret(ctx context.Context, path string, keys ...*SecretKey) (*corev1.Secret, error) {
+	namespace, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := DecryptSecretManifest(manifest, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if secret.Namespace != "" && secret.Namespace != *namespace {
+		return nil, fmt.Errorf("%s: secret %s belongs to namespace %s, not %s", path, secret.Name, secret.Namespace, *namespace)
+	}
+	secret.Namespace = *namespace
+	return kapi.ApplySecret(ctx, secret)
+}
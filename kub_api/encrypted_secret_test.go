@@ -0,0 +1,129 @@
+package kub_api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testPlainSecretManifest = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app-credentials
+  namespace: test
+type: Opaque
+data:
+  password: aHVudGVyMg==
+stringData:
+  username: admin
+`
+
+func TestEncryptSecretManifest(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		dir := t.TempDir()
+		key, err := GenerateSecretKey(filepath.Join(dir, "key"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = GenerateSecretKey(filepath.Join(dir, "key"))
+		if err == nil {
+			t.Errorf("expected an existing key file not to be overwritten")
+		}
+		loaded, err := LoadSecretKey(filepath.Join(dir, "key"))
+		if err != nil || loaded.ID != key.ID {
+			t.Fatalf("unexpected key %+v: %v", loaded, err)
+		}
+
+		encrypted, err := EncryptSecretManifest([]byte(testPlainSecretManifest), key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if strings.Contains(string(encrypted), "aHVudGVyMg") || strings.Contains(string(encrypted), "admin") ||
+			!strings.Contains(string(encrypted), "name: app-credentials") || !strings.Contains(string(encrypted), "ENC[AES256_GCM,key:"+key.ID) {
+			t.Fatalf("unexpected encrypted manifest %s", encrypted)
+		}
+
+		secret, err := DecryptSecretManifest(encrypted, key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if string(secret.Data["password"]) != "hunter2" || string(secret.Data["username"]) != "admin" || secret.Namespace != "test" {
+			t.Errorf("unexpected secret %+v", secret)
+		}
+
+		moved := strings.Replace(string(encrypted), "name: app-credentials", "name: other", 1)
+		_, err = DecryptSecretManifest([]byte(moved), key)
+		if err == nil || !strings.Contains(err.Error(), "altered or moved") {
+			t.Errorf("expected a moved secret to fail, got %v", err)
+		}
+
+		otherKey, err := GenerateSecretKey(filepath.Join(dir, "other"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = DecryptSecretManifest(encrypted, otherKey)
+		if err == nil || !strings.Contains(err.Error(), "which was not given") {
+			t.Errorf("expected a missing key error, got %v", err)
+		}
+	})
+}
+
+func TestRotateSecretFiles(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		dir := t.TempDir()
+		oldKey, _ := GenerateSecretKey(filepath.Join(dir, "old"))
+		newKey, _ := GenerateSecretKey(filepath.Join(dir, "new"))
+		encrypted, err := EncryptSecretManifest([]byte(testPlainSecretManifest), oldKey)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		path := filepath.Join(dir, "secret.enc.yaml")
+		os.WriteFile(path, encrypted, 0o640)
+		broken := filepath.Join(dir, "broken.enc.yaml")
+		os.WriteFile(broken, []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: broken\ndata:\n  a: plain\n"), 0o640)
+
+		err = RotateSecretFiles([]string{path, broken}, newKey, oldKey)
+		if err == nil {
+			t.Fatalf("expected the unencrypted file to fail the rotation")
+		}
+		unchanged, _ := os.ReadFile(path)
+		if string(unchanged) != string(encrypted) {
+			t.Errorf("expected no file to be written on failure")
+		}
+
+		err = RotateSecretFiles([]string{path}, newKey, oldKey)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		rotated, _ := os.ReadFile(path)
+		if !strings.Contains(string(rotated), "key:"+newKey.ID) || strings.Contains(string(rotated), "key:"+oldKey.ID) {
+			t.Errorf("unexpected rotated manifest %s", rotated)
+		}
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+			t.Errorf("expected the file mode to be kept, got %v", info.Mode())
+		}
+
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+		_, err = api.ApplyEncryptedSecret(context.Background(), path, oldKey)
+		if err == nil {
+			t.Errorf("expected the old key to be rejected after rotation")
+		}
+		secret, err := api.ApplyEncryptedSecret(context.Background(), path, newKey)
+		if err != nil || string(secret.Data["password"]) != "hunter2" {
+			t.Fatalf("unexpected secret %+v: %v", secret, err)
+		}
+
+		otherNamespace := "prod"
+		api.Namespace = &otherNamespace
+		_, err = api.ApplyEncryptedSecret(context.Background(), path, newKey)
+		if err == nil || !strings.Contains(err.Error(), "belongs to namespace test") {
+			t.Errorf("expected a namespace mismatch, got %v", err)
+		}
+	})
+}
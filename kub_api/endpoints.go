@@ -0,0 +1,209 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type ServiceEndpoint struct {
+	// Pod is empty for endpoints that are not backed by a pod, e.g. of selectorless services.
+	Pod         string   `json:"pod,omitempty"`
+	Node        string   `json:"node,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	Addresses   []string `json:"addresses"`
+	Ready       bool     `json:"ready"`
+	Serving     bool     `json:"serving"`
+	Terminating bool     `json:"terminating"`
+}
+
+type ServiceEndpointPort struct {
+	Name     string          `json:"name,omitempty"`
+	Port     int32           `json:"port"`
+	Protocol corev1.Protocol `json:"protocol"`
+}
+
+type ServiceEndpoints struct {
+	Service   string                `json:"service"`
+	Ports     []ServiceEndpointPort `json:"ports"`
+	Endpoints []ServiceEndpoint     `json:"endpoints"`
+	Ready     int                   `json:"ready"`
+	// SelectorMatchesNoPods flags a service with a selector that no pod carries, usually a typo
+	// in the selector or labels.
+	SelectorMatchesNoPods bool `json:"selectorMatchesNoPods,omitempty"`
+}
+
+// GetServiceEndpoints reports the endpoints of the service from its EndpointSlices.
+func (kapi *KubAPI) GetServiceEndpoints(ctx context.Context, name string) (*ServiceEndpoints, error) {
+	ret, _, err := kapi.getServiceEndpoints(ctx, name)
+	return ret, err
+}
+
+// getServiceEndpoints also returns the resource version of the EndpointSlice list to watch from.
+func (kapi *KubAPI) getServiceEndpoints(ctx context.Context, name string) (*ServiceEndpoints, string, error) {
+	service, err := kapi.GetService(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	op := kapi.startOperation(ctx, "list", "EndpointSlice", "")
+	sliceList, err := kapi.clientset.DiscoveryV1().EndpointSlices(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: discoveryv1.LabelServiceName + "=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, "", err
+	}
+	ret := AggregateEndpointSlices(name, sliceList.Items)
+
+	if len(service.Spec.Selector) > 0 {
+		op = kapi.startOperation(ctx, "list", "Pod", "")
+		pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String()})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, "", err
+		}
+		ret.SelectorMatchesNoPods = len(pods.Items) == 0
+	}
+	return ret, sliceList.ResourceVersion, nil
+}
+
+// AggregateEndpointSlices merges the slices of a service. Endpoints listed in several slices,
+// e.g. during slice rebalancing or in the IPv4 and IPv6 slices of a dual-stack service, are
+// reported once with the addresses of all slices.
+func AggregateEndpointSlices(serviceName string, endpointSlices []discoveryv1.EndpointSlice) *ServiceEndpoints {
+	ret := ServiceEndpoints{Service: serviceName, Ports: []ServiceEndpointPort{}, Endpoints: []ServiceEndpoint{}}
+	seenPorts := map[ServiceEndpointPort]bool{}
+	seenEndpoints := map[string]int{}
+
+	for _, slice := range endpointSlices {
+		for _, port := range slice.Ports {
+			endpointPort := ServiceEndpointPort{Protocol: corev1.ProtocolTCP}
+			if port.Name != nil {
+				endpointPort.Name = *port.Name
+			}
+			if port.Port != nil {
+				endpointPort.Port = *port.Port
+			}
+			if port.Protocol != nil {
+				endpointPort.Protocol = *port.Protocol
+			}
+			if !seenPorts[endpointPort] {
+				seenPorts[endpointPort] = true
+				ret.Ports = append(ret.Ports, endpointPort)
+			}
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			serviceEndpoint := ServiceEndpoint{Addresses: append([]string{}, endpoint.Addresses...)}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				serviceEndpoint.Pod = endpoint.TargetRef.Name
+			}
+			if endpoint.NodeName != nil {
+				serviceEndpoint.Node = *endpoint.NodeName
+			}
+			if endpoint.Zone != nil {
+				serviceEndpoint.Zone = *endpoint.Zone
+			}
+			// Unset conditions are interpreted as the API documents: ready unless stated
+			// otherwise, serving when ready, not terminating.
+			serviceEndpoint.Ready = endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			serviceEndpoint.Serving = serviceEndpoint.Ready
+			if endpoint.Conditions.Serving != nil {
+				serviceEndpoint.Serving = *endpoint.Conditions.Serving
+			}
+			serviceEndpoint.Terminating = endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+
+			index, seen := seenEndpoints[endpointKey(&endpoint)]
+			if !seen {
+				seenEndpoints[endpointKey(&endpoint)] = len(ret.Endpoints)
+				ret.Endpoints = append(ret.Endpoints, serviceEndpoint)
+				continue
+			}
+			existing := &ret.Endpoints[index]
+			for _, address := range serviceEndpoint.Addresses {
+				if !slices.Contains(existing.Addresses, address) {
+					existing.Addresses = append(existing.Addresses, address)
+				}
+			}
+		}
+	}
+	for _, endpoint := range ret.Endpoints {
+		if endpoint.Ready {
+			ret.Ready++
+		}
+	}
+
+	sort.Slice(ret.Endpoints, func(i, j int) bool {
+		if ret.Endpoints[i].Pod != ret.Endpoints[j].Pod {
+			return ret.Endpoints[i].Pod < ret.Endpoints[j].Pod
+		}
+		return fmt.Sprint(ret.Endpoints[i].Addresses) < fmt.Sprint(ret.Endpoints[j].Addresses)
+	})
+	sort.Slice(ret.Ports, func(i, j int) bool {
+		if ret.Ports[i].Port != ret.Ports[j].Port {
+			return ret.Ports[i].Port < ret.Ports[j].Port
+		}
+		return ret.Ports[i].Protocol < ret.Ports[j].Protocol
+	})
+	return &ret
+}
+
+// endpointKey identifies the object behind an endpoint, or the endpoint by its addresses when it
+// has no target.
+func endpointKey(endpoint *discoveryv1.Endpoint) string {
+	if target := endpoint.TargetRef; target != nil {
+		return strings.Join([]string{target.Kind, target.Namespace, target.Name, string(target.UID)}, "/")
+	}
+	return fmt.Sprint(endpoint.Addresses)
+}
+
+// WaitForServiceReady blocks until the service has at least minReady ready endpoints.
+// It watches the EndpointSlices of the service and reconnects when the watch closes.
+func (kapi *KubAPI) WaitForServiceReady(ctx context.Context, name string, minReady int) (*ServiceEndpoints, error) {
+	if minReady < 1 {
+		minReady = 1
+	}
+	for {
+		endpoints, resourceVersion, err := kapi.getServiceEndpoints(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if endpoints.Ready >= minReady {
+			return endpoints, nil
+		}
+		if endpoints.SelectorMatchesNoPods {
+			kapi.log().Warn("service selector matches no pods", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, name))
+		}
+
+		op := kapi.startOperation(ctx, "watch", "EndpointSlice", name)
+		watcher, err := kapi.clientset.DiscoveryV1().EndpointSlices(*kapi.Namespace).Watch(op.ctx, metav1.ListOptions{
+			LabelSelector:   discoveryv1.LabelServiceName + "=" + name,
+			ResourceVersion: resourceVersion,
+		})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+
+		closed := false
+		select {
+		case <-ctx.Done():
+			watcher.Stop()
+			return endpoints, ctx.Err()
+		case _, ok := <-watcher.ResultChan():
+			// Any change of a slice is re-evaluated from a fresh list.
+			closed = !ok
+		}
+		watcher.Stop()
+		if closed {
+			kapi.observeWatchReconnect("EndpointSlice")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package kub_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testEndpointSlice(name string, ready ...bool) *discoveryv1.EndpointSlice {
+	portName := "http"
+	port := int32(8080)
+	slice := discoveryv1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: name, Namespace: "test", Labels: map[string]string{discoveryv1.LabelServiceName: "test"}},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+	for index, isReady := range ready {
+		podName := name + "-" + string(rune('a'+index))
+		terminating := !isReady
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0." + string(rune('1'+index))},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: podName},
+			Conditions: discoveryv1.EndpointConditions{Ready: &isReady, Terminating: &terminating},
+		})
+	}
+	return &slice
+}
+
+func TestGetServiceEndpoints(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "test"}},
+		}
+		// The second slice repeats an endpoint of the first one, as during rebalancing.
+		duplicate := testEndpointSlice("slice-a", true)
+		duplicate.Name = "slice-b"
+		clientset := fake.NewSimpleClientset(service, testEndpointSlice("slice-a", true, false), duplicate)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		endpoints, err := api.GetServiceEndpoints(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(endpoints.Endpoints) != 2 || endpoints.Ready != 1 || len(endpoints.Ports) != 1 || endpoints.Ports[0].Protocol != corev1.ProtocolTCP {
+			t.Fatalf("unexpected endpoints %+v", endpoints)
+		}
+		if endpoints.Endpoints[1].Pod != "slice-a-b" || !endpoints.Endpoints[1].Terminating || endpoints.Endpoints[1].Serving {
+			t.Errorf("unexpected endpoint %+v", endpoints.Endpoints[1])
+		}
+		if !endpoints.SelectorMatchesNoPods {
+			t.Errorf("expected selector without pods to be flagged")
+		}
+	})
+}
+
+func TestAggregateEndpointSlicesDualStack(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		ipv4 := testEndpointSlice("slice-a", true, false)
+		ipv6 := testEndpointSlice("slice-a", true, false)
+		ipv6.Name, ipv6.AddressType = "slice-b", discoveryv1.AddressTypeIPv6
+		for index := range ipv6.Endpoints {
+			ipv6.Endpoints[index].Addresses = []string{"fd00::" + string(rune('1'+index))}
+		}
+		// Endpoints without a target are told apart by their addresses.
+		external := discoveryv1.Endpoint{Addresses: []string{"192.0.2.1"}}
+		ipv4.Endpoints = append(ipv4.Endpoints, external, external)
+
+		endpoints := AggregateEndpointSlices("test", []discoveryv1.EndpointSlice{*ipv4, *ipv6})
+		if len(endpoints.Endpoints) != 3 || endpoints.Ready != 2 {
+			t.Fatalf("unexpected endpoints %+v", endpoints)
+		}
+		if strings.Join(endpoints.Endpoints[1].Addresses, ",") != "10.0.0.1,fd00::1" {
+			t.Errorf("expected the addresses of both families, got %v", endpoints.Endpoints[1].Addresses)
+		}
+	})
+}
+
+func TestWaitForServiceReady(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace}}
+		clientset := fake.NewSimpleClientset(service, testEndpointSlice("slice-a", true, false))
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done := make(chan *ServiceEndpoints)
+		go func() {
+			endpoints, err := api.WaitForServiceReady(ctx, "test", 2)
+			if err != nil {
+				t.Errorf("%v", err)
+			}
+			done <- endpoints
+		}()
+
+		// The fake watch misses updates made before it started, so keep updating until the wait returns.
+		for {
+			_, err := clientset.DiscoveryV1().EndpointSlices(namespace).Update(context.Background(), testEndpointSlice("slice-a", true, true), metav1.UpdateOptions{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			select {
+			case endpoints := <-done:
+				if endpoints == nil || endpoints.Ready != 2 {
+					t.Errorf("unexpected endpoints %+v", endpoints)
+				}
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	})
+}
@@ -0,0 +1,322 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// EventRecord is an event of core/v1 or events.k8s.io/v1 in a common shape.
+type EventRecord struct {
+	UID     types.UID `json:"uid"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Source  string    `json:"source,omitempty"`
+	Count   int32     `json:"count,omitempty"`
+}
+
+// GetEvents returns the events of obj, oldest first. Kind and Name are required, the UID
+// narrows the match to one incarnation of the object and Namespace defaults to the active one.
+// Both event APIs are read since controllers may write to either of them.
+func (kapi *KubAPI) GetEvents(ctx context.Context, obj corev1.ObjectReference) ([]EventRecord, error) {
+	if obj.Kind == "" || obj.Name == "" {
+		return nil, fmt.Errorf("event object kind and name are required")
+	}
+	match := func(record *EventRecord, uid types.UID) bool {
+		return record.Kind == obj.Kind && record.Name == obj.Name && (obj.UID == "" || obj.UID == uid)
+	}
+
+	coreSelector := fields.Set{"involvedObject.kind": obj.Kind, "involvedObject.name": obj.Name}
+	eventsSelector := fields.Set{"regarding.kind": obj.Kind, "regarding.name": obj.Name}
+	if obj.UID != "" {
+		coreSelector["involvedObject.uid"] = string(obj.UID)
+		eventsSelector["regarding.uid"] = string(obj.UID)
+	}
+	return kapi.listEvents(ctx, objectNamespace(kapi, obj), coreSelector.String(), eventsSelector.String(), match)
+}
+
+func objectNamespace(kapi *KubAPI, obj corev1.ObjectReference) string {
+	if obj.Namespace != "" {
+		return obj.Namespace
+	}
+	return *kapi.Namespace
+}
+
+// listEvents merges both event APIs, deduplicated by UID. Events are filtered with match as well
+// since not every client honours the field selectors.
+func (kapi *KubAPI) listEvents(ctx context.Context, namespace, coreSelector, eventsSelector string, match func(*EventRecord, types.UID) bool) ([]EventRecord, error) {
+	records := map[types.UID]EventRecord{}
+
+	op := kapi.startOperation(ctx, "list", "Event", "")
+	op.namespace = namespace
+	coreEvents, err := kapi.clientset.CoreV1().Events(namespace).List(op.ctx, metav1.ListOptions{FieldSelector: coreSelector})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	for index := range coreEvents.Items {
+		record := EventRecordFromCore(&coreEvents.Items[index])
+		if match(&record, coreEvents.Items[index].InvolvedObject.UID) {
+			records[record.UID] = record
+		}
+	}
+
+	op = kapi.startOperation(ctx, "list", "Event", "")
+	op.namespace = namespace
+	events, err := kapi.clientset.EventsV1().Events(namespace).List(op.ctx, metav1.ListOptions{FieldSelector: eventsSelector})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	for index := range events.Items {
+		record := EventRecordFromEvents(&events.Items[index])
+		if _, ok := records[record.UID]; ok {
+			continue
+		}
+		if match(&record, events.Items[index].Regarding.UID) {
+			records[record.UID] = record
+		}
+	}
+
+	ret := []EventRecord{}
+	for _, record := range records {
+		ret = append(ret, record)
+	}
+	SortEvents(ret)
+	return ret, nil
+}
+
+// SortEvents orders events by time, then by object and reason for a stable timeline.
+func SortEvents(events []EventRecord) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		if events[i].Kind+"/"+events[i].Name != events[j].Kind+"/"+events[j].Name {
+			return events[i].Kind+"/"+events[i].Name < events[j].Kind+"/"+events[j].Name
+		}
+		return events[i].Reason < events[j].Reason
+	})
+}
+
+func EventRecordFromCore(event *corev1.Event) EventRecord {
+	ret := EventRecord{
+		UID:     event.UID,
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Kind:    event.InvolvedObject.Kind,
+		Name:    event.InvolvedObject.Name,
+		Source:  event.Source.Component,
+		Count:   event.Count,
+	}
+	if ret.Source == "" {
+		ret.Source = event.ReportingController
+	}
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		ret.Time = event.Series.LastObservedTime.Time
+		ret.Count = event.Series.Count
+	case !event.LastTimestamp.IsZero():
+		ret.Time = event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		ret.Time = event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		ret.Time = event.FirstTimestamp.Time
+	default:
+		ret.Time = event.CreationTimestamp.Time
+	}
+	return ret
+}
+
+func EventRecordFromEvents(event *eventsv1.Event) EventRecord {
+	ret := EventRecord{
+		UID:     event.UID,
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Note,
+		Kind:    event.Regarding.Kind,
+		Name:    event.Regarding.Name,
+		Source:  event.ReportingController,
+		Count:   event.DeprecatedCount,
+	}
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		ret.Time = event.Series.LastObservedTime.Time
+		ret.Count = event.Series.Count
+	case !event.EventTime.IsZero():
+		ret.Time = event.EventTime.Time
+	case !event.DeprecatedLastTimestamp.IsZero():
+		ret.Time = event.DeprecatedLastTimestamp.Time
+	default:
+		ret.Time = event.CreationTimestamp.Time
+	}
+	return ret
+}
+
+const (
+	eventWatchMinBackoff = 500 * time.Millisecond
+	eventWatchMaxBackoff = 30 * time.Second
+)
+
+// WatchEvents calls handler for every existing event of obj, oldest first, and then for every event
+// that is added or updated until ctx is cancelled.
+// The watch reconnects when the server closes it, backing off while it keeps failing, and starts
+// from a fresh list once its resource version expired.
+func (kapi *KubAPI) WatchEvents(ctx context.Context, obj corev1.ObjectReference, handler func(EventRecord)) error {
+	if obj.Kind == "" || obj.Name == "" {
+		return fmt.Errorf("event object kind and name are required")
+	}
+	namespace := objectNamespace(kapi, obj)
+	selector := fields.Set{"involvedObject.kind": obj.Kind, "involvedObject.name": obj.Name}
+	if obj.UID != "" {
+		selector["involvedObject.uid"] = string(obj.UID)
+	}
+	listOptions := metav1.ListOptions{FieldSelector: selector.String()}
+	backoff := eventWatchMinBackoff
+
+	// Existing events come from one list, the watch starts after it so reconnects do not replay them.
+	op := kapi.startOperation(ctx, "list", "Event", obj.Name)
+	op.namespace = namespace
+	events, err := kapi.clientset.CoreV1().Events(namespace).List(op.ctx, listOptions)
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return err
+	}
+	existing := []EventRecord{}
+	for i := range events.Items {
+		if eventInvolves(&events.Items[i], obj) {
+			existing = append(existing, EventRecordFromCore(&events.Items[i]))
+		}
+	}
+	SortEvents(existing)
+	for _, record := range existing {
+		handler(record)
+	}
+	listOptions.ResourceVersion = events.ResourceVersion
+
+	for {
+		op := kapi.startOperation(ctx, "watch", "Event", obj.Name)
+		op.namespace = namespace
+		watcher, err := kapi.clientset.CoreV1().Events(namespace).Watch(op.ctx, listOptions)
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return err
+		}
+
+		received, watchErr := kapi.handleEventWatch(ctx, watcher, obj, &listOptions, handler)
+		watcher.Stop()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if apierrors.IsResourceExpired(watchErr) || apierrors.IsGone(watchErr) {
+			// Events between the expired version and the list are not delivered.
+			op := kapi.startOperation(ctx, "list", "Event", "")
+			op.namespace = namespace
+			events, err := kapi.clientset.CoreV1().Events(namespace).List(op.ctx, metav1.ListOptions{FieldSelector: listOptions.FieldSelector, Limit: 1})
+			kapi.finishOperation(op, err)
+			listOptions.ResourceVersion = ""
+			if err == nil {
+				listOptions.ResourceVersion = events.ResourceVersion
+			}
+		}
+		if received {
+			backoff = eventWatchMinBackoff
+		}
+		kapi.log().Debug("event watch closed, reconnecting", slog.String(LogFieldNamespace, namespace), slog.String(LogFieldName, obj.Name), slog.Any(LogFieldError, watchErr))
+		kapi.observeWatchReconnect("Event")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, eventWatchMaxBackoff)
+	}
+}
+
+// handleEventWatch passes matching events to handler until the watch closes, fails or ctx is
+// cancelled. It reports whether any event was received and the error the watch ended with.
+func (kapi *KubAPI) handleEventWatch(ctx context.Context, watcher watch.Interface, obj corev1.ObjectReference, listOptions *metav1.ListOptions, handler func(EventRecord)) (bool, error) {
+	received := false
+	for {
+		var watchEvent watch.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case watchEvent, ok = <-watcher.ResultChan():
+			if !ok {
+				return received, nil
+			}
+		}
+		if watchEvent.Type == watch.Error {
+			return received, apierrors.FromObject(watchEvent.Object)
+		}
+		received = true
+		if watchEvent.Type != watch.Added && watchEvent.Type != watch.Modified {
+			continue
+		}
+		event, ok := watchEvent.Object.(*corev1.Event)
+		if !ok {
+			continue
+		}
+		listOptions.ResourceVersion = event.ResourceVersion
+		if !eventInvolves(event, obj) {
+			continue
+		}
+		handler(EventRecordFromCore(event))
+	}
+}
+
+func eventInvolves(event *corev1.Event, obj corev1.ObjectReference) bool {
+	involved := event.InvolvedObject
+	return involved.Kind == obj.Kind && involved.Name == obj.Name && (obj.UID == "" || involved.UID == obj.UID)
+}
+
+// GetJobTimeline merges the events of the job and of all its pods, oldest first.
+func (kapi *KubAPI) GetJobTimeline(ctx context.Context, name string) ([]EventRecord, error) {
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	podNames := map[string]bool{}
+	for _, pod := range pods.Items {
+		podNames[pod.Name] = true
+	}
+
+	ret, err := kapi.GetEvents(ctx, corev1.ObjectReference{Kind: "Job", Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if len(podNames) > 0 {
+		// One list for all pods instead of a request per pod.
+		podEvents, err := kapi.listEvents(ctx, *kapi.Namespace,
+			fields.OneTermEqualSelector("involvedObject.kind", "Pod").String(),
+			fields.OneTermEqualSelector("regarding.kind", "Pod").String(),
+			func(record *EventRecord, _ types.UID) bool { return record.Kind == "Pod" && podNames[record.Name] })
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, podEvents...)
+	}
+	SortEvents(ret)
+	return ret, nil
+}
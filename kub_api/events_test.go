@@ -0,0 +1,196 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testCoreEvent(uid, kind, name, reason string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: uid, Namespace: "test", UID: types.UID(uid)},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: name, Namespace: "test"},
+		Reason:         reason,
+		Type:           corev1.EventTypeNormal,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func TestGetJobTimeline(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		clientset := fake.NewSimpleClientset(
+			testJobPod("test-a", "test", corev1.PodFailed),
+			testJobPod("test-b", "test", corev1.PodRunning),
+			testCoreEvent("1", "Job", "test", "SuccessfulCreate", start),
+			testCoreEvent("2", "Pod", "test-a", "Scheduled", start.Add(time.Second)),
+			testCoreEvent("3", "Pod", "test-b", "Pulled", start.Add(3*time.Second)),
+			testCoreEvent("4", "Pod", "other", "Scheduled", start.Add(time.Second)),
+			testCoreEvent("5", "Job", "other", "SuccessfulCreate", start),
+			// The same event as seen through events.k8s.io/v1 and one only written there.
+			&eventsv1.Event{
+				ObjectMeta: metav1.ObjectMeta{Name: "1", Namespace: namespace, UID: "1"},
+				Regarding:  corev1.ObjectReference{Kind: "Job", Name: "test"},
+				Reason:     "SuccessfulCreate",
+				EventTime:  metav1.NewMicroTime(start),
+			},
+			&eventsv1.Event{
+				ObjectMeta: metav1.ObjectMeta{Name: "6", Namespace: namespace, UID: "6"},
+				Regarding:  corev1.ObjectReference{Kind: "Pod", Name: "test-a"},
+				Reason:     "BackOff",
+				Note:       "Back-off restarting failed container",
+				Type:       corev1.EventTypeWarning,
+				EventTime:  metav1.NewMicroTime(start.Add(2 * time.Second)),
+			},
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		events, err := api.GetEvents(context.Background(), corev1.ObjectReference{Kind: "Job", Name: "test"})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(events) != 1 || events[0].Reason != "SuccessfulCreate" {
+			t.Errorf("unexpected job events %+v", events)
+		}
+
+		timeline, err := api.GetJobTimeline(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		got := []string{}
+		for _, event := range timeline {
+			got = append(got, fmt.Sprintf("%s/%s %s", event.Kind, event.Name, event.Reason))
+		}
+		expected := []string{"Job/test SuccessfulCreate", "Pod/test-a Scheduled", "Pod/test-a BackOff", "Pod/test-b Pulled"}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if timeline[2].Message != "Back-off restarting failed container" || timeline[2].Type != corev1.EventTypeWarning {
+			t.Errorf("unexpected event %+v", timeline[2])
+		}
+	})
+}
+
+func TestWatchEvents(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset()
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		received := make(chan EventRecord, 16)
+		done := make(chan error)
+		go func() {
+			done <- api.WatchEvents(ctx, corev1.ObjectReference{Kind: "Pod", Name: "test-a"}, func(record EventRecord) { received <- record })
+		}()
+
+		// The fake watch only sees events created after it started, so keep creating until one arrives.
+		var record EventRecord
+		for index := 0; record.Name == ""; index++ {
+			if index == 100 {
+				t.Fatalf("no event received")
+			}
+			_, err := clientset.CoreV1().Events(namespace).Create(context.Background(), testCoreEvent(fmt.Sprintf("other-%d", index), "Pod", "other", "Pulled", time.Now()), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			_, err = clientset.CoreV1().Events(namespace).Create(context.Background(), testCoreEvent(fmt.Sprintf("a-%d", index), "Pod", "test-a", "Pulled", time.Now()), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			select {
+			case record = <-received:
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		if record.Name != "test-a" || record.Reason != "Pulled" {
+			t.Errorf("unexpected event %+v", record)
+		}
+
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("watch did not stop")
+		}
+	})
+}
+
+func TestWatchEventsExpired(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset()
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The watch from the initial list delivers one event and then expires with 410 Gone, the
+		// watch from the second list is closed by the server without events.
+		resourceVersions := make(chan string, 16)
+		clientset.PrependWatchReactor("events", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			resourceVersion := action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion
+			resourceVersions <- resourceVersion
+			watcher := watch.NewFakeWithChanSize(2, false)
+			switch resourceVersion {
+			case "1":
+				event := testCoreEvent("b", "Pod", "test-a", "Started", time.Now())
+				event.ResourceVersion = "5"
+				watcher.Add(event)
+				watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+			case "42":
+				watcher.Stop()
+			}
+			return true, watcher, nil
+		})
+		lists := 0
+		clientset.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			lists++
+			if lists == 1 {
+				return true, &corev1.EventList{ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+					Items: []corev1.Event{*testCoreEvent("a", "Pod", "test-a", "Pulled", time.Now())}}, nil
+			}
+			return true, &corev1.EventList{ListMeta: metav1.ListMeta{ResourceVersion: "42"}}, nil
+		})
+
+		received := make(chan EventRecord, 16)
+		done := make(chan error)
+		go func() {
+			done <- api.WatchEvents(ctx, corev1.ObjectReference{Kind: "Pod", Name: "test-a"}, func(record EventRecord) { received <- record })
+		}()
+
+		for _, expected := range []string{"1", "42", "42"} {
+			select {
+			case resourceVersion := <-resourceVersions:
+				if resourceVersion != expected {
+					t.Errorf("expected watch from resource version %q, got %q", expected, resourceVersion)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("watch was not restarted")
+			}
+		}
+		if len(received) != 2 {
+			t.Errorf("expected the listed and the watched event, got %d", len(received))
+		}
+		if lists != 2 {
+			t.Errorf("expected a list only up front and after the expiry, got %d", lists)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("%v", err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// podExecutor runs command in a container and streams its standard streams, nil streams are not attached.
+// Tests replace it to run without a cluster.
+type podExecutor func(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error
+
+// Exec runs cmd in container of pod like kubectl exec, an empty container selects the default one.
+// With tty the output of the command arrives on stdout only. A non-zero exit status is returned
+// as an error implementing k8s.io/client-go/util/exec.ExitError.
+func (kapi *KubAPI) Exec(ctx context.Context, pod, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	if len(cmd) == 0 {
+		return fmt.Errorf("exec command is empty")
+	}
+	if tty {
+		stderr = nil
+	}
+	return kapi.exec(ctx, pod, container, cmd, stdin, stdout, stderr, tty)
+}
+
+// exec runs command in the container of pod in the active namespace.
+func (kapi *KubAPI) exec(ctx context.Context, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	executor := kapi.executor
+	if executor == nil {
+		executor = kapi.remoteExec
+	}
+	op := kapi.startOperation(ctx, "create", "Pod/exec", pod)
+	op.setDiff(map[string]any{"container": container, "command": command})
+	err := executor(op.ctx, *kapi.Namespace, pod, container, command, stdin, stdout, stderr, tty)
+	kapi.finishOperation(op, err)
+	return err
+}
+
+// remoteExec streams over WebSocket and falls back to SPDY for API servers without WebSocket exec.
+func (kapi *KubAPI) remoteExec(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	if kapi.restConfig == nil {
+		return fmt.Errorf("exec requires a KubAPI created with KubAPINew")
+	}
+	request := kapi.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(kapi.restConfig, "GET", request.URL().String())
+	if err != nil {
+		return err
+	}
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(kapi.restConfig, "POST", request.URL())
+	if err != nil {
+		return err
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdin: stdin, Stdout: stdout, Stderr: stderr, Tty: tty})
+}
+
+// execCapture runs command and returns its stdout, stderr is added to the error.
+func (kapi *KubAPI) execCapture(ctx context.Context, pod, container string, command []string) (string, error) {
+	stdout := strings.Builder{}
+	stderr := strings.Builder{}
+	err := kapi.exec(ctx, pod, container, command, nil, &stdout, &stderr, false)
+	if err != nil {
+		return stdout.String(), execError(err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+func execError(err error, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, stderr)
+}
@@ -0,0 +1,57 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+func TestExec(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		auditSink := MemoryAuditSink{}
+		api := KubAPI{Namespace: &namespace, Auditor: &Auditor{Sinks: []AuditSink{&auditSink}}}
+		api.executor = func(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+			if tty && stderr != nil {
+				t.Errorf("stderr must not be attached with tty")
+			}
+			input, err := io.ReadAll(stdin)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s/%s: %s %s", pod, container, strings.Join(command, " "), input)
+			if command[0] == "false" {
+				return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+			}
+			return nil
+		}
+
+		stdout := strings.Builder{}
+		stderr := strings.Builder{}
+		err := api.Exec(context.Background(), "test-0", "test", []string{"cat", "-"}, strings.NewReader("hello"), &stdout, &stderr, true)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if stdout.String() != "test-0/test: cat - hello" {
+			t.Errorf("unexpected output %q", stdout.String())
+		}
+
+		err = api.Exec(context.Background(), "test-0", "test", []string{"false"}, strings.NewReader(""), io.Discard, io.Discard, false)
+		exitErr, ok := err.(utilexec.ExitError)
+		if !ok || exitErr.ExitStatus() != 1 {
+			t.Errorf("expected exit status 1, got %v", err)
+		}
+		if len(auditSink.Records()) != 2 {
+			t.Errorf("expected exec calls to be audited, got %d records", len(auditSink.Records()))
+		}
+
+		err = api.Exec(context.Background(), "test-0", "test", nil, nil, io.Discard, io.Discard, false)
+		if err == nil {
+			t.Errorf("expected error for empty command")
+		}
+	})
+}
@@ -0,0 +1,498 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// Gateway API resources are CRDs and are served by the dynamic client.
+const GatewayAPIGroupVersion = "gateway.networking.k8s.io/v1"
+
+var (
+	GatewayClassResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gatewayclasses"}
+	GatewayResource      = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	HTTPRouteResource    = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+)
+
+type GatewayClassInfo struct {
+	Name       string `json:"name"`
+	Controller string `json:"controller"`
+	Accepted   bool   `json:"accepted"`
+}
+
+type GatewayListener struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname,omitempty"`
+	Port     int64  `json:"port"`
+	Protocol string `json:"protocol"`
+	// TLSSecrets are the certificate references of HTTPS and TLS listeners.
+	TLSSecrets []string `json:"tlsSecrets,omitempty"`
+}
+
+type GatewayInfo struct {
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	Class      string            `json:"class"`
+	Listeners  []GatewayListener `json:"listeners"`
+	Addresses  []string          `json:"addresses,omitempty"`
+	Programmed bool              `json:"programmed"`
+}
+
+type HTTPRouteMatch struct {
+	// PathType is Exact, PathPrefix or RegularExpression.
+	PathType string `json:"pathType"`
+	Path     string `json:"path"`
+}
+
+type HTTPRouteBackend struct {
+	Service string `json:"service"`
+	Port    int64  `json:"port,omitempty"`
+	Weight  *int64 `json:"weight,omitempty"`
+}
+
+type HTTPRouteRule struct {
+	Matches  []HTTPRouteMatch   `json:"matches"`
+	Backends []HTTPRouteBackend `json:"backends"`
+}
+
+type HTTPRouteInfo struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Parents are the gateways the route attaches to as "namespace/name".
+	Parents   []string        `json:"parents"`
+	Hostnames []string        `json:"hostnames,omitempty"`
+	Rules     []HTTPRouteRule `json:"rules"`
+	Accepted  bool            `json:"accepted"`
+}
+
+// HTTPRouteParent is the gateway a converted route attaches to. SectionName optionally picks
+// a listener and Namespace defaults to the namespace of the route.
+type HTTPRouteParent struct {
+	Namespace   string
+	Name        string
+	SectionName string
+}
+
+// IsGatewayAPIMissing reports whether err is caused by the Gateway API CRDs not being installed.
+func IsGatewayAPIMissing(err error) bool {
+	return apierrors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
+
+func (kapi *KubAPI) listGatewayResources(ctx context.Context, resource schema.GroupVersionResource, kind, namespace string) ([]unstructured.Unstructured, error) {
+	if kapi.dynamicClient == nil {
+		return nil, fmt.Errorf("dynamic client is not configured")
+	}
+	op := kapi.startOperation(ctx, "list", kind, "")
+	op.namespace = namespace
+	var list *unstructured.UnstructuredList
+	var err error
+	if resource == GatewayClassResource {
+		list, err = kapi.dynamicClient.Resource(resource).List(op.ctx, metav1.ListOptions{})
+	} else {
+		list, err = kapi.dynamicClient.Resource(resource).Namespace(namespace).List(op.ctx, metav1.ListOptions{})
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		if list.Items[i].GetNamespace() != list.Items[j].GetNamespace() {
+			return list.Items[i].GetNamespace() < list.Items[j].GetNamespace()
+		}
+		return list.Items[i].GetName() < list.Items[j].GetName()
+	})
+	return list.Items, nil
+}
+
+func (kapi *KubAPI) GetGatewayClasses(ctx context.Context) ([]GatewayClassInfo, error) {
+	items, err := kapi.listGatewayResources(ctx, GatewayClassResource, "GatewayClass", "")
+	if err != nil {
+		return nil, err
+	}
+	ret := []GatewayClassInfo{}
+	for index := range items {
+		ret = append(ret, GatewayClassInfoFromUnstructured(&items[index]))
+	}
+	return ret, nil
+}
+
+// GetGateways lists the gateways of namespace, all namespaces when it is empty.
+func (kapi *KubAPI) GetGateways(ctx context.Context, namespace string) ([]GatewayInfo, error) {
+	items, err := kapi.listGatewayResources(ctx, GatewayResource, "Gateway", namespace)
+	if err != nil {
+		return nil, err
+	}
+	ret := []GatewayInfo{}
+	for index := range items {
+		ret = append(ret, GatewayInfoFromUnstructured(&items[index]))
+	}
+	return ret, nil
+}
+
+// GetHTTPRoutes lists the HTTP routes of namespace, all namespaces when it is empty.
+func (kapi *KubAPI) GetHTTPRoutes(ctx context.Context, namespace string) ([]HTTPRouteInfo, error) {
+	items, err := kapi.listGatewayResources(ctx, HTTPRouteResource, "HTTPRoute", namespace)
+	if err != nil {
+		return nil, err
+	}
+	ret := []HTTPRouteInfo{}
+	for index := range items {
+		ret = append(ret, HTTPRouteInfoFromUnstructured(&items[index]))
+	}
+	return ret, nil
+}
+
+func GatewayClassInfoFromUnstructured(obj *unstructured.Unstructured) GatewayClassInfo {
+	controller, _, _ := unstructured.NestedString(obj.Object, "spec", "controllerName")
+	return GatewayClassInfo{Name: obj.GetName(), Controller: controller, Accepted: conditionIsTrue(obj.Object, "Accepted", "status", "conditions")}
+}
+
+func GatewayInfoFromUnstructured(obj *unstructured.Unstructured) GatewayInfo {
+	ret := GatewayInfo{Namespace: obj.GetNamespace(), Name: obj.GetName(), Listeners: []GatewayListener{}}
+	ret.Class, _, _ = unstructured.NestedString(obj.Object, "spec", "gatewayClassName")
+	ret.Programmed = conditionIsTrue(obj.Object, "Programmed", "status", "conditions")
+
+	listeners, _, _ := unstructured.NestedSlice(obj.Object, "spec", "listeners")
+	for _, item := range listeners {
+		listener, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		gatewayListener := GatewayListener{}
+		gatewayListener.Name, _, _ = unstructured.NestedString(listener, "name")
+		gatewayListener.Hostname, _, _ = unstructured.NestedString(listener, "hostname")
+		gatewayListener.Port, _, _ = unstructured.NestedInt64(listener, "port")
+		gatewayListener.Protocol, _, _ = unstructured.NestedString(listener, "protocol")
+		certificates, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		for _, certificate := range certificates {
+			if reference, ok := certificate.(map[string]any); ok {
+				gatewayListener.TLSSecrets = append(gatewayListener.TLSSecrets, namespacedReference(reference, ret.Namespace))
+			}
+		}
+		ret.Listeners = append(ret.Listeners, gatewayListener)
+	}
+
+	addresses, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+	for _, item := range addresses {
+		if address, ok := item.(map[string]any); ok {
+			value, _, _ := unstructured.NestedString(address, "value")
+			ret.Addresses = append(ret.Addresses, value)
+		}
+	}
+	return ret
+}
+
+func HTTPRouteInfoFromUnstructured(obj *unstructured.Unstructured) HTTPRouteInfo {
+	ret := HTTPRouteInfo{Namespace: obj.GetNamespace(), Name: obj.GetName(), Parents: []string{}, Rules: []HTTPRouteRule{}}
+	ret.Hostnames, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+
+	parents, _, _ := unstructured.NestedSlice(obj.Object, "spec", "parentRefs")
+	for _, item := range parents {
+		if reference, ok := item.(map[string]any); ok {
+			ret.Parents = append(ret.Parents, namespacedReference(reference, ret.Namespace))
+		}
+	}
+
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	for _, item := range rules {
+		rule, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		routeRule := HTTPRouteRule{Matches: []HTTPRouteMatch{}, Backends: []HTTPRouteBackend{}}
+		matches, _, _ := unstructured.NestedSlice(rule, "matches")
+		for _, matchItem := range matches {
+			match, ok := matchItem.(map[string]any)
+			if !ok {
+				continue
+			}
+			// An unset path matches every request, as PathPrefix "/" does.
+			routeMatch := HTTPRouteMatch{PathType: "PathPrefix", Path: "/"}
+			if pathType, found, _ := unstructured.NestedString(match, "path", "type"); found {
+				routeMatch.PathType = pathType
+			}
+			if path, found, _ := unstructured.NestedString(match, "path", "value"); found {
+				routeMatch.Path = path
+			}
+			routeRule.Matches = append(routeRule.Matches, routeMatch)
+		}
+		if len(routeRule.Matches) == 0 {
+			routeRule.Matches = append(routeRule.Matches, HTTPRouteMatch{PathType: "PathPrefix", Path: "/"})
+		}
+
+		backends, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+		for _, backendItem := range backends {
+			backend, ok := backendItem.(map[string]any)
+			if !ok {
+				continue
+			}
+			routeBackend := HTTPRouteBackend{}
+			routeBackend.Service, _, _ = unstructured.NestedString(backend, "name")
+			if kind, found, _ := unstructured.NestedString(backend, "kind"); found && kind != "Service" {
+				routeBackend.Service = kind + "/" + routeBackend.Service
+			}
+			routeBackend.Port, _, _ = unstructured.NestedInt64(backend, "port")
+			if weight, found, _ := unstructured.NestedInt64(backend, "weight"); found {
+				routeBackend.Weight = &weight
+			}
+			routeRule.Backends = append(routeRule.Backends, routeBackend)
+		}
+		ret.Rules = append(ret.Rules, routeRule)
+	}
+
+	// A route is accepted when every gateway it attaches to accepted it.
+	statusParents, _, _ := unstructured.NestedSlice(obj.Object, "status", "parents")
+	ret.Accepted = len(statusParents) > 0
+	for _, item := range statusParents {
+		parent, ok := item.(map[string]any)
+		ret.Accepted = ret.Accepted && ok && conditionIsTrue(parent, "Accepted", "conditions")
+	}
+	return ret
+}
+
+func namespacedReference(reference map[string]any, defaultNamespace string) string {
+	name, _, _ := unstructured.NestedString(reference, "name")
+	namespace, found, _ := unstructured.NestedString(reference, "namespace")
+	if !found || namespace == "" {
+		namespace = defaultNamespace
+	}
+	return namespace + "/" + name
+}
+
+func conditionIsTrue(obj map[string]any, conditionType string, fields ...string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj, fields...)
+	for _, item := range conditions {
+		condition, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if condition["type"] == conditionType {
+			return condition["status"] == string(metav1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// RoutingEntry is one host and path served by an Ingress or an HTTPRoute.
+type RoutingEntry struct {
+	Source    string `json:"source"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Parent is the ingress class of an Ingress or the gateways of an HTTPRoute.
+	Parent   string `json:"parent,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Path     string `json:"path,omitempty"`
+	PathType string `json:"pathType,omitempty"`
+	Backend  string `json:"backend,omitempty"`
+}
+
+// GetRoutingTable merges the routes of the Ingresses and HTTPRoutes of the active namespace.
+// Clusters without the Gateway API report their Ingresses only.
+func (kapi *KubAPI) GetRoutingTable(ctx context.Context) ([]RoutingEntry, error) {
+	ingresses, err := kapi.GetIngresses()
+	if err != nil {
+		return nil, err
+	}
+	routes, err := kapi.GetHTTPRoutes(ctx, *kapi.Namespace)
+	if IsGatewayAPIMissing(err) {
+		routes = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return BuildRoutingTable(ingresses, routes), nil
+}
+
+func BuildRoutingTable(ingresses []networkingv1.Ingress, routes []HTTPRouteInfo) []RoutingEntry {
+	ret := []RoutingEntry{}
+	for _, route := range BuildIngressInventory(ingresses, nil, nil).Routes {
+		entry := RoutingEntry{Source: "Ingress", Namespace: route.Namespace, Name: route.Ingress, Parent: route.Class, Host: route.Host, Path: route.Path, PathType: route.PathType, Backend: route.Service}
+		if route.Port != "" {
+			entry.Backend += ":" + route.Port
+		}
+		ret = append(ret, entry)
+	}
+
+	for _, route := range routes {
+		hosts := route.Hostnames
+		if len(hosts) == 0 {
+			hosts = []string{""}
+		}
+		for _, host := range hosts {
+			for _, rule := range route.Rules {
+				backends := []string{}
+				for _, backend := range rule.Backends {
+					backends = append(backends, fmt.Sprintf("%s:%d", backend.Service, backend.Port))
+				}
+				for _, match := range rule.Matches {
+					ret = append(ret, RoutingEntry{
+						Source:    "HTTPRoute",
+						Namespace: route.Namespace,
+						Name:      route.Name,
+						Parent:    strings.Join(route.Parents, ","),
+						Host:      host,
+						Path:      match.Path,
+						PathType:  match.PathType,
+						Backend:   strings.Join(backends, ","),
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Host != ret[j].Host {
+			return ret[i].Host < ret[j].Host
+		}
+		if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].Source+"/"+ret[i].Namespace+"/"+ret[i].Name < ret[j].Source+"/"+ret[j].Namespace+"/"+ret[j].Name
+	})
+	return ret
+}
+
+// IngressToHTTPRoutes converts the ingress to one HTTPRoute per host attached to parent. Named
+// backend ports are resolved with services since HTTPRoute backends need port numbers.
+// TLS is not converted, it belongs on the listeners of the gateway.
+func IngressToHTTPRoutes(ingress *networkingv1.Ingress, parent HTTPRouteParent, services []corev1.Service) ([]*unstructured.Unstructured, error) {
+	if parent.Name == "" {
+		return nil, fmt.Errorf("ingress %s: parent gateway name is required", ingress.Name)
+	}
+	backendRef := func(backend *networkingv1.IngressBackend) (map[string]any, error) {
+		if backend.Service == nil {
+			return nil, fmt.Errorf("ingress %s: resource backends can not be converted", ingress.Name)
+		}
+		port := int64(backend.Service.Port.Number)
+		if backend.Service.Port.Name != "" {
+			port = 0
+			for _, service := range services {
+				if service.Namespace != ingress.Namespace || service.Name != backend.Service.Name {
+					continue
+				}
+				for _, servicePort := range service.Spec.Ports {
+					if servicePort.Name == backend.Service.Port.Name {
+						port = int64(servicePort.Port)
+					}
+				}
+			}
+			if port == 0 {
+				return nil, fmt.Errorf("ingress %s: can not resolve port %s of service %s", ingress.Name, backend.Service.Port.Name, backend.Service.Name)
+			}
+		}
+		return map[string]any{"name": backend.Service.Name, "port": port}, nil
+	}
+
+	parentRef := map[string]any{"name": parent.Name}
+	if parent.Namespace != "" {
+		parentRef["namespace"] = parent.Namespace
+	}
+	if parent.SectionName != "" {
+		parentRef["sectionName"] = parent.SectionName
+	}
+
+	// Rules of the same host are merged, as the ingress controller would.
+	hosts := []string{}
+	rulesByHost := map[string][]any{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		if _, ok := rulesByHost[rule.Host]; !ok {
+			hosts = append(hosts, rule.Host)
+		}
+		for _, path := range rule.HTTP.Paths {
+			// ImplementationSpecific paths are prefixes for the common controllers.
+			pathType := "PathPrefix"
+			if path.PathType != nil && *path.PathType == networkingv1.PathTypeExact {
+				pathType = "Exact"
+			}
+			ref, err := backendRef(&path.Backend)
+			if err != nil {
+				return nil, err
+			}
+			rulesByHost[rule.Host] = append(rulesByHost[rule.Host], map[string]any{
+				"matches":     []any{map[string]any{"path": map[string]any{"type": pathType, "value": path.Path}}},
+				"backendRefs": []any{ref},
+			})
+		}
+	}
+	if ingress.Spec.DefaultBackend != nil {
+		ref, err := backendRef(ingress.Spec.DefaultBackend)
+		if err != nil {
+			return nil, err
+		}
+		// Without hostnames the route catches the requests no other route of the gateway matches.
+		if _, ok := rulesByHost[""]; !ok {
+			hosts = append(hosts, "")
+		}
+		rulesByHost[""] = append(rulesByHost[""], map[string]any{"backendRefs": []any{ref}})
+	}
+
+	ret := []*unstructured.Unstructured{}
+	for index, host := range hosts {
+		name := ingress.Name
+		if len(hosts) > 1 {
+			name = fmt.Sprintf("%s-%d", ingress.Name, index)
+		}
+		spec := map[string]any{"parentRefs": []any{parentRef}, "rules": rulesByHost[host]}
+		if host != "" {
+			spec["hostnames"] = []any{host}
+		}
+		route := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+		route.SetAPIVersion(GatewayAPIGroupVersion)
+		route.SetKind("HTTPRoute")
+		route.SetName(name)
+		route.SetNamespace(ingress.Namespace)
+		route.SetLabels(ingress.Labels)
+		ret = append(ret, route)
+	}
+	return ret, nil
+}
+
+// ConvertIngressToHTTPRoutes converts an ingress of the active namespace, see IngressToHTTPRoutes.
+func (kapi *KubAPI) ConvertIngressToHTTPRoutes(ctx context.Context, name string, parent HTTPRouteParent) ([]*unstructured.Unstructured, error) {
+	op := kapi.startOperation(ctx, "get", "Ingress", name)
+	ingress, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	services, err := kapi.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	return IngressToHTTPRoutes(ingress, parent, services)
+}
+
+// WriteManifests writes the objects as a multi-document YAML stream.
+func WriteManifests(writer io.Writer, objects []*unstructured.Unstructured) error {
+	for index, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		if index > 0 {
+			_, err = io.WriteString(writer, "---\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = writer.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
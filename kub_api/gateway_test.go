@@ -0,0 +1,235 @@
+package kub_api
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func testGatewayObject(manifest string) *unstructured.Unstructured {
+	// The unstructured decoder keeps integers as int64, as the dynamic client does.
+	data, err := yaml.YAMLToJSON([]byte(manifest))
+	if err != nil {
+		panic(err)
+	}
+	ret := &unstructured.Unstructured{}
+	err = ret.UnmarshalJSON(data)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// testDynamicClient adds the objects with their resource since the fake tracker guesses
+// "gatewaies" for the Gateway kind.
+func testDynamicClient(objects ...*unstructured.Unstructured) *dynamicfake.FakeDynamicClient {
+	ret := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GatewayClassResource: "GatewayClassList",
+		GatewayResource:      "GatewayList",
+		HTTPRouteResource:    "HTTPRouteList",
+	})
+	resources := map[string]schema.GroupVersionResource{"GatewayClass": GatewayClassResource, "Gateway": GatewayResource, "HTTPRoute": HTTPRouteResource}
+	for _, obj := range objects {
+		err := ret.Tracker().Create(resources[obj.GetKind()], obj, obj.GetNamespace())
+		if err != nil {
+			panic(err)
+		}
+	}
+	return ret
+}
+
+const testGatewayClassManifest = `
+apiVersion: gateway.networking.k8s.io/v1
+kind: GatewayClass
+metadata:
+  name: envoy
+spec:
+  controllerName: gateway.envoyproxy.io/gatewayclass-controller
+status:
+  conditions:
+  - type: Accepted
+    status: "True"
+`
+
+const testGatewayManifest = `
+apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: public
+  namespace: infra
+spec:
+  gatewayClassName: envoy
+  listeners:
+  - name: https
+    hostname: "*.example.com"
+    port: 443
+    protocol: HTTPS
+    tls:
+      certificateRefs:
+      - name: wildcard-tls
+status:
+  addresses:
+  - value: 203.0.113.10
+  conditions:
+  - type: Programmed
+    status: "True"
+`
+
+const testHTTPRouteManifest = `
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: shop
+  namespace: test
+spec:
+  parentRefs:
+  - name: public
+    namespace: infra
+  hostnames:
+  - shop.example.com
+  rules:
+  - matches:
+    - path:
+        type: PathPrefix
+        value: /cart
+    backendRefs:
+    - name: cart
+      port: 8080
+      weight: 90
+    - name: cart-canary
+      port: 8080
+      weight: 10
+  - backendRefs:
+    - name: web
+      port: 80
+status:
+  parents:
+  - parentRef:
+      name: public
+    conditions:
+    - type: Accepted
+      status: "True"
+`
+
+func TestGatewayInventory(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(), dynamicClient: testDynamicClient(
+			testGatewayObject(testGatewayClassManifest), testGatewayObject(testGatewayManifest), testGatewayObject(testHTTPRouteManifest))}
+
+		classes, err := api.GetGatewayClasses(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(classes) != 1 || !classes[0].Accepted || classes[0].Controller != "gateway.envoyproxy.io/gatewayclass-controller" {
+			t.Errorf("unexpected classes %+v", classes)
+		}
+
+		gateways, err := api.GetGateways(context.Background(), "")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(gateways) != 1 || !gateways[0].Programmed || gateways[0].Addresses[0] != "203.0.113.10" ||
+			gateways[0].Listeners[0].Port != 443 || gateways[0].Listeners[0].TLSSecrets[0] != "infra/wildcard-tls" {
+			t.Errorf("unexpected gateways %+v", gateways)
+		}
+
+		routes, err := api.GetHTTPRoutes(context.Background(), namespace)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(routes) != 1 || !routes[0].Accepted || routes[0].Parents[0] != "infra/public" || len(routes[0].Rules) != 2 {
+			t.Fatalf("unexpected routes %+v", routes)
+		}
+		if rule := routes[0].Rules[1]; rule.Matches[0].Path != "/" || rule.Backends[0].Service != "web" {
+			t.Errorf("unexpected catch-all rule %+v", rule)
+		}
+		if backend := routes[0].Rules[0].Backends[1]; backend.Weight == nil || *backend.Weight != 10 {
+			t.Errorf("unexpected weighted backend %+v", backend)
+		}
+	})
+}
+
+func TestGetRoutingTable(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{
+			Namespace:     &namespace,
+			clientset:     fake.NewSimpleClientset(testInventoryIngress("test", "app", "nginx", "app.example.com", "web", "80", "")),
+			dynamicClient: testDynamicClient(testGatewayObject(testHTTPRouteManifest)),
+		}
+
+		table, err := api.GetRoutingTable(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(table) != 3 {
+			t.Fatalf("expected 3 entries, got %+v", table)
+		}
+		if entry := table[0]; entry.Source != "Ingress" || entry.Host != "app.example.com" || entry.Backend != "web:80" || entry.Parent != "nginx" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+		if entry := table[2]; entry.Source != "HTTPRoute" || entry.Path != "/cart" || entry.Backend != "cart:8080,cart-canary:8080" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	})
+}
+
+func TestIngressToHTTPRoutes(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		name := "app"
+		ingress, err := (&Ingress{
+			IngressName: &name,
+			Rules: &[]IngressRule{
+				{Host: "app.example.com", Paths: []IngressPath{{Path: "/", Backend: IngressBackend{ServiceName: "web", ServicePort: "http"}}}},
+				{Host: "api.example.com", Paths: []IngressPath{{Path: "/v1", PathType: networkingv1.PathTypeExact, Backend: IngressBackend{ServiceName: "api", ServicePort: "8080"}}}},
+			},
+		}).GenerateIngress()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		ingress.Namespace = "test"
+		services := []corev1.Service{{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "web"}, Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}}}}
+
+		routes, err := IngressToHTTPRoutes(ingress, HTTPRouteParent{Namespace: "infra", Name: "public"}, services)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(routes) != 2 {
+			t.Fatalf("expected a route per host, got %d", len(routes))
+		}
+		info := HTTPRouteInfoFromUnstructured(routes[0])
+		if info.Name != "app-0" || info.Hostnames[0] != "app.example.com" || info.Parents[0] != "infra/public" || info.Rules[0].Backends[0].Port != 80 {
+			t.Errorf("unexpected route %+v", info)
+		}
+		info = HTTPRouteInfoFromUnstructured(routes[1])
+		if info.Rules[0].Matches[0].PathType != "Exact" || info.Rules[0].Matches[0].Path != "/v1" {
+			t.Errorf("unexpected route %+v", info)
+		}
+
+		buffer := bytes.Buffer{}
+		err = WriteManifests(&buffer, routes)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if strings.Count(buffer.String(), "kind: HTTPRoute") != 2 || !strings.Contains(buffer.String(), "\n---\n") {
+			t.Errorf("unexpected manifests %s", buffer.String())
+		}
+
+		_, err = IngressToHTTPRoutes(ingress, HTTPRouteParent{Name: "public"}, nil)
+		if err == nil || !strings.Contains(err.Error(), "can not resolve port http") {
+			t.Errorf("expected unresolved port, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package kub_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// IngressBackend routes to a port of a Service in the ingress namespace. ServicePort is a port
+// number or the name of a service port.
+type IngressBackend struct {
+	ServiceName string
+	ServicePort string
+}
+
+type IngressPath struct {
+	Path string
+	// PathType defaults to Prefix.
+	PathType networkingv1.PathType
+	Backend  IngressBackend
+}
+
+type IngressRule struct {
+	// Host may start with a "*." wildcard, empty matches every host.
+	Host  string
+	Paths []IngressPath
+}
+
+// Ingress describes an Ingress to create or apply.
+type Ingress struct {
+	IngressName      *string
+	IngressClassName *string
+	Rules            *[]IngressRule
+	DefaultBackend   *IngressBackend
+	TLS              *[]networkingv1.IngressTLS
+	Labels           *map[string]string
+	Annotations      *map[string]string
+}
+
+func (ingress *Ingress) GenerateIngress() (*networkingv1.Ingress, error) {
+	if ingress.IngressName == nil || *ingress.IngressName == "" {
+		return nil, fmt.Errorf("ingress name is required")
+	}
+	name := *ingress.IngressName
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("ingress %s: invalid name: %v", name, errs)
+	}
+
+	ret := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       networkingv1.IngressSpec{IngressClassName: ingress.IngressClassName},
+	}
+	if ingress.DefaultBackend != nil {
+		backend, err := ingress.DefaultBackend.generate()
+		if err != nil {
+			return nil, fmt.Errorf("ingress %s: default backend: %w", name, err)
+		}
+		ret.Spec.DefaultBackend = backend
+	}
+
+	hosts := map[string]bool{}
+	if ingress.Rules != nil {
+		for _, rule := range *ingress.Rules {
+			k8sRule, err := rule.generate()
+			if err != nil {
+				return nil, fmt.Errorf("ingress %s: %w", name, err)
+			}
+			hosts[rule.Host] = true
+			ret.Spec.Rules = append(ret.Spec.Rules, *k8sRule)
+		}
+	}
+	if len(ret.Spec.Rules) == 0 && ret.Spec.DefaultBackend == nil {
+		return nil, fmt.Errorf("ingress %s: rules or a default backend are required", name)
+	}
+
+	if ingress.TLS != nil {
+		for _, tls := range *ingress.TLS {
+			if tls.SecretName == "" {
+				return nil, fmt.Errorf("ingress %s: TLS entry for %v has no secret", name, tls.Hosts)
+			}
+			for _, host := range tls.Hosts {
+				if !hosts[host] {
+					return nil, fmt.Errorf("ingress %s: TLS host %s has no rule", name, host)
+				}
+			}
+			ret.Spec.TLS = append(ret.Spec.TLS, *tls.DeepCopy())
+		}
+	}
+
+	if ingress.Labels != nil {
+		ret.ObjectMeta.Labels = maps.Clone(*ingress.Labels)
+	}
+	if ingress.Annotations != nil {
+		ret.ObjectMeta.Annotations = maps.Clone(*ingress.Annotations)
+	}
+	return ret, nil
+}
+
+func (rule *IngressRule) generate() (*networkingv1.IngressRule, error) {
+	if rule.Host != "" {
+		host := strings.TrimPrefix(rule.Host, "*.")
+		if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 || strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid host %s: %v", rule.Host, errs)
+		}
+	}
+	if len(rule.Paths) == 0 {
+		return nil, fmt.Errorf("host %s has no paths", rule.Host)
+	}
+
+	ret := networkingv1.IngressRule{Host: rule.Host, IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}}}
+	seen := map[string]bool{}
+	for _, path := range rule.Paths {
+		pathType := path.PathType
+		if pathType == "" {
+			pathType = networkingv1.PathTypePrefix
+		}
+		switch pathType {
+		case networkingv1.PathTypeExact, networkingv1.PathTypePrefix, networkingv1.PathTypeImplementationSpecific:
+		default:
+			return nil, fmt.Errorf("host %s path %s: unknown path type %s", rule.Host, path.Path, pathType)
+		}
+		if !strings.HasPrefix(path.Path, "/") {
+			return nil, fmt.Errorf("host %s path %s: path must start with /", rule.Host, path.Path)
+		}
+		key := string(pathType) + " " + path.Path
+		if seen[key] {
+			return nil, fmt.Errorf("host %s path %s declared twice", rule.Host, path.Path)
+		}
+		seen[key] = true
+
+		backend, err := path.Backend.generate()
+		if err != nil {
+			return nil, fmt.Errorf("host %s path %s: %w", rule.Host, path.Path, err)
+		}
+		ret.HTTP.Paths = append(ret.HTTP.Paths, networkingv1.HTTPIngressPath{Path: path.Path, PathType: &pathType, Backend: *backend})
+	}
+	return &ret, nil
+}
+
+func (backend *IngressBackend) generate() (*networkingv1.IngressBackend, error) {
+	if backend.ServiceName == "" {
+		return nil, fmt.Errorf("backend service name is required")
+	}
+	port := networkingv1.ServiceBackendPort{}
+	number, err := strconv.ParseInt(backend.ServicePort, 10, 32)
+	switch {
+	case err == nil && number > 0 && number <= 65535:
+		port.Number = int32(number)
+	case err == nil:
+		return nil, fmt.Errorf("backend %s: port %d out of range", backend.ServiceName, number)
+	case backend.ServicePort == "":
+		return nil, fmt.Errorf("backend %s: port is required", backend.ServiceName)
+	default:
+		port.Name = backend.ServicePort
+	}
+	return &networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{Name: backend.ServiceName, Port: port}}, nil
+}
+
+// ingressBackends returns every service backend of the ingress.
+func ingressBackends(ingress *networkingv1.Ingress) []*networkingv1.IngressServiceBackend {
+	ret := []*networkingv1.IngressServiceBackend{}
+	if ingress.Spec.DefaultBackend != nil && ingress.Spec.DefaultBackend.Service != nil {
+		ret = append(ret, ingress.Spec.DefaultBackend.Service)
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for index := range rule.HTTP.Paths {
+			if rule.HTTP.Paths[index].Backend.Service != nil {
+				ret = append(ret, rule.HTTP.Paths[index].Backend.Service)
+			}
+		}
+	}
+	return ret
+}
+
+// ValidateIngressBackends checks that every backend service exists in the active namespace and
+// exposes the referenced port. All problems are reported together.
+func (kapi *KubAPI) ValidateIngressBackends(ctx context.Context, ingress *networkingv1.Ingress) error {
+	services := map[string]*corev1.Service{}
+	var errs []error
+	for _, backend := range ingressBackends(ingress) {
+		service, ok := services[backend.Name]
+		if !ok {
+			var err error
+			service, err = kapi.GetService(ctx, backend.Name)
+			if apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("backend service %s does not exist", backend.Name))
+			} else if err != nil {
+				return err
+			}
+			services[backend.Name] = service
+		}
+		if service == nil || service.Spec.Type == corev1.ServiceTypeExternalName {
+			continue
+		}
+		if !serviceHasPort(service, backend.Port) {
+			errs = append(errs, fmt.Errorf("backend service %s has no port %s", backend.Name, formatBackendPort(backend.Port)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func serviceHasPort(service *corev1.Service, port networkingv1.ServiceBackendPort) bool {
+	for _, servicePort := range service.Spec.Ports {
+		if (port.Name != "" && servicePort.Name == port.Name) || (port.Name == "" && servicePort.Port == port.Number) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBackendPort(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return fmt.Sprint(port.Number)
+}
+
+// CreateIngress validates the ingress and its backends and creates it in the active namespace.
+func (kapi *KubAPI) CreateIngress(ctx context.Context, ingress *Ingress) (*networkingv1.Ingress, error) {
+	k8sIngress, err := kapi.prepareIngress(ctx, ingress)
+	if err != nil {
+		return nil, err
+	}
+	op := kapi.startOperation(ctx, "create", "Ingress", k8sIngress.Name)
+	op.setDiff(k8sIngress)
+	createdIngress, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Create(op.ctx, k8sIngress, metav1.CreateOptions{})
+	if err != nil {
+		kapi.finishOperation(op, err)
+		return nil, err
+	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(createdIngress.UID)))
+	return createdIngress, nil
+}
+
+// ApplyIngress creates the ingress or replaces the spec, labels and annotations of an existing one.
+func (kapi *KubAPI) ApplyIngress(ctx context.Context, ingress *Ingress) (*networkingv1.Ingress, error) {
+	k8sIngress, err := kapi.prepareIngress(ctx, ingress)
+	if err != nil {
+		return nil, err
+	}
+
+	op := kapi.startOperation(ctx, "get", "Ingress", k8sIngress.Name)
+	existing, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Get(op.ctx, k8sIngress.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Not a failure, the ingress is created.
+		kapi.finishOperation(op, nil)
+		op = kapi.startOperation(ctx, "create", "Ingress", k8sIngress.Name)
+		op.setDiff(k8sIngress)
+		ret, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Create(op.ctx, k8sIngress, metav1.CreateOptions{})
+		kapi.finishOperation(op, err)
+		return ret, err
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	existing.Spec = k8sIngress.Spec
+	existing.Labels = k8sIngress.Labels
+	existing.Annotations = k8sIngress.Annotations
+
+	op = kapi.startOperation(ctx, "update", "Ingress", k8sIngress.Name)
+	op.setDiff(existing)
+	ret, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Update(op.ctx, existing, metav1.UpdateOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) prepareIngress(ctx context.Context, ingress *Ingress) (*networkingv1.Ingress, error) {
+	namespace, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	k8sIngress, err := ingress.GenerateIngress()
+	if err != nil {
+		return nil, err
+	}
+	k8sIngress.Namespace = *namespace
+	err = kapi.ValidateIngressBackends(ctx, k8sIngress)
+	if err != nil {
+		return nil, fmt.Errorf("ingress %s: %w", k8sIngress.Name, err)
+	}
+	return k8sIngress, nil
+}
+
+func (kapi *KubAPI) DeleteIngress(ctx context.Context, name string) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "delete", "Ingress", name)
+	err = kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	kapi.finishOperation(op, err)
+	return err
+}
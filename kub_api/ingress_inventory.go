@@ -0,0 +1,264 @@
+package kub_api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressClassAnnotation is the deprecated way to pick an ingress class, still set by older charts.
+const IngressClassAnnotation = "kubernetes.io/ingress.class"
+
+const (
+	IngressIssueConflict         = "Conflict"
+	IngressIssueMissingService   = "MissingService"
+	IngressIssueMissingPort      = "MissingPort"
+	IngressIssueMissingTLSSecret = "MissingTLSSecret"
+)
+
+// IngressRoute is one host and path of an ingress with the backend it routes to. The default
+// backend of an ingress is reported with an empty host and path.
+type IngressRoute struct {
+	Namespace string `json:"namespace"`
+	Ingress   string `json:"ingress"`
+	Class     string `json:"class,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Path      string `json:"path,omitempty"`
+	PathType  string `json:"pathType,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Port      string `json:"port,omitempty"`
+	TLS       bool   `json:"tls"`
+	TLSSecret string `json:"tlsSecret,omitempty"`
+}
+
+type IngressIssue struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace"`
+	Ingress   string `json:"ingress"`
+	Host      string `json:"host,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Message   string `json:"message"`
+}
+
+type IngressInventory struct {
+	Routes []IngressRoute `json:"routes"`
+	Issues []IngressIssue `json:"issues"`
+}
+
+// GetIngressInventory reports the routes of the ingresses in all namespaces and the problems
+// found in them.
+func (kapi *KubAPI) GetIngressInventory(ctx context.Context) (*IngressInventory, error) {
+	op := kapi.startOperation(ctx, "list", "Ingress", "")
+	op.namespace = metav1.NamespaceAll
+	ingresses, err := kapi.clientset.NetworkingV1().Ingresses(metav1.NamespaceAll).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	op = kapi.startOperation(ctx, "list", "Service", "")
+	op.namespace = metav1.NamespaceAll
+	services, err := kapi.clientset.CoreV1().Services(metav1.NamespaceAll).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only TLS secrets matter, the field selector keeps the others off the wire.
+	op = kapi.startOperation(ctx, "list", "Secret", "")
+	op.namespace = metav1.NamespaceAll
+	secrets, err := kapi.clientset.CoreV1().Secrets(metav1.NamespaceAll).List(op.ctx, metav1.ListOptions{FieldSelector: "type=" + string(corev1.SecretTypeTLS)})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	secretNames := []string{}
+	for _, secret := range secrets.Items {
+		if secret.Type != corev1.SecretTypeTLS {
+			continue
+		}
+		secretNames = append(secretNames, secret.Namespace+"/"+secret.Name)
+	}
+
+	return BuildIngressInventory(ingresses.Items, services.Items, secretNames), nil
+}
+
+// IngressClass returns the class of the ingress from the spec or the legacy annotation, empty
+// when the cluster default class applies.
+func IngressClass(ingress *networkingv1.Ingress) string {
+	if ingress.Spec.IngressClassName != nil {
+		return *ingress.Spec.IngressClassName
+	}
+	return ingress.Annotations[IngressClassAnnotation]
+}
+
+// BuildIngressInventory maps the routes of the ingresses and checks them against the services
+// and the TLS secrets, named "namespace/name".
+func BuildIngressInventory(ingresses []networkingv1.Ingress, services []corev1.Service, secrets []string) *IngressInventory {
+	ret := IngressInventory{Routes: []IngressRoute{}, Issues: []IngressIssue{}}
+	servicesByName := map[string]*corev1.Service{}
+	for index := range services {
+		servicesByName[services[index].Namespace+"/"+services[index].Name] = &services[index]
+	}
+	secretsByName := map[string]bool{}
+	for _, secret := range secrets {
+		secretsByName[secret] = true
+	}
+
+	for index := range ingresses {
+		ingress := &ingresses[index]
+		class := IngressClass(ingress)
+		addIssue := func(issueType, host, path, message string) {
+			ret.Issues = append(ret.Issues, IngressIssue{Type: issueType, Namespace: ingress.Namespace, Ingress: ingress.Name, Host: host, Path: path, Message: message})
+		}
+
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName != "" && !secretsByName[ingress.Namespace+"/"+tls.SecretName] {
+				addIssue(IngressIssueMissingTLSSecret, strings.Join(tls.Hosts, ","), "", fmt.Sprintf("TLS secret %s does not exist", tls.SecretName))
+			}
+		}
+
+		addRoute := func(host, path, pathType string, backend *networkingv1.IngressBackend) {
+			route := IngressRoute{Namespace: ingress.Namespace, Ingress: ingress.Name, Class: class, Host: host, Path: path, PathType: pathType}
+			route.TLSSecret, route.TLS = ingressTLSSecret(ingress, host)
+			if backend.Service != nil {
+				route.Service = backend.Service.Name
+				route.Port = formatBackendPort(backend.Service.Port)
+				service, ok := servicesByName[ingress.Namespace+"/"+backend.Service.Name]
+				switch {
+				case !ok:
+					addIssue(IngressIssueMissingService, host, path, fmt.Sprintf("backend service %s does not exist", backend.Service.Name))
+				case service.Spec.Type != corev1.ServiceTypeExternalName && !serviceHasPort(service, backend.Service.Port):
+					addIssue(IngressIssueMissingPort, host, path, fmt.Sprintf("backend service %s has no port %s", backend.Service.Name, route.Port))
+				}
+			} else if backend.Resource != nil {
+				route.Service = backend.Resource.Kind + "/" + backend.Resource.Name
+			}
+			ret.Routes = append(ret.Routes, route)
+		}
+
+		if ingress.Spec.DefaultBackend != nil {
+			addRoute("", "", "", ingress.Spec.DefaultBackend)
+		}
+		for _, rule := range ingress.Spec.Rules {
+			if rule.HTTP == nil {
+				continue
+			}
+			for _, path := range rule.HTTP.Paths {
+				pathType := ""
+				if path.PathType != nil {
+					pathType = string(*path.PathType)
+				}
+				addRoute(rule.Host, path.Path, pathType, &path.Backend)
+			}
+		}
+	}
+
+	ret.Issues = append(ret.Issues, ingressConflicts(ret.Routes)...)
+	sort.SliceStable(ret.Routes, func(i, j int) bool {
+		return ingressRouteKey(&ret.Routes[i]) < ingressRouteKey(&ret.Routes[j])
+	})
+	sort.SliceStable(ret.Issues, func(i, j int) bool {
+		if ret.Issues[i].Namespace+"/"+ret.Issues[i].Ingress != ret.Issues[j].Namespace+"/"+ret.Issues[j].Ingress {
+			return ret.Issues[i].Namespace+"/"+ret.Issues[i].Ingress < ret.Issues[j].Namespace+"/"+ret.Issues[j].Ingress
+		}
+		return ret.Issues[i].Host+ret.Issues[i].Path < ret.Issues[j].Host+ret.Issues[j].Path
+	})
+	return &ret
+}
+
+func ingressRouteKey(route *IngressRoute) string {
+	return strings.Join([]string{route.Namespace, route.Ingress, route.Host, route.Path, route.PathType}, "\x00")
+}
+
+// ingressTLSSecret returns the secret of the TLS entry covering host. A TLS entry without hosts
+// covers all of them.
+func ingressTLSSecret(ingress *networkingv1.Ingress, host string) (string, bool) {
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 {
+			return tls.SecretName, true
+		}
+		for _, tlsHost := range tls.Hosts {
+			if tlsHost == host || (strings.HasPrefix(tlsHost, "*.") && host != "" && !strings.HasPrefix(host, "*.") &&
+				strings.HasSuffix(host, tlsHost[1:]) && !strings.Contains(strings.TrimSuffix(host, tlsHost[1:]), ".")) {
+				return tls.SecretName, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ingressConflicts reports host and path pairs declared by more than one ingress of the same class.
+// Ingresses of different classes are served by different controllers and do not conflict.
+func ingressConflicts(routes []IngressRoute) []IngressIssue {
+	owners := map[string][]*IngressRoute{}
+	keys := []string{}
+	for index := range routes {
+		route := &routes[index]
+		if route.Host == "" && route.Path == "" {
+			continue
+		}
+		key := strings.Join([]string{route.Class, route.Host, route.Path, route.PathType}, "\x00")
+		if _, ok := owners[key]; !ok {
+			keys = append(keys, key)
+		}
+		duplicate := false
+		for _, owner := range owners[key] {
+			duplicate = duplicate || (owner.Namespace == route.Namespace && owner.Ingress == route.Ingress)
+		}
+		if !duplicate {
+			owners[key] = append(owners[key], route)
+		}
+	}
+
+	ret := []IngressIssue{}
+	for _, key := range keys {
+		if len(owners[key]) < 2 {
+			continue
+		}
+		names := []string{}
+		for _, owner := range owners[key] {
+			names = append(names, owner.Namespace+"/"+owner.Ingress)
+		}
+		for _, owner := range owners[key] {
+			ret = append(ret, IngressIssue{
+				Type:      IngressIssueConflict,
+				Namespace: owner.Namespace,
+				Ingress:   owner.Ingress,
+				Host:      owner.Host,
+				Path:      owner.Path,
+				Message:   fmt.Sprintf("host %s path %s is declared by %s", owner.Host, owner.Path, strings.Join(names, ", ")),
+			})
+		}
+	}
+	return ret
+}
+
+func (inventory *IngressInventory) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inventory)
+}
+
+// WriteCSV writes one row per route followed by one row per issue, told apart by the record column.
+func (inventory *IngressInventory) WriteCSV(writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"record", "namespace", "ingress", "class", "host", "path", "pathType", "service", "port", "tls", "tlsSecret", "issue", "message"})
+	for _, route := range inventory.Routes {
+		csvWriter.Write([]string{"route", route.Namespace, route.Ingress, route.Class, route.Host, route.Path, route.PathType, route.Service, route.Port, strconv.FormatBool(route.TLS), route.TLSSecret, "", ""})
+	}
+	for _, issue := range inventory.Issues {
+		csvWriter.Write([]string{"issue", issue.Namespace, issue.Ingress, "", issue.Host, issue.Path, "", "", "", "", "", issue.Type, issue.Message})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,131 @@
+package kub_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testInventoryIngress(namespace, name, class, host, service, port, secret string) *networkingv1.Ingress {
+	ingress := &Ingress{IngressName: &name, Rules: &[]IngressRule{{Host: host, Paths: []IngressPath{{Path: "/", Backend: IngressBackend{ServiceName: service, ServicePort: port}}}}}}
+	if class != "" {
+		ingress.IngressClassName = &class
+	}
+	if secret != "" {
+		ingress.TLS = &[]networkingv1.IngressTLS{{Hosts: []string{host}, SecretName: secret}}
+	}
+	ret, err := ingress.GenerateIngress()
+	if err != nil {
+		panic(err)
+	}
+	ret.Namespace = namespace
+	return ret
+}
+
+func TestBuildIngressInventory(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		legacy := testInventoryIngress("b", "legacy", "", "app.example.com", "web", "80", "")
+		legacy.Annotations = map[string]string{IngressClassAnnotation: "nginx"}
+		ingresses := []networkingv1.Ingress{
+			*testInventoryIngress("a", "app", "nginx", "app.example.com", "web", "http", "app-tls"),
+			*legacy,
+			*testInventoryIngress("c", "other", "traefik", "app.example.com", "web", "80", ""),
+			*testInventoryIngress("c", "broken", "nginx", "broken.example.com", "missing", "80", "missing-tls"),
+			*testInventoryIngress("c", "wrong-port", "nginx", "port.example.com", "web", "8080", ""),
+		}
+		services := []corev1.Service{}
+		for _, namespace := range []string{"a", "b", "c"} {
+			services = append(services, corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web"},
+				Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+			})
+		}
+
+		inventory := BuildIngressInventory(ingresses, services, []string{"a/app-tls"})
+		if len(inventory.Routes) != 5 {
+			t.Fatalf("expected 5 routes, got %+v", inventory.Routes)
+		}
+		if route := inventory.Routes[0]; route.Ingress != "app" || !route.TLS || route.TLSSecret != "app-tls" || route.Port != "http" {
+			t.Errorf("unexpected route %+v", route)
+		}
+		if route := inventory.Routes[1]; route.Ingress != "legacy" || route.Class != "nginx" || route.TLS {
+			t.Errorf("unexpected route %+v", route)
+		}
+
+		issues := map[string][]string{}
+		for _, issue := range inventory.Issues {
+			issues[issue.Type] = append(issues[issue.Type], issue.Namespace+"/"+issue.Ingress)
+		}
+		if len(issues[IngressIssueConflict]) != 2 || issues[IngressIssueConflict][0] != "a/app" || issues[IngressIssueConflict][1] != "b/legacy" {
+			t.Errorf("unexpected conflicts %v", issues[IngressIssueConflict])
+		}
+		if len(issues[IngressIssueMissingService]) != 1 || issues[IngressIssueMissingService][0] != "c/broken" {
+			t.Errorf("unexpected missing services %v", issues[IngressIssueMissingService])
+		}
+		if len(issues[IngressIssueMissingTLSSecret]) != 1 || issues[IngressIssueMissingTLSSecret][0] != "c/broken" {
+			t.Errorf("unexpected missing secrets %v", issues[IngressIssueMissingTLSSecret])
+		}
+		if len(issues[IngressIssueMissingPort]) != 1 || issues[IngressIssueMissingPort][0] != "c/wrong-port" {
+			t.Errorf("unexpected missing ports %v", issues[IngressIssueMissingPort])
+		}
+	})
+
+	t.Run("Wildcard TLS", func(t *testing.T) {
+		ingress := testInventoryIngress("a", "app", "", "app.example.com", "web", "80", "")
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"*.example.com"}, SecretName: "wildcard"}}
+		for host, expected := range map[string]bool{"app.example.com": true, "a.b.example.com": false, "example.com": false} {
+			_, covered := ingressTLSSecret(ingress, host)
+			if covered != expected {
+				t.Errorf("%s: expected covered %t", host, expected)
+			}
+		}
+	})
+}
+
+func TestGetIngressInventory(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(
+			testInventoryIngress("a", "app", "nginx", "app.example.com", "web", "80", "app-tls"),
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "web"}, Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "app-tls"}, Type: corev1.SecretTypeTLS},
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		inventory, err := api.GetIngressInventory(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(inventory.Routes) != 1 || len(inventory.Issues) != 0 {
+			t.Fatalf("unexpected inventory %+v", inventory)
+		}
+
+		buffer := bytes.Buffer{}
+		err = inventory.WriteJSON(&buffer)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		decoded := IngressInventory{}
+		err = json.Unmarshal(buffer.Bytes(), &decoded)
+		if err != nil || decoded.Routes[0].TLSSecret != "app-tls" {
+			t.Errorf("unexpected JSON %s: %v", buffer.String(), err)
+		}
+
+		buffer.Reset()
+		err = inventory.WriteCSV(&buffer)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		records, err := csv.NewReader(&buffer).ReadAll()
+		if err != nil || len(records) != 2 || records[1][0] != "route" || records[1][9] != "true" {
+			t.Errorf("unexpected CSV %v: %v", records, err)
+		}
+	})
+}
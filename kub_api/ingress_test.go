@@ -0,0 +1,113 @@
+package kub_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testIngress(name string) *Ingress {
+	className := "nginx"
+	rules := []IngressRule{
+		{Host: "app.example.com", Paths: []IngressPath{
+			{Path: "/", Backend: IngressBackend{ServiceName: "web", ServicePort: "http"}},
+			{Path: "/api", PathType: networkingv1.PathTypeExact, Backend: IngressBackend{ServiceName: "api", ServicePort: "8080"}},
+		}},
+	}
+	tls := []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "app-tls"}}
+	annotations := map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "8m"}
+	return &Ingress{IngressName: &name, IngressClassName: &className, Rules: &rules, TLS: &tls, Annotations: &annotations}
+}
+
+func TestGenerateIngress(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		ingress, err := testIngress("test").GenerateIngress()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		paths := ingress.Spec.Rules[0].HTTP.Paths
+		if *paths[0].PathType != networkingv1.PathTypePrefix || paths[0].Backend.Service.Port.Name != "http" || paths[1].Backend.Service.Port.Number != 8080 {
+			t.Errorf("unexpected paths %+v", paths)
+		}
+		if *ingress.Spec.IngressClassName != "nginx" || ingress.Spec.TLS[0].SecretName != "app-tls" {
+			t.Errorf("unexpected spec %+v", ingress.Spec)
+		}
+	})
+
+	t.Run("Invalid ingresses", func(t *testing.T) {
+		for description, mutate := range map[string]func(*Ingress){
+			"no rules":      func(ingress *Ingress) { ingress.Rules = &[]IngressRule{} },
+			"relative path": func(ingress *Ingress) { (*ingress.Rules)[0].Paths[0].Path = "api" },
+			"bad host":      func(ingress *Ingress) { (*ingress.Rules)[0].Host = "app_example.com" },
+			"tls host":      func(ingress *Ingress) { (*ingress.TLS)[0].Hosts = []string{"other.example.com"} },
+			"port range":    func(ingress *Ingress) { (*ingress.Rules)[0].Paths[1].Backend.ServicePort = "70000" },
+			"path type":     func(ingress *Ingress) { (*ingress.Rules)[0].Paths[0].PathType = "Regex" },
+		} {
+			ingress := testIngress("test")
+			mutate(ingress)
+			_, err := ingress.GenerateIngress()
+			if err == nil {
+				t.Errorf("%s: expected error", description)
+			}
+		}
+	})
+}
+
+func TestCreateApplyIngress(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		sink := MemoryAuditSink{}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(), Auditor: &Auditor{Sinks: []AuditSink{&sink}}}
+
+		_, err := api.CreateIngress(context.Background(), testIngress("test"))
+		if err == nil || !strings.Contains(err.Error(), "backend service web does not exist") || !strings.Contains(err.Error(), "backend service api does not exist") {
+			t.Fatalf("expected missing backends, got %v", err)
+		}
+
+		webPorts := []corev1.ServicePort{ServicePortNew("http", 80, "", "")}
+		apiPorts := []corev1.ServicePort{ServicePortNew("grpc", 9090, "", "")}
+		for name, ports := range map[string]*[]corev1.ServicePort{"web": &webPorts, "api": &apiPorts} {
+			_, err = api.ProvisionService(context.Background(), &Service{ServiceName: &name, Ports: ports})
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+		_, err = api.CreateIngress(context.Background(), testIngress("test"))
+		if err == nil || !strings.Contains(err.Error(), "backend service api has no port 8080") {
+			t.Fatalf("expected missing port, got %v", err)
+		}
+
+		ingress := testIngress("test")
+		(*ingress.Rules)[0].Paths[1].Backend.ServicePort = "9090"
+		created, err := api.CreateIngress(context.Background(), ingress)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if created.Namespace != namespace {
+			t.Errorf("unexpected namespace %s", created.Namespace)
+		}
+
+		(*ingress.Rules)[0].Paths = (*ingress.Rules)[0].Paths[:1]
+		applied, err := api.ApplyIngress(context.Background(), ingress)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(applied.Spec.Rules[0].HTTP.Paths) != 1 {
+			t.Errorf("expected applied ingress to replace the paths, got %+v", applied.Spec.Rules)
+		}
+		for _, record := range sink.Records() {
+			if record.Kind == "Ingress" && record.Result == AuditResultFailure {
+				t.Errorf("unexpected failed audit record %+v", record)
+			}
+		}
+
+		err = api.DeleteIngress(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	})
+}
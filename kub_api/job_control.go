@@ -0,0 +1,94 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SuspendJob sets spec.suspend, the job controller then terminates the active pods.
+// Returns the number of pods that were active when the job was suspended.
+func (kapi *KubAPI) SuspendJob(ctx context.Context, name string) (int, error) {
+	activePods, err := kapi.countActiveJobPods(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	err = kapi.setJobSuspend(ctx, name, true)
+	if err != nil {
+		return 0, err
+	}
+	kapi.log().Info("job suspended", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, name), slog.Int("podsTerminated", activePods))
+	return activePods, nil
+}
+
+// ResumeJob clears spec.suspend of a suspended job or of one created with Job.Suspend.
+func (kapi *KubAPI) ResumeJob(ctx context.Context, name string) error {
+	return kapi.setJobSuspend(ctx, name, false)
+}
+
+func (kapi *KubAPI) setJobSuspend(ctx context.Context, name string, suspend bool) error {
+	patch, err := NewMergePatch(map[string]any{
+		"spec": map[string]any{
+			"suspend": suspend,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = kapi.PatchJob(ctx, name, patch)
+	return err
+}
+
+// CancelJob deletes the job together with its pods and returns how many of them were still running.
+// The propagation policy defaults to Background, Foreground keeps the Job until its pods are gone.
+// Orphan would leave the pods running and is rejected.
+func (kapi *KubAPI) CancelJob(ctx context.Context, name string, propagationPolicy metav1.DeletionPropagation) (int, error) {
+	switch propagationPolicy {
+	case "":
+		propagationPolicy = metav1.DeletePropagationBackground
+	case metav1.DeletePropagationBackground, metav1.DeletePropagationForeground:
+	default:
+		return 0, fmt.Errorf("job %s: cancel does not support propagation policy %s, use Background or Foreground", name, propagationPolicy)
+	}
+	activePods, err := kapi.countActiveJobPods(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	err = kapi.deleteJob(ctx, name, propagationPolicy)
+	if err != nil {
+		return 0, err
+	}
+	kapi.log().Info("job cancelled", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, name), slog.Int("podsTerminated", activePods))
+	return activePods, nil
+}
+
+// countActiveJobPods counts the pods of the job that have not finished and are not being deleted.
+func (kapi *KubAPI) countActiveJobPods(ctx context.Context, name string) (int, error) {
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return 0, err
+	}
+
+	ret := 0
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded, corev1.PodFailed:
+			continue
+		}
+		ret++
+	}
+	return ret, nil
+}
+
+func IsJobSuspended(batchJob *batchv1.Job) bool {
+	return batchJob.Spec.Suspend != nil && *batchJob.Spec.Suspend
+}
@@ -0,0 +1,99 @@
+package kub_api
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testJobPod(name, jobName string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test", Labels: map[string]string{"job-name": jobName}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestSuspendResumeJob(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(
+			testJobPod("test-a", "test", corev1.PodRunning),
+			testJobPod("test-b", "test", corev1.PodSucceeded),
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		job := testQueueJob("test", nil)
+		suspend := true
+		job.Suspend = &suspend
+		err := api.CreateJob(job)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		batchJob, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if err != nil || !IsJobSuspended(batchJob) {
+			t.Fatalf("expected suspended job: %v", err)
+		}
+
+		err = api.ResumeJob(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		batchJob, _ = clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if IsJobSuspended(batchJob) {
+			t.Errorf("expected resumed job")
+		}
+
+		podsTerminated, err := api.SuspendJob(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if podsTerminated != 1 {
+			t.Errorf("expected 1 terminated pod, got %d", podsTerminated)
+		}
+	})
+}
+
+func TestCancelJob(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(
+			&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace}},
+			testJobPod("test-a", "test", corev1.PodRunning),
+			testJobPod("test-b", "test", corev1.PodPending),
+			testJobPod("other", "other", corev1.PodRunning),
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		podsTerminated, err := api.CancelJob(context.Background(), "test", "")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if podsTerminated != 2 {
+			t.Errorf("expected 2 terminated pods, got %d", podsTerminated)
+		}
+		_, err = clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("expected job to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("Orphan rejected", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace}})
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		_, err := api.CancelJob(context.Background(), "test", metav1.DeletePropagationOrphan)
+		if err == nil {
+			t.Errorf("expected error")
+		}
+		_, err = clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("expected job to be kept, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExitCodeOOMKilled is the exit code of a container killed by the kernel OOM killer.
+const ExitCodeOOMKilled = 137
+
+// Reasons reported by the failure classifier.
+const (
+	FailureReasonImagePull   = "ImagePull"
+	FailureReasonConfig      = "ContainerConfig"
+	FailureReasonOOMKilled   = "OOMKilled"
+	FailureReasonExitCode    = "ExitCode"
+	FailureReasonDeadline    = "DeadlineExceeded"
+	FailureReasonEvicted     = "Evicted"
+	FailureReasonDisruption  = "Disruption"
+	FailureReasonUnknown     = "Unknown"
+	FailureReasonBackoff     = "BackoffLimitExceeded"
+	FailureReasonPodPolicy   = "PodFailurePolicy"
+	FailureReasonMaxFailures = "MaxFailedIndexesExceeded"
+)
+
+var imagePullWaitingReasons = map[string]bool{
+	"ErrImagePull":        true,
+	"ImagePullBackOff":    true,
+	"InvalidImageName":    true,
+	"ErrImageNeverPull":   true,
+	"RegistryUnavailable": true,
+}
+
+var configWaitingReasons = map[string]bool{
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+func NewPodFailurePolicy(rules ...batchv1.PodFailurePolicyRule) *batchv1.PodFailurePolicy {
+	return &batchv1.PodFailurePolicy{Rules: rules}
+}
+
+// PodFailurePolicyIgnoreDisruptions does not count pods evicted by preemption, drains or
+// taint-based eviction against the backoff limit.
+func PodFailurePolicyIgnoreDisruptions() batchv1.PodFailurePolicyRule {
+	return batchv1.PodFailurePolicyRule{
+		Action: batchv1.PodFailurePolicyActionIgnore,
+		OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+			{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue},
+		},
+	}
+}
+
+// PodFailurePolicyFailOnExitCodes fails the whole job at once when container exits with one
+// of exitCodes, e.g. for errors a retry cannot fix. An empty container matches all containers.
+func PodFailurePolicyFailOnExitCodes(container string, exitCodes ...int32) batchv1.PodFailurePolicyRule {
+	return podFailurePolicyExitCodesRule(batchv1.PodFailurePolicyActionFailJob, container, exitCodes)
+}
+
+// PodFailurePolicyIgnoreExitCodes retries pods exiting with exitCodes without counting them
+// against the backoff limit.
+func PodFailurePolicyIgnoreExitCodes(container string, exitCodes ...int32) batchv1.PodFailurePolicyRule {
+	return podFailurePolicyExitCodesRule(batchv1.PodFailurePolicyActionIgnore, container, exitCodes)
+}
+
+// PodFailurePolicyOnOOMKilled applies action to containers killed with ExitCodeOOMKilled:
+// Ignore to retry without limit, FailJob to stop at once or Count for the default behaviour.
+func PodFailurePolicyOnOOMKilled(action batchv1.PodFailurePolicyAction) batchv1.PodFailurePolicyRule {
+	return podFailurePolicyExitCodesRule(action, "", []int32{ExitCodeOOMKilled})
+}
+
+func podFailurePolicyExitCodesRule(action batchv1.PodFailurePolicyAction, container string, exitCodes []int32) batchv1.PodFailurePolicyRule {
+	rule := batchv1.PodFailurePolicyRule{
+		Action: action,
+		OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+			Operator: batchv1.PodFailurePolicyOnExitCodesOpIn,
+			Values:   append([]int32{}, exitCodes...),
+		},
+	}
+	if container != "" {
+		rule.OnExitCodes.ContainerName = &container
+	}
+	return rule
+}
+
+type PodFailure struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason"`
+	ExitCode  int32  `json:"exitCode,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type JobFailureReport struct {
+	Job    string `json:"job"`
+	Failed bool   `json:"failed"`
+	// Reason is the reason of the JobFailed condition, e.g. BackoffLimitExceeded.
+	Reason  string         `json:"reason,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Pods    []PodFailure   `json:"pods,omitempty"`
+	Summary map[string]int `json:"summary,omitempty"`
+}
+
+func (report *JobFailureReport) String() string {
+	if !report.Failed && len(report.Pods) == 0 {
+		return fmt.Sprintf("job %s has not failed", report.Job)
+	}
+	reasons := []string{}
+	for reason, count := range report.Summary {
+		reasons = append(reasons, fmt.Sprintf("%s=%d", reason, count))
+	}
+	sort.Strings(reasons)
+	ret := fmt.Sprintf("job %s", report.Job)
+	if report.Failed {
+		ret += fmt.Sprintf(" failed: %s", report.Reason)
+	}
+	return ret + fmt.Sprintf(" pods: %s", strings.Join(reasons, ", "))
+}
+
+// ClassifyPodFailure explains why the pod failed, or why its containers keep failing.
+// Returns nil for a healthy pod.
+func ClassifyPodFailure(pod *corev1.Pod) *PodFailure {
+	switch pod.Status.Reason {
+	case "Evicted":
+		return &PodFailure{Pod: pod.Name, Reason: FailureReasonEvicted, Message: pod.Status.Message}
+	case "DeadlineExceeded":
+		return &PodFailure{Pod: pod.Name, Reason: FailureReasonDeadline, Message: pod.Status.Message}
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+			return &PodFailure{Pod: pod.Name, Reason: FailureReasonDisruption, Message: condition.Message}
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if failure := classifyContainerState(pod.Name, status.Name, status.State); failure != nil {
+			return failure
+		}
+	}
+	// Containers restarted by the OnFailure restart policy keep the failure in the last state.
+	for _, status := range statuses {
+		if failure := classifyContainerState(pod.Name, status.Name, status.LastTerminationState); failure != nil {
+			return failure
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodFailed {
+		return &PodFailure{Pod: pod.Name, Reason: FailureReasonUnknown, Message: pod.Status.Message}
+	}
+	return nil
+}
+
+func classifyContainerState(podName, containerName string, state corev1.ContainerState) *PodFailure {
+	if state.Waiting != nil {
+		switch {
+		case imagePullWaitingReasons[state.Waiting.Reason]:
+			return &PodFailure{Pod: podName, Container: containerName, Reason: FailureReasonImagePull, Message: state.Waiting.Message}
+		case configWaitingReasons[state.Waiting.Reason]:
+			return &PodFailure{Pod: podName, Container: containerName, Reason: FailureReasonConfig, Message: state.Waiting.Message}
+		}
+	}
+	if state.Terminated != nil {
+		terminated := state.Terminated
+		switch {
+		case terminated.Reason == "OOMKilled":
+			return &PodFailure{Pod: podName, Container: containerName, Reason: FailureReasonOOMKilled, ExitCode: terminated.ExitCode, Message: terminated.Message}
+		case terminated.Reason == "DeadlineExceeded":
+			return &PodFailure{Pod: podName, Container: containerName, Reason: FailureReasonDeadline, ExitCode: terminated.ExitCode, Message: terminated.Message}
+		case terminated.ExitCode != 0:
+			return &PodFailure{Pod: podName, Container: containerName, Reason: FailureReasonExitCode, ExitCode: terminated.ExitCode, Message: terminated.Message}
+		}
+	}
+	return nil
+}
+
+// ClassifyJobFailure combines the JobFailed condition with the failures of the job pods.
+func ClassifyJobFailure(batchJob *batchv1.Job, pods []corev1.Pod) *JobFailureReport {
+	ret := JobFailureReport{Job: batchJob.Name, Summary: map[string]int{}}
+	for _, condition := range batchJob.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			ret.Failed = true
+			ret.Reason = condition.Reason
+			ret.Message = condition.Message
+		}
+	}
+
+	for index := range pods {
+		failure := ClassifyPodFailure(&pods[index])
+		if failure == nil {
+			continue
+		}
+		ret.Pods = append(ret.Pods, *failure)
+		ret.Summary[failure.Reason]++
+	}
+	sort.Slice(ret.Pods, func(i, j int) bool { return ret.Pods[i].Pod < ret.Pods[j].Pod })
+	return &ret
+}
+
+// GetJobFailureReport fetches the job and its pods and classifies why it failed.
+func (kapi *KubAPI) GetJobFailureReport(ctx context.Context, name string) (*JobFailureReport, error) {
+	op := kapi.startOperation(ctx, "get", "Job", name)
+	batchJob, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	op = kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	return ClassifyJobFailure(batchJob, pods.Items), nil
+}
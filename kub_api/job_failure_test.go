@@ -0,0 +1,103 @@
+package kub_api
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClassifyJobFailure(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		batchJob := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: FailureReasonBackoff, Message: "Job has reached the specified backoff limit"},
+			}},
+		}
+		pods := []corev1.Pod{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-oom"},
+				Status: corev1.PodStatus{Phase: corev1.PodFailed, ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "test", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: ExitCodeOOMKilled}}},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-exit"},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "test", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 3}}},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-image"},
+				Status: corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "test", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-evicted"},
+				Status:     corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "The node was low on resource: memory."},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-ok"},
+				Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+			},
+		}
+
+		report := ClassifyJobFailure(batchJob, pods)
+		if !report.Failed || report.Reason != FailureReasonBackoff {
+			t.Errorf("unexpected report %+v", report)
+		}
+		expected := map[string]string{
+			"test-oom":     FailureReasonOOMKilled,
+			"test-exit":    FailureReasonExitCode,
+			"test-image":   FailureReasonImagePull,
+			"test-evicted": FailureReasonEvicted,
+		}
+		if len(report.Pods) != len(expected) {
+			t.Fatalf("unexpected pod failures %+v", report.Pods)
+		}
+		for _, failure := range report.Pods {
+			if expected[failure.Pod] != failure.Reason {
+				t.Errorf("pod %s: expected %s, got %s", failure.Pod, expected[failure.Pod], failure.Reason)
+			}
+		}
+		if report.Pods[0].Pod != "test-evicted" || report.Summary[FailureReasonOOMKilled] != 1 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+}
+
+func TestPodFailurePolicy(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		name := "test"
+		containerImage := "busybox:1.28"
+		containerCommand := []string{"/bin/sh", "-c", "exit 42"}
+		backoffLimit := int32(2)
+		job := Job{
+			JobName: &name, ContainerName: &name, ContainerImage: &containerImage, ContainerCommand: &containerCommand,
+			BackoffLimit: &backoffLimit,
+			PodFailurePolicy: NewPodFailurePolicy(
+				PodFailurePolicyIgnoreDisruptions(),
+				PodFailurePolicyFailOnExitCodes(name, 42),
+				PodFailurePolicyOnOOMKilled(batchv1.PodFailurePolicyActionIgnore),
+			),
+		}
+
+		batchJob, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if batchJob.Spec.Template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+			t.Errorf("pod failure policy requires restartPolicy Never")
+		}
+		rules := batchJob.Spec.PodFailurePolicy.Rules
+		if len(rules) != 3 || *rules[1].OnExitCodes.ContainerName != name || rules[2].OnExitCodes.Values[0] != ExitCodeOOMKilled {
+			t.Errorf("unexpected rules %+v", rules)
+		}
+		if *batchJob.Spec.BackoffLimit != 2 {
+			t.Errorf("unexpected backoff limit")
+		}
+	})
+}
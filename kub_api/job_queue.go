@@ -0,0 +1,384 @@
+package kub_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type JobQueueItem struct {
+	ID          string    `json:"id"`
+	Namespace   string    `json:"namespace"`
+	Priority    int       `json:"priority"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	Job         Job       `json:"job"`
+}
+
+// JobQueue holds jobs locally and submits them with CreateJob while the namespace has room.
+// Pending items are persisted to StatePath so the queue survives restarts.
+type JobQueue struct {
+	KAPI      *KubAPI
+	StatePath string
+	// MaxActivePerNamespace limits unfinished Jobs per namespace, unlimited when 0.
+	MaxActivePerNamespace int
+	// MaxActivePerLabel limits unfinished Jobs carrying a "key=value" label.
+	MaxActivePerLabel map[string]int
+	// QuotaThreshold holds submissions once any ResourceQuota resource the job uses would reach this
+	// used/hard ratio with the requests of the job added, e.g. 0.9; disabled when 0.
+	QuotaThreshold float64
+	PollInterval   time.Duration
+
+	mutex    sync.Mutex
+	items    []*JobQueueItem
+	sequence int
+}
+
+type jobQueueState struct {
+	Sequence int             `json:"sequence"`
+	Items    []*JobQueueItem `json:"items"`
+}
+
+// namespaceCapacity is the current load of a namespace as seen by one Dispatch pass.
+type namespaceCapacity struct {
+	active       int
+	activeLabels map[string]int
+	quotaBlocked string
+	// quotas track the jobs admitted by this pass in their used resources.
+	quotas []corev1.ResourceQuota
+}
+
+func JobQueueNew(kapi *KubAPI, statePath string) (*JobQueue, error) {
+	ret := JobQueue{KAPI: kapi, StatePath: statePath, MaxActivePerLabel: map[string]int{}, PollInterval: 10 * time.Second}
+
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := jobQueueState{}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("job queue state %s: %w", statePath, err)
+	}
+	ret.items = state.Items
+	ret.sequence = state.Sequence
+	return &ret, nil
+}
+
+// Submit enqueues the job in the active namespace; higher priorities are submitted first.
+func (queue *JobQueue) Submit(job *Job, priority int) (*JobQueueItem, error) {
+	namespace, err := queue.KAPI.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	if job.JobName == nil || job.ContainerImage == nil {
+		return nil, fmt.Errorf("job name and image are required")
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.sequence++
+	item := JobQueueItem{
+		ID:          fmt.Sprintf("%d", queue.sequence),
+		Namespace:   *namespace,
+		Priority:    priority,
+		SubmittedAt: time.Now().UTC(),
+		Job:         *job,
+	}
+	queue.items = append(queue.items, &item)
+	err = queue.save()
+	if err != nil {
+		queue.items = queue.items[:len(queue.items)-1]
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Remove drops a pending item without submitting it.
+func (queue *JobQueue) Remove(id string) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for index, item := range queue.items {
+		if item.ID == id {
+			queue.items = append(queue.items[:index], queue.items[index+1:]...)
+			return queue.save()
+		}
+	}
+	return fmt.Errorf("job queue item %s not found", id)
+}
+
+// Pending returns the queued items in dispatch order.
+func (queue *JobQueue) Pending() []JobQueueItem {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.sort()
+	ret := []JobQueueItem{}
+	for _, item := range queue.items {
+		ret = append(ret, *item)
+	}
+	return ret
+}
+
+func (queue *JobQueue) sort() {
+	sort.SliceStable(queue.items, func(i, j int) bool {
+		if queue.items[i].Priority != queue.items[j].Priority {
+			return queue.items[i].Priority > queue.items[j].Priority
+		}
+		return queue.items[i].SubmittedAt.Before(queue.items[j].SubmittedAt)
+	})
+}
+
+func (queue *JobQueue) save() error {
+	data, err := json.MarshalIndent(jobQueueState{Sequence: queue.sequence, Items: queue.items}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := queue.StatePath + ".tmp"
+	err = os.MkdirAll(filepath.Dir(queue.StatePath), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, queue.StatePath)
+}
+
+// Dispatch submits every pending item that fits the limits and returns how many were created.
+func (queue *JobQueue) Dispatch(ctx context.Context) (int, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.sort()
+
+	capacities := map[string]*namespaceCapacity{}
+	remaining := []*JobQueueItem{}
+	created := 0
+	var errs []error
+
+	for index, item := range queue.items {
+		capacity, ok := capacities[item.Namespace]
+		if !ok {
+			var err error
+			capacity, err = queue.namespaceCapacity(ctx, item.Namespace)
+			if err != nil {
+				errs = append(errs, err)
+				capacity = &namespaceCapacity{quotaBlocked: err.Error()}
+			}
+			capacities[item.Namespace] = capacity
+		}
+
+		reason := queue.blockedReason(capacity, item)
+		if reason != "" {
+			queue.KAPI.log().Debug("job queue item held", slog.String(LogFieldNamespace, item.Namespace), slog.String(LogFieldName, *item.Job.JobName), slog.String("reason", reason))
+			remaining = append(remaining, item)
+			continue
+		}
+
+		api := *queue.KAPI
+		api.Namespace = &item.Namespace
+		job := item.Job
+		err := api.createJob(ctx, &job)
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			errs = append(errs, err)
+			remaining = append(remaining, item)
+			if ctx.Err() != nil {
+				remaining = append(remaining, queue.items[index+1:]...)
+				break
+			}
+			continue
+		}
+
+		created++
+		capacity.reserve(jobQuotaUsage(&item.Job))
+		capacity.active++
+		for _, labelKey := range item.labelKeys() {
+			capacity.activeLabels[labelKey]++
+		}
+	}
+
+	queue.items = remaining
+	err := queue.save()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return created, errors.Join(errs...)
+}
+
+// Run dispatches every PollInterval until ctx is cancelled.
+func (queue *JobQueue) Run(ctx context.Context) error {
+	ticker := time.NewTicker(queue.PollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := queue.Dispatch(ctx)
+		if err != nil {
+			queue.KAPI.log().Warn("job queue dispatch failed", slog.String(LogFieldError, err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (item *JobQueueItem) labelKeys() []string {
+	ret := []string{}
+	if item.Job.Labels == nil {
+		return ret
+	}
+	for key, value := range *item.Job.Labels {
+		ret = append(ret, key+"="+value)
+	}
+	return ret
+}
+
+func (queue *JobQueue) blockedReason(capacity *namespaceCapacity, item *JobQueueItem) string {
+	if capacity.quotaBlocked != "" {
+		return capacity.quotaBlocked
+	}
+	if queue.QuotaThreshold > 0 {
+		if reason := quotaExhaustion(capacity.quotas, queue.QuotaThreshold, jobQuotaUsage(&item.Job)); reason != "" {
+			return reason
+		}
+	}
+	if queue.MaxActivePerNamespace > 0 && capacity.active >= queue.MaxActivePerNamespace {
+		return fmt.Sprintf("%d active jobs in namespace", capacity.active)
+	}
+	for _, labelKey := range item.labelKeys() {
+		limit, ok := queue.MaxActivePerLabel[labelKey]
+		if ok && capacity.activeLabels[labelKey] >= limit {
+			return fmt.Sprintf("%d active jobs with label %s", capacity.activeLabels[labelKey], labelKey)
+		}
+	}
+	return ""
+}
+
+func (queue *JobQueue) namespaceCapacity(ctx context.Context, namespace string) (*namespaceCapacity, error) {
+	kapi := queue.KAPI
+	ret := namespaceCapacity{activeLabels: map[string]int{}}
+
+	op := kapi.startOperation(ctx, "list", "Job", "")
+	op.namespace = namespace
+	jobs, err := kapi.clientset.BatchV1().Jobs(namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	for _, batchJob := range jobs.Items {
+		if IsJobFinished(&batchJob) {
+			continue
+		}
+		ret.active++
+		for key, value := range batchJob.Labels {
+			ret.activeLabels[key+"="+value]++
+		}
+	}
+
+	if queue.QuotaThreshold <= 0 {
+		return &ret, nil
+	}
+	op = kapi.startOperation(ctx, "list", "ResourceQuota", "")
+	op.namespace = namespace
+	quotas, err := kapi.clientset.CoreV1().ResourceQuotas(namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	ret.quotas = quotas.Items
+	return &ret, nil
+}
+
+func (capacity *namespaceCapacity) reserve(usage corev1.ResourceList) {
+	for index := range capacity.quotas {
+		status := &capacity.quotas[index].Status
+		for resourceName, quantity := range usage {
+			if _, ok := status.Hard[resourceName]; !ok {
+				continue
+			}
+			if status.Used == nil {
+				status.Used = corev1.ResourceList{}
+			}
+			used := status.Used[resourceName]
+			used.Add(quantity)
+			status.Used[resourceName] = used
+		}
+	}
+}
+
+// jobQuotaUsage is what admitting the job adds to the quota resources: the requests and limits
+// of its pod times its parallelism, the pods and the job itself.
+func jobQuotaUsage(job *Job) corev1.ResourceList {
+	pods := int64(1)
+	if job.Parallelism != nil {
+		pods = int64(*job.Parallelism)
+	}
+	ret := corev1.ResourceList{
+		corev1.ResourcePods:                     *resource.NewQuantity(pods, resource.DecimalSI),
+		corev1.ResourceName("count/jobs.batch"): *resource.NewQuantity(1, resource.DecimalSI),
+	}
+	add := func(resourceName corev1.ResourceName, quantity resource.Quantity) {
+		total := ret[resourceName]
+		for range pods {
+			total.Add(quantity)
+		}
+		ret[resourceName] = total
+	}
+
+	batchJob, err := job.GenerateBatchJob()
+	if err != nil {
+		return ret
+	}
+	for _, container := range batchJob.Spec.Template.Spec.Containers {
+		for resourceName, quantity := range container.Resources.Requests {
+			// Quotas on cpu, memory and ephemeral-storage count requests, as requests.<name> does.
+			add(resourceName, quantity)
+			add(corev1.ResourceName("requests."+string(resourceName)), quantity)
+		}
+		for resourceName, quantity := range container.Resources.Limits {
+			add(corev1.ResourceName("limits."+string(resourceName)), quantity)
+		}
+	}
+	return ret
+}
+
+// quotaExhaustion describes the quota resources in usage that would be at or above threshold, or
+// over their hard limit, once usage is added. Resources the job does not use are ignored. It is
+// empty when none are exhausted.
+func quotaExhaustion(quotas []corev1.ResourceQuota, threshold float64, usage corev1.ResourceList) string {
+	exhausted := []string{}
+	for _, quota := range quotas {
+		for resourceName, hard := range quota.Status.Hard {
+			required, requested := usage[resourceName]
+			if !requested {
+				continue
+			}
+			used := quota.Status.Used[resourceName]
+			total := used.DeepCopy()
+			total.Add(required)
+			if total.Cmp(hard) > 0 || (!hard.IsZero() && total.AsApproximateFloat64()/hard.AsApproximateFloat64() >= threshold) {
+				exhausted = append(exhausted, fmt.Sprintf("%s/%s %s+%s of %s", quota.Name, resourceName, used.String(), required.String(), hard.String()))
+			}
+		}
+	}
+	sort.Strings(exhausted)
+	if len(exhausted) == 0 {
+		return ""
+	}
+	return "quota near exhaustion: " + strings.Join(exhausted, ", ")
+}
@@ -0,0 +1,176 @@
+package kub_api
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testQueueJob(name string, labels map[string]string) *Job {
+	containerImage := "busybox:1.28"
+	containerCommand := []string{"/bin/sh", "-c", "sleep 5"}
+	return &Job{JobName: &name, ContainerName: &name, ContainerImage: &containerImage, ContainerCommand: &containerCommand, Labels: &labels}
+}
+
+func TestJobQueueDispatch(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset()
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+		statePath := filepath.Join(t.TempDir(), "queue.json")
+
+		queue, err := JobQueueNew(&api, statePath)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		queue.MaxActivePerNamespace = 3
+		queue.MaxActivePerLabel = map[string]int{"team=ml": 1}
+
+		for _, submission := range []struct {
+			name     string
+			team     string
+			priority int
+		}{
+			{"low", "web", 0},
+			{"ml-first", "ml", 5},
+			{"ml-second", "ml", 5},
+			{"high", "web", 10},
+			{"later", "web", 0},
+		} {
+			_, err = queue.Submit(testQueueJob(submission.name, map[string]string{"team": submission.team}), submission.priority)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+
+		created, err := queue.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if created != 3 {
+			t.Errorf("expected 3 jobs created, got %d", created)
+		}
+		for _, name := range []string{"high", "ml-first", "low"} {
+			if _, err = clientset.BatchV1().Jobs(namespace).Get(context.Background(), name, metav1.GetOptions{}); err != nil {
+				t.Errorf("job %s: %v", name, err)
+			}
+		}
+
+		// The pending items survive a restart.
+		restored, err := JobQueueNew(&api, statePath)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		pending := restored.Pending()
+		if len(pending) != 2 || *pending[0].Job.JobName != "ml-second" || *pending[1].Job.JobName != "later" {
+			t.Errorf("unexpected pending items %+v", pending)
+		}
+	})
+
+	t.Run("Quota back-pressure", func(t *testing.T) {
+		namespace := "test"
+		quota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: namespace},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("10")},
+				Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("9500m")},
+			},
+		}
+		clientset := fake.NewSimpleClientset(quota)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		queue, err := JobQueueNew(&api, filepath.Join(t.TempDir(), "queue.json"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		queue.QuotaThreshold = 0.9
+		held := testQueueJob("held", nil)
+		held.ContainerResources = &corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}}
+		_, err = queue.Submit(held, 0)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		created, err := queue.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if created != 0 || len(queue.Pending()) != 1 {
+			t.Errorf("expected the job to be held, created %d", created)
+		}
+	})
+
+	t.Run("Quota includes job requests", func(t *testing.T) {
+		namespace := "test"
+		quota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: namespace},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("10")},
+				Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("8")},
+			},
+		}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(quota)}
+		queue, err := JobQueueNew(&api, filepath.Join(t.TempDir(), "queue.json"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		queue.QuotaThreshold = 1
+		requests := &corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}
+		parallelism := int32(3)
+		wide := testQueueJob("wide", nil)
+		wide.ContainerResources, wide.Parallelism = requests, &parallelism
+		for priority, job := range []*Job{testQueueJob("small-b", nil), testQueueJob("small-a", nil), wide} {
+			job.ContainerResources = requests
+			if _, err = queue.Submit(job, priority); err != nil {
+				t.Fatalf("%v", err)
+			}
+		}
+
+		// 8 used + 3 for wide exceeds 10; small-a fits at 9 and small-b would reach the hard limit.
+		created, err := queue.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		pending := []string{}
+		for _, item := range queue.Pending() {
+			pending = append(pending, *item.Job.JobName)
+		}
+		if created != 1 || len(pending) != 2 || pending[0] != "wide" || pending[1] != "small-b" {
+			t.Errorf("unexpected dispatch, created %d, pending %v", created, pending)
+		}
+	})
+
+	t.Run("Unrelated quota", func(t *testing.T) {
+		namespace := "test"
+		quota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "objects", Namespace: namespace},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourceServices: resource.MustParse("20"), corev1.ResourceConfigMaps: resource.MustParse("20")},
+				Used: corev1.ResourceList{corev1.ResourceServices: resource.MustParse("19"), corev1.ResourceConfigMaps: resource.MustParse("19")},
+			},
+		}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(quota)}
+		queue, err := JobQueueNew(&api, filepath.Join(t.TempDir(), "queue.json"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		queue.QuotaThreshold = 0.9
+		if _, err = queue.Submit(testQueueJob("test", nil), 0); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		// Services and configmaps are at 95% but the job uses neither.
+		created, err := queue.Dispatch(context.Background())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if created != 1 {
+			t.Errorf("expected the job to be admitted, pending %+v", queue.Pending())
+		}
+	})
+}
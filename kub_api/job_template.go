@@ -0,0 +1,363 @@
+package kub_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Parameter types supported by job templates.
+const (
+	JobTemplateParamString = "string"
+	JobTemplateParamInt    = "int"
+	JobTemplateParamBool   = "bool"
+)
+
+// JobTemplate is a YAML description of a Job with typed parameters, e.g.
+//
+//	parameters:
+//	  - name: image
+//	    default: busybox:1.28
+//	  - name: workers
+//	    type: int
+//	    default: 2
+//	job:
+//	  name: "report-{{ .date }}"
+//	  image: "{{ .image }}"
+//	  command: ["/bin/sh", "-c", "echo {{ .date }}"]
+//	  parallelism: "{{ .workers }}"
+//
+// String values are rendered with text/template. A value consisting of a single
+// parameter reference is replaced by the typed parameter value.
+type JobTemplate struct {
+	Parameters []JobTemplateParameter `json:"parameters,omitempty"`
+	Job        map[string]any         `json:"job"`
+}
+
+type JobTemplateParameter struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+}
+
+// JobTemplateSpec is the rendered job section of a template.
+type JobTemplateSpec struct {
+	Name                    string                       `json:"name"`
+	ContainerName           string                       `json:"containerName,omitempty"`
+	Image                   string                       `json:"image"`
+	Command                 []string                     `json:"command,omitempty"`
+	Env                     map[string]string            `json:"env,omitempty"`
+	Resources               *corev1.ResourceRequirements `json:"resources,omitempty"`
+	Parallelism             *int32                       `json:"parallelism,omitempty"`
+	Completions             *int32                       `json:"completions,omitempty"`
+	TTLSecondsAfterFinished *int32                       `json:"ttlSecondsAfterFinished,omitempty"`
+	Labels                  map[string]string            `json:"labels,omitempty"`
+	Annotations             map[string]string            `json:"annotations,omitempty"`
+}
+
+var singleParameterReference = regexp.MustCompile(`^\{\{\s*\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}$`)
+
+func LoadJobTemplate(path string) (*JobTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJobTemplate(data)
+}
+
+func ParseJobTemplate(data []byte) (*JobTemplate, error) {
+	ret := JobTemplate{}
+	err := yaml.UnmarshalStrict(data, &ret)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Job == nil {
+		return nil, fmt.Errorf("job template has no job section")
+	}
+
+	seen := map[string]bool{}
+	for index := range ret.Parameters {
+		parameter := &ret.Parameters[index]
+		if parameter.Name == "" {
+			return nil, fmt.Errorf("job template parameter %d has no name", index)
+		}
+		if seen[parameter.Name] {
+			return nil, fmt.Errorf("job template parameter %s declared twice", parameter.Name)
+		}
+		seen[parameter.Name] = true
+		if parameter.Type == "" {
+			parameter.Type = JobTemplateParamString
+		}
+		switch parameter.Type {
+		case JobTemplateParamString, JobTemplateParamInt, JobTemplateParamBool:
+		default:
+			return nil, fmt.Errorf("job template parameter %s has unknown type %s", parameter.Name, parameter.Type)
+		}
+		if parameter.Pattern != "" {
+			if _, err := regexp.Compile(parameter.Pattern); err != nil {
+				return nil, fmt.Errorf("job template parameter %s: %w", parameter.Name, err)
+			}
+		}
+		if parameter.Default != nil {
+			defaultValue, err := parameter.convert(formatDefault(parameter.Default))
+			if err != nil {
+				return nil, fmt.Errorf("default of %w", err)
+			}
+			parameter.Default = defaultValue
+		}
+	}
+	return &ret, nil
+}
+
+// formatDefault renders a decoded default as a raw value. Numbers decode as float64, which
+// fmt.Sprint prints in exponent form from 1e6 on, e.g. 3600000 as 3.6e+06.
+func formatDefault(value any) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// convert parses a raw --set value according to the parameter type and validates it.
+func (parameter *JobTemplateParameter) convert(raw string) (any, error) {
+	if len(parameter.Enum) > 0 && !slices.Contains(parameter.Enum, raw) {
+		return nil, fmt.Errorf("parameter %s: %q is not one of %v", parameter.Name, raw, parameter.Enum)
+	}
+	if parameter.Pattern != "" && !regexp.MustCompile(parameter.Pattern).MatchString(raw) {
+		return nil, fmt.Errorf("parameter %s: %q does not match %s", parameter.Name, raw, parameter.Pattern)
+	}
+
+	switch parameter.Type {
+	case JobTemplateParamInt:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %q is not an int", parameter.Name, raw)
+		}
+		return value, nil
+	case JobTemplateParamBool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %q is not a bool", parameter.Name, raw)
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+// ResolveValues merges raw values over the parameter defaults.
+func (tmpl *JobTemplate) ResolveValues(values map[string]string) (map[string]any, error) {
+	ret := map[string]any{}
+	declared := map[string]bool{}
+	for index := range tmpl.Parameters {
+		parameter := &tmpl.Parameters[index]
+		declared[parameter.Name] = true
+
+		raw, ok := values[parameter.Name]
+		if !ok {
+			if parameter.Default != nil {
+				ret[parameter.Name] = parameter.Default
+				continue
+			}
+			if parameter.Required {
+				return nil, fmt.Errorf("parameter %s is required", parameter.Name)
+			}
+			ret[parameter.Name] = zeroParameterValue(parameter.Type)
+			continue
+		}
+
+		value, err := parameter.convert(raw)
+		if err != nil {
+			return nil, err
+		}
+		ret[parameter.Name] = value
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", "))
+	}
+	return ret, nil
+}
+
+func zeroParameterValue(parameterType string) any {
+	switch parameterType {
+	case JobTemplateParamInt:
+		return int64(0)
+	case JobTemplateParamBool:
+		return false
+	}
+	return ""
+}
+
+// Render substitutes the values into the job section and returns the Job to submit.
+func (tmpl *JobTemplate) Render(values map[string]string) (*Job, error) {
+	resolved, err := tmpl.ResolveValues(values)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderTemplateValue(tmpl.Job, resolved)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+	spec := JobTemplateSpec{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&spec)
+	if err != nil {
+		return nil, fmt.Errorf("rendered job template: %w", err)
+	}
+
+	return spec.ToJob()
+}
+
+func renderTemplateValue(src any, values map[string]any) (any, error) {
+	switch value := src.(type) {
+	case string:
+		if match := singleParameterReference.FindStringSubmatch(value); match != nil {
+			resolved, ok := values[match[1]]
+			if !ok {
+				return nil, fmt.Errorf("undeclared parameter %s", match[1])
+			}
+			return resolved, nil
+		}
+		parsed, err := template.New("").Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		buffer := strings.Builder{}
+		err = parsed.Execute(&buffer, values)
+		if err != nil {
+			return nil, err
+		}
+		return buffer.String(), nil
+	case map[string]any:
+		ret := map[string]any{}
+		for key, member := range value {
+			rendered, err := renderTemplateValue(member, values)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			ret[key] = rendered
+		}
+		return ret, nil
+	case []any:
+		ret := []any{}
+		for index, member := range value {
+			rendered, err := renderTemplateValue(member, values)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", index, err)
+			}
+			ret = append(ret, rendered)
+		}
+		return ret, nil
+	}
+	return src, nil
+}
+
+func (spec *JobTemplateSpec) Validate() error {
+	if spec.Name == "" {
+		return fmt.Errorf("job name is required")
+	}
+	if spec.Image == "" {
+		return fmt.Errorf("job %s: image is required", spec.Name)
+	}
+	for name, value := range map[string]*int32{"parallelism": spec.Parallelism, "completions": spec.Completions, "ttlSecondsAfterFinished": spec.TTLSecondsAfterFinished} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("job %s: %s must not be negative", spec.Name, name)
+		}
+	}
+	return nil
+}
+
+func (spec *JobTemplateSpec) ToJob() (*Job, error) {
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	containerName := spec.ContainerName
+	if containerName == "" {
+		containerName = spec.Name
+	}
+	command := spec.Command
+	ret := Job{
+		JobName:                 &spec.Name,
+		ContainerName:           &containerName,
+		ContainerImage:          &spec.Image,
+		ContainerCommand:        &command,
+		TTLSecondsAfterFinished: spec.TTLSecondsAfterFinished,
+		ContainerResources:      spec.Resources,
+		Parallelism:             spec.Parallelism,
+		Completions:             spec.Completions,
+	}
+	if len(spec.Env) > 0 {
+		names := []string{}
+		for name := range spec.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		env := []corev1.EnvVar{}
+		for _, name := range names {
+			env = append(env, corev1.EnvVar{Name: name, Value: spec.Env[name]})
+		}
+		ret.ContainerEnv = &env
+	}
+	if spec.Labels != nil {
+		ret.Labels = &spec.Labels
+	}
+	if spec.Annotations != nil {
+		ret.Annotations = &spec.Annotations
+	}
+	return &ret, nil
+}
+
+// CreateJobFromTemplate renders the template with values and submits it with CreateJob.
+func (kapi *KubAPI) CreateJobFromTemplate(tmpl *JobTemplate, values map[string]string) (*Job, error) {
+	job, err := tmpl.Render(values)
+	if err != nil {
+		return nil, err
+	}
+	err = kapi.CreateJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ParseSetValues parses key=value pairs as given to --set.
+func ParseSetValues(pairs []string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
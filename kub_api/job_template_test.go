@@ -0,0 +1,120 @@
+package kub_api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testJobTemplate = `
+parameters:
+  - name: date
+    required: true
+    pattern: "^[0-9]{8}$"
+  - name: image
+    default: busybox:1.28
+  - name: workers
+    type: int
+    default: 2
+  - name: mode
+    enum: [full, incremental]
+    default: full
+job:
+  name: "report-{{ .date }}"
+  image: "{{ .image }}"
+  command: ["/bin/sh", "-c", "echo {{ .mode }} report for {{ .date }}"]
+  env:
+    MODE: "{{ .mode }}"
+  resources:
+    requests:
+      cpu: 100m
+      memory: 64Mi
+  parallelism: "{{ .workers }}"
+  ttlSecondsAfterFinished: 60
+`
+
+func TestJobTemplateRender(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "job.yaml")
+		if err := os.WriteFile(path, []byte(testJobTemplate), 0600); err != nil {
+			t.Fatalf("%v", err)
+		}
+		tmpl, err := LoadJobTemplate(path)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		values, err := ParseSetValues([]string{"date=20261018", "workers=5"})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		job, err := tmpl.Render(values)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if *job.JobName != "report-20261018" || *job.ContainerName != "report-20261018" || *job.ContainerImage != "busybox:1.28" {
+			t.Errorf("unexpected job %+v", job)
+		}
+		if (*job.ContainerCommand)[2] != "echo full report for 20261018" {
+			t.Errorf("unexpected command %v", *job.ContainerCommand)
+		}
+		if *job.Parallelism != 5 || *job.TTLSecondsAfterFinished != 60 {
+			t.Errorf("unexpected parallelism %d", *job.Parallelism)
+		}
+
+		batchJob, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		container := batchJob.Spec.Template.Spec.Containers[0]
+		if container.Resources.Requests.Cpu().String() != "100m" || container.Env[0].Value != "full" {
+			t.Errorf("unexpected container %+v", container)
+		}
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		tmpl, err := ParseJobTemplate([]byte(testJobTemplate))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		for _, values := range []map[string]string{
+			{},
+			{"date": "yesterday"},
+			{"date": "20261018", "workers": "many"},
+			{"date": "20261018", "mode": "partial"},
+			{"date": "20261018", "unknown": "1"},
+		} {
+			if _, err := tmpl.Render(values); err == nil {
+				t.Errorf("expected error for %v", values)
+			}
+		}
+	})
+}
+
+func TestParseJobTemplateLargeDefault(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		tmpl, err := ParseJobTemplate([]byte(`
+parameters:
+  - name: timeout
+    type: int
+    default: 3600000
+  - name: label
+    default: 1000000
+job:
+  name: "timeout-{{ .timeout }}"
+  image: busybox:1.28
+  env:
+    LABEL: "{{ .label }}"
+`))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		values, err := tmpl.ResolveValues(map[string]string{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if values["timeout"] != int64(3600000) || values["label"] != "1000000" {
+			t.Errorf("unexpected values %v", values)
+		}
+	})
+}
@@ -4,25 +4,42 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"os"
+	"log/slog"
+	"maps"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
 type KubAPI struct {
 	Kubeconfig *string
-	clientset  *kubernetes.Clientset
+	clientset  kubernetes.Interface
 	Namespace  *string
+	Logger     *slog.Logger
+	Auditor    *Auditor
+	Metrics    *Metrics
+	// TracerProvider defaults to the global OpenTelemetry provider.
+	TracerProvider trace.TracerProvider
+
+	restConfig    *rest.Config
+	dynamicClient dynamic.Interface
+	executor      podExecutor
+	portForwarder podPortForwarder
 }
 
 type Job struct {
@@ -31,7 +48,24 @@ type Job struct {
 	ContainerImage          *string
 	ContainerCommand        *[]string
 	TTLSecondsAfterFinished *int32
-	UID                     *types.UID
+	ContainerEnv            *[]corev1.EnvVar
+	ContainerEnvFrom        *[]corev1.EnvFromSource
+	ContainerResources      *corev1.ResourceRequirements
+	ContainerVolumeMounts   *[]corev1.VolumeMount
+	Volumes                 *[]corev1.Volume
+	ImagePullSecrets        *[]corev1.LocalObjectReference
+	Parallelism             *int32
+	Completions             *int32
+	Suspend                 *bool
+	BackoffLimit            *int32
+	ActiveDeadlineSeconds   *int64
+	PodFailurePolicy        *batchv1.PodFailurePolicy
+	// ArtifactsDir adds a shared volume at this path and a sidecar keeping the pod alive for CollectArtifacts.
+	ArtifactsDir              *string
+	ArtifactsKeepAliveSeconds *int32
+	Labels                    *map[string]string
+	Annotations               *map[string]string
+	UID                       *types.UID
 }
 
 func (job *Job) GenerateBatchJob() (ret *batchv1.Job, err error) {
@@ -42,23 +76,59 @@ func (job *Job) GenerateBatchJob() (ret *batchv1.Job, err error) {
 		},
 		Spec: batchv1.JobSpec{
 			TTLSecondsAfterFinished: job.TTLSecondsAfterFinished,
-			Template: corev1.PodTemplateSpec{
-				Spec: corev1.PodSpec{
-					RestartPolicy: corev1.RestartPolicyOnFailure, // Recommended for Jobs
-					Containers: []corev1.Container{
-						{
-							Name:    *job.ContainerName,
-							Image:   *job.ContainerImage,
-							Command: *job.ContainerCommand,
-						},
-					},
-				},
-			},
+			Parallelism:             job.Parallelism,
+			Completions:             job.Completions,
+			Suspend:                 job.Suspend,
+			BackoffLimit:            job.BackoffLimit,
+			ActiveDeadlineSeconds:   job.ActiveDeadlineSeconds,
+			PodFailurePolicy:        job.PodFailurePolicy,
+			Template:                corev1.PodTemplateSpec{Spec: job.generatePodSpec()},
 		},
 	}
+	ret.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyOnFailure // Recommended for Jobs
+	if job.PodFailurePolicy != nil {
+		// The API server accepts a pod failure policy only with restartPolicy Never.
+		ret.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+	if job.Labels != nil {
+		ret.ObjectMeta.Labels = *job.Labels
+		ret.Spec.Template.ObjectMeta.Labels = maps.Clone(*job.Labels)
+	}
+	if job.Annotations != nil {
+		ret.ObjectMeta.Annotations = *job.Annotations
+	}
+	job.addArtifactsSidecar(ret)
 	return ret, nil
 }
 
+// generatePodSpec builds the pod spec from the container options, shared by jobs and workloads.
+func (job *Job) generatePodSpec() corev1.PodSpec {
+	container := corev1.Container{Name: *job.ContainerName, Image: *job.ContainerImage}
+	if job.ContainerCommand != nil {
+		container.Command = *job.ContainerCommand
+	}
+	if job.ContainerEnv != nil {
+		container.Env = *job.ContainerEnv
+	}
+	if job.ContainerEnvFrom != nil {
+		container.EnvFrom = *job.ContainerEnvFrom
+	}
+	if job.ContainerResources != nil {
+		container.Resources = *job.ContainerResources
+	}
+	if job.ContainerVolumeMounts != nil {
+		container.VolumeMounts = append([]corev1.VolumeMount{}, *job.ContainerVolumeMounts...)
+	}
+	ret := corev1.PodSpec{Containers: []corev1.Container{container}}
+	if job.Volumes != nil {
+		ret.Volumes = append([]corev1.Volume{}, *job.Volumes...)
+	}
+	if job.ImagePullSecrets != nil {
+		ret.ImagePullSecrets = append([]corev1.LocalObjectReference{}, *job.ImagePullSecrets...)
+	}
+	return ret
+}
+
 func KubAPINew() (*KubAPI, error) {
 	var kubeconfig *string
 	if home := homedir.HomeDir(); home != "" {
@@ -74,21 +144,23 @@ func KubAPINew() (*KubAPI, error) {
 
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
-		fmt.Printf("Error building kubeconfig: %v\n", err)
 		//config, err = clientcmd.InClusterConfig()
-		if err != nil {
-			fmt.Printf("Error building in-cluster config: %v\n", err)
-			os.Exit(1)
-		}
+		return nil, fmt.Errorf("error building kubeconfig: %w", err)
 	}
 
 	// Create a Kubernetes kapi.clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("Error creating kapi.clientset: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error creating clientset: %w", err)
 	}
 	ret.clientset = clientset
+	ret.restConfig = config
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic client: %w", err)
+	}
+	ret.dynamicClient = dynamicClient
 
 	return &ret, nil
 }
@@ -96,9 +168,10 @@ func KubAPINew() (*KubAPI, error) {
 func (kapi *KubAPI) GetPods() ([]corev1.Pod, error) {
 
 	// List pods in the specified namespace
-	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(context.TODO(), metav1.ListOptions{})
+	op := kapi.startOperation(context.TODO(), "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error listing pods in namespace '%s': %v\n", *kapi.Namespace, err)
 		return nil, err
 	}
 
@@ -107,9 +180,10 @@ func (kapi *KubAPI) GetPods() ([]corev1.Pod, error) {
 
 func (kapi *KubAPI) GetNamespaces() ([]corev1.Namespace, error) {
 	// List pods in the specified namespace
-	namespaces, err := kapi.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	op := kapi.startOperation(context.TODO(), "list", "Namespace", "")
+	namespaces, err := kapi.clientset.CoreV1().Namespaces().List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error listing namespaces: %v\n", err)
 		return nil, err
 	}
 
@@ -124,137 +198,256 @@ func (kapi *KubAPI) GetActiveNamespace() (ret *string, err error) {
 }
 
 func (kapi *KubAPI) CreateJob(job *Job) error {
+	return kapi.createJob(context.TODO(), job)
+}
+
+func (kapi *KubAPI) createJob(ctx context.Context, job *Job) error {
 	namespace, err := kapi.GetActiveNamespace()
 	if err != nil {
 		return err
 	}
 	batchJob, err := job.GenerateBatchJob()
+	if err != nil {
+		return err
+	}
 	batchJob.ObjectMeta.Namespace = *namespace
 
-	createdJob, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Create(context.TODO(), batchJob, metav1.CreateOptions{})
-
+	op := kapi.startOperation(ctx, "create", "Job", *job.JobName)
+	op.setDiff(batchJob)
+	createdJob, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Create(op.ctx, batchJob, metav1.CreateOptions{})
 	if err != nil {
-		fmt.Printf("Error Creating Job: %v\n", err)
+		kapi.finishOperation(op, err)
 		return err
 	}
 	job.UID = &createdJob.UID
-	fmt.Printf("Job created successfully! Name: %s, Namespace: %s\n", createdJob.Name, createdJob.Namespace)
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(createdJob.UID)))
 	return nil
 }
 
 func (kapi *KubAPI) DeleteJob(job *Job) error {
-	namespace, err := kapi.GetActiveNamespace()
+	_, err := kapi.GetActiveNamespace()
 	if err != nil {
 		return err
 	}
-	batchJob, err := job.GenerateBatchJob()
-	batchJob.ObjectMeta.Namespace = *namespace
 
-	err = kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Delete(context.TODO(), *job.JobName, metav1.DeleteOptions{})
+	return kapi.deleteJob(context.TODO(), *job.JobName, "")
+}
 
+// deleteJob deletes the job with the given propagation policy, the server default when empty.
+func (kapi *KubAPI) deleteJob(ctx context.Context, name string, propagationPolicy metav1.DeletionPropagation) error {
+	deleteOptions := metav1.DeleteOptions{}
+	if propagationPolicy != "" {
+		deleteOptions.PropagationPolicy = &propagationPolicy
+	}
+	op := kapi.startOperation(ctx, "delete", "Job", name)
+	err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Delete(op.ctx, name, deleteOptions)
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error listing namespaces: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
-	fmt.Printf("Job deleted successfully! Name: %s, Namespace: %s\n", *job.JobName, *kapi.Namespace)
 	return nil
 }
 
+// CreatePod creates the pod with ordinal podID of the pod group of an existing job.
+// Use CreatePodGroup to create the whole group with its headless Service.
 func (kapi *KubAPI) CreatePod(job *Job, podID string) error {
-	podName := fmt.Sprintf("%s-%s-%s", *job.JobName, *job.JobName, podID)
-	batchv1JobP, err := kapi.Getbatchv1Job(job)
+	ordinal, err := strconv.Atoi(podID)
+	if err != nil || ordinal < 0 {
+		return fmt.Errorf("pod id %q is not an ordinal", podID)
+	}
+	owner, err := kapi.Getbatchv1Job(job)
 	if err != nil {
 		return err
 	}
+	return kapi.createPodGroupPod(context.TODO(), owner, ordinal, 0)
+}
 
-	// Add a label to the pod template that indicates the pod ordinal.
-	if batchv1JobP.Spec.Template.ObjectMeta.Labels == nil {
-		batchv1JobP.Spec.Template.ObjectMeta.Labels = make(map[string]string)
+const (
+	podPruneMinBackoff = 500 * time.Millisecond
+	podPruneMaxBackoff = 30 * time.Second
+)
+
+// PrunePods deletes the finished pods of the job until none of the pods it had when called is left.
+// Pods deleted by someone else count as pruned. The pods are listed again whenever the server closes
+// the watch, backing off between reconnects, until ctx is cancelled.
+func (kapi *KubAPI) PrunePods(ctx context.Context, jobName *string) error {
+	listOptions := metav1.ListOptions{
+		LabelSelector: "job-name=" + *jobName, // Select pods created by this job
 	}
-	batchv1JobP.Spec.Template.ObjectMeta.Labels["controller-type"] = "job"
+	var pending map[string]bool
+	backoff := podPruneMinBackoff
 
-	//create pod object.
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
-			Namespace: *kapi.Namespace,
-			Labels: map[string]string{
-				"job-name":       *job.JobName,
-				"controller-uid": string(batchv1JobP.UID),
-			},
-			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(batchv1JobP, batchv1.SchemeGroupVersion.WithKind("Job")),
-			},
-		},
-		Spec: batchv1JobP.Spec.Template.Spec, //use the pod spec from the job
-	}
-	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
-		Name: "POD_ORDINAL",
-		ValueFrom: &corev1.EnvVarSource{
-			FieldRef: &corev1.ObjectFieldSelector{
-				FieldPath: "metadata.labels['job-index']", // Get the ordinal from the label
-			},
-		},
-	})
+	for {
+		op := kapi.startOperation(ctx, "list", "Pod", "")
+		allPods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, listOptions)
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return err
+		}
+		listed := map[string]bool{}
+		for _, pod := range allPods.Items {
+			listed[pod.Name] = true
+		}
+		if pending == nil {
+			pending = listed
+		}
+		for name := range pending {
+			if !listed[name] {
+				delete(pending, name)
+			}
+		}
+		for i := range allPods.Items {
+			kapi.prunePod(ctx, &allPods.Items[i], pending)
+		}
+		if len(pending) == 0 {
+			break
+		}
 
-	corev1Pod, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
-	if err != nil && !strings.Contains(err.Error(), "already exists") {
-		fmt.Printf("Error creating pod %s: %v\n", podName, err)
-		return err
-	}
-	_ = corev1Pod
+		watchOptions := listOptions
+		watchOptions.ResourceVersion = allPods.ResourceVersion
+		op = kapi.startOperation(ctx, "watch", "Pod", "")
+		podWatch, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Watch(op.ctx, watchOptions)
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return err
+		}
+		received := kapi.handlePruneWatch(ctx, podWatch, pending)
+		podWatch.Stop()
+		if len(pending) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if received {
+			backoff = podPruneMinBackoff
+		}
+		kapi.observeWatchReconnect("Pod")
 
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, podPruneMaxBackoff)
+	}
+	kapi.log().Info("all pods have been deleted", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String("job", *jobName))
 	return nil
 }
 
-func (kapi *KubAPI) PrunePods(jobName *string) error {
-	allPods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: "job-name=" + *jobName, // Select pods created by this job
-	})
-	podCount := len(allPods.Items)
-	_ = allPods
-	podWatch, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Watch(context.TODO(), metav1.ListOptions{
-		LabelSelector: "job-name=" + *jobName, // Select pods created by this job
-	})
-	if err != nil {
-		return err
-	}
-	defer podWatch.Stop()
-	podsDeleted := 0
-	for event := range podWatch.ResultChan() {
+// handlePruneWatch prunes the pending pods as they finish until the watch closes, fails, ctx is
+// cancelled or no pod is pending. It reports whether any event was received.
+func (kapi *KubAPI) handlePruneWatch(ctx context.Context, podWatch watch.Interface, pending map[string]bool) bool {
+	received := false
+	for len(pending) > 0 {
+		var event watch.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return received
+		case event, ok = <-podWatch.ResultChan():
+			if !ok {
+				return received
+			}
+		}
+		if event.Type == watch.Error {
+			return received
+		}
+		received = true
 		pod, ok := event.Object.(*corev1.Pod)
 		if !ok {
-			fmt.Printf("Unexpected type from Pod watcher: %v\n", event.Object)
+			kapi.log().Warn("unexpected type from Pod watcher", slog.String("type", fmt.Sprintf("%T", event.Object)))
 			continue // Don't exit, just skip this event
 		}
+		if event.Type == watch.Deleted {
+			delete(pending, pod.Name)
+			continue
+		}
+		kapi.prunePod(ctx, pod, pending)
+	}
+	return received
+}
+
+// prunePod deletes the pod when it is pending and finished.
+func (kapi *KubAPI) prunePod(ctx context.Context, pod *corev1.Pod, pending map[string]bool) {
+	if !pending[pod.Name] {
+		return
+	}
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded, corev1.PodFailed:
+		deletePolicy := metav1.DeletePropagationForeground
+		op := kapi.startOperation(ctx, "delete", "Pod", pod.Name)
+		err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Delete(op.ctx, pod.Name, metav1.DeleteOptions{
+			PropagationPolicy: &deletePolicy,
+		})
+		if apierrors.IsNotFound(err) {
+			// Deleted by someone else in the meantime.
+			kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(pod.UID)), slog.String("phase", string(pod.Status.Phase)))
+			delete(pending, pod.Name)
+			return
+		}
+		// Log the error and continue, don't exit.  Deletion might fail due to network issues,
+		// but we want to try to delete other pods.
+		kapi.finishOperation(op, err, slog.String(LogFieldUID, string(pod.UID)), slog.String("phase", string(pod.Status.Phase)))
+		if err == nil {
+			delete(pending, pod.Name)
+			kapi.observePodPruned()
+		}
+	}
+}
 
-		switch pod.Status.Phase {
-		case corev1.PodSucceeded, corev1.PodFailed:
-			fmt.Printf("Pod %s finished with status: %s, deleting...\n", pod.Name, pod.Status.Phase)
-			deletePolicy := metav1.DeletePropagationForeground
-			err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{
-				PropagationPolicy: &deletePolicy,
-			})
-			if err != nil {
-				fmt.Printf("Error deleting Pod %s: %v\n", pod.Name, err)
-				// Log the error and continue, don't exit.  Deletion might fail due to network issues,
-				// but we want to try to delete other pods.
-			} else {
-				podsDeleted++
-				fmt.Printf("Deleted Pod %s\n", pod.Name)
+// WaitForJob blocks until the job completes or fails and returns its final state.
+func (kapi *KubAPI) WaitForJob(ctx context.Context, name string) (*batchv1.Job, error) {
+	for {
+		op := kapi.startOperation(ctx, "get", "Job", name)
+		batchJob, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+		if IsJobFinished(batchJob) {
+			kapi.observeJobFinished(batchJob)
+			return batchJob, nil
+		}
+
+		listOptions := metav1.ListOptions{FieldSelector: "metadata.name=" + name, ResourceVersion: batchJob.ResourceVersion}
+		jobWatch, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Watch(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+		for event := range jobWatch.ResultChan() {
+			batchJob, ok := event.Object.(*batchv1.Job)
+			if !ok || batchJob.Name != name {
+				continue
+			}
+			if IsJobFinished(batchJob) {
+				jobWatch.Stop()
+				kapi.observeJobFinished(batchJob)
+				return batchJob, nil
 			}
 		}
-		if podsDeleted >= int(podCount) {
-			fmt.Println("All pods have been deleted.")
-			break
+		jobWatch.Stop()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		kapi.observeWatchReconnect("Job")
 	}
-	return nil
+}
+
+func IsJobFinished(batchJob *batchv1.Job) bool {
+	for _, condition := range batchJob.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
 }
 
 func (kapi *KubAPI) Getbatchv1Job(job *Job) (*batchv1.Job, error) {
-	ret, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Get(context.TODO(), *job.JobName, metav1.GetOptions{})
+	op := kapi.startOperation(context.TODO(), "get", "Job", *job.JobName)
+	ret, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Get(op.ctx, *job.JobName, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
 	return ret, err
 }
 
@@ -276,41 +469,20 @@ func (kapi *KubAPI) GetLogs() {
 	*/
 }
 
+// CreateService creates a ClusterIP service with a single TCP port named http.
+// Use ProvisionService for other service shapes.
 func (kapi *KubAPI) CreateService(serviceName *string, port int32, selector map[string]string) error {
-	// Create the Service
-	// Define the Service object
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      *serviceName,
-			Namespace: *kapi.Namespace,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: selector,
-			Ports: []corev1.ServicePort{
-				{
-					Name:     "http",
-					Port:     port,
-					Protocol: corev1.ProtocolTCP,
-				},
-			},
-			Type: corev1.ServiceTypeClusterIP, // Use a ClusterIP for internal access
-		},
-	}
-	createdService, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Create(context.TODO(), service, metav1.CreateOptions{})
-	if err != nil {
-		fmt.Printf("Error creating Service: %v\n", err)
-		return err
-	}
-
-	fmt.Printf("Service created successfully! Name: %s, Namespace: %s\n", createdService.Name, createdService.Namespace)
-	return nil
+	ports := []corev1.ServicePort{ServicePortNew("http", port, "", corev1.ProtocolTCP)}
+	_, err := kapi.provisionService(context.TODO(), *kapi.Namespace, &Service{ServiceName: serviceName, Ports: &ports, Selector: &selector})
+	return err
 }
 
 func (kapi *KubAPI) GetServices() (ret []corev1.Service, err error) {
 	// List Services in the specified namespace
-	services, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).List(context.TODO(), metav1.ListOptions{})
+	op := kapi.startOperation(context.TODO(), "list", "Service", "")
+	services, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error listing Services in namespace '%s': %v\n", *kapi.Namespace, err)
 		return nil, err
 	}
 
@@ -319,9 +491,10 @@ func (kapi *KubAPI) GetServices() (ret []corev1.Service, err error) {
 
 func (kapi *KubAPI) GetIngresses() ([]networkingv1.Ingress, error) {
 	// List Services in the specified namespace
-	ingressList, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).List(context.TODO(), metav1.ListOptions{})
+	op := kapi.startOperation(context.TODO(), "list", "Ingress", "")
+	ingressList, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error listing Ingresses in namespace %s: %v\n", *kapi.Namespace, err)
 		return nil, err
 	}
 
@@ -331,12 +504,13 @@ func (kapi *KubAPI) GetIngresses() ([]networkingv1.Ingress, error) {
 func (kapi *KubAPI) CreateServiceAccount(serviceAccount *corev1.ServiceAccount) error {
 	// List Services in the specified namespace
 
-	_, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Create(context.TODO(), serviceAccount, metav1.CreateOptions{})
+	op := kapi.startOperation(context.TODO(), "create", "ServiceAccount", serviceAccount.Name)
+	op.setDiff(serviceAccount)
+	_, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Create(op.ctx, serviceAccount, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error creating Service Account: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	fmt.Println("Service Account created successfully")
 
 	return nil
 }
@@ -345,12 +519,13 @@ func (kapi *KubAPI) ProvisionRole(role *rbacv1.Role) error {
 	// List Services in the specified namespace
 	// 2. Create a Role
 
-	_, err := kapi.clientset.RbacV1().Roles(*kapi.Namespace).Create(context.TODO(), role, metav1.CreateOptions{})
+	op := kapi.startOperation(context.TODO(), "create", "Role", role.Name)
+	op.setDiff(role)
+	_, err := kapi.clientset.RbacV1().Roles(*kapi.Namespace).Create(op.ctx, role, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error creating Role: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	fmt.Println("Role created successfully")
 	return nil
 }
 
@@ -358,24 +533,26 @@ func (kapi *KubAPI) ProvisionServiceAccount(serviceAccount *corev1.ServiceAccoun
 	// List Services in the specified namespace
 	// 2. Create a Role
 
-	_, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Create(context.TODO(), serviceAccount, metav1.CreateOptions{})
+	op := kapi.startOperation(context.TODO(), "create", "ServiceAccount", serviceAccount.Name)
+	op.setDiff(serviceAccount)
+	_, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Create(op.ctx, serviceAccount, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error creating Role: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	fmt.Println("Service Account created successfully")
 	return nil
 }
 
 func (kapi *KubAPI) ProvisionRoleBinding(roleBinding *rbacv1.RoleBinding) error {
 	// 3. Create a RoleBinding
 
-	_, err := kapi.clientset.RbacV1().RoleBindings(*kapi.Namespace).Create(context.TODO(), roleBinding, metav1.CreateOptions{})
+	op := kapi.startOperation(context.TODO(), "create", "RoleBinding", roleBinding.Name)
+	op.setDiff(roleBinding)
+	_, err := kapi.clientset.RbacV1().RoleBindings(*kapi.Namespace).Create(op.ctx, roleBinding, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
 	if err != nil {
-		fmt.Printf("Error creating RoleBinding: %v\n", err)
-		os.Exit(1)
+		return err
 	}
-	fmt.Println("RoleBinding created successfully")
 	return nil
 }
 
@@ -386,11 +563,14 @@ func (kapi *KubAPI) ProvisionNamespace(name *string) error {
 		},
 	}
 
-	namespace, err := kapi.clientset.CoreV1().Namespaces().Create(context.TODO(), namespace, metav1.CreateOptions{})
+	op := kapi.startOperation(context.TODO(), "create", "Namespace", *name)
+	op.setDiff(namespace)
+	namespace, err := kapi.clientset.CoreV1().Namespaces().Create(op.ctx, namespace, metav1.CreateOptions{})
 	if err != nil {
-		fmt.Printf("Created namespace: %s, %s\n", *name, namespace.UID)
+		kapi.finishOperation(op, err)
 		return err
 	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(namespace.UID)))
 
 	return nil
 }
@@ -1,12 +1,21 @@
 package kub_api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func LoadDynamicConfig() (config any, err error) {
@@ -192,7 +201,7 @@ func TestPrunePods(t *testing.T) {
 		}
 		api.Namespace = realConfig.Namespace
 		jobName := "test"
-		api.PrunePods(&jobName)
+		api.PrunePods(context.Background(), &jobName)
 
 		if err != nil {
 			t.Errorf("%v", err)
@@ -200,6 +209,66 @@ func TestPrunePods(t *testing.T) {
 	})
 }
 
+func TestPrunePodsTerminates(t *testing.T) {
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test", Labels: map[string]string{"job-name": "test"}},
+			Status: corev1.PodStatus{Phase: phase}}
+	}
+
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(pod("test-a", corev1.PodSucceeded), pod("test-b", corev1.PodRunning), pod("test-c", corev1.PodRunning))
+		clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			watcher := watch.NewFakeWithChanSize(2, false)
+			// test-b is deleted by someone else, test-c finishes.
+			watcher.Delete(pod("test-b", corev1.PodRunning))
+			watcher.Modify(pod("test-c", corev1.PodFailed))
+			return true, watcher, nil
+		})
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		jobName := "test"
+		err := api.PrunePods(context.Background(), &jobName)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		var deleted []string
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "delete" {
+				deleted = append(deleted, action.(k8stesting.DeleteAction).GetName())
+			}
+		}
+		if fmt.Sprint(deleted) != "[test-a test-c]" {
+			t.Errorf("unexpected deleted pods %v", deleted)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset(pod("test-a", corev1.PodRunning))
+		watches := 0
+		clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			watches++
+			// The server closes the watch right away.
+			watcher := watch.NewFake()
+			watcher.Stop()
+			return true, watcher, nil
+		})
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		jobName := "test"
+		err := api.PrunePods(ctx, &jobName)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline error, got %v", err)
+		}
+		if watches != 1 {
+			t.Errorf("expected reconnects to back off, got %d watches", watches)
+		}
+	})
+}
+
 func TestProvisionNamespace(t *testing.T) {
 	t.Run("Valid run", func(t *testing.T) {
 		realConfig := loadRealConfig()
@@ -318,8 +387,8 @@ func TestGetAllIngresses(t *testing.T) {
 				t.Errorf("%v", err)
 			}
 			for _, ingress := range ret {
-				fmt.Printf("Ingress: %s, IngressClassName: %s\n ", *&ingress.Name, *ingress.Spec.IngressClassName)
-				if *ingress.Spec.IngressClassName == "nginx-public" {
+				fmt.Printf("Ingress: %s, IngressClassName: %s\n ", ingress.Name, IngressClass(&ingress))
+				if IngressClass(&ingress) == "nginx-public" {
 					fmt.Print(ingress.String())
 				}
 			}
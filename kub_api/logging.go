@@ -0,0 +1,210 @@
+package kub_api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AlexeyBeley/go_common/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Structured field names attached to every log record.
+const (
+	LogFieldNamespace = "namespace"
+	LogFieldKind      = "kind"
+	LogFieldName      = "name"
+	LogFieldUID       = "uid"
+	LogFieldDuration  = "duration"
+	LogFieldError     = "error"
+)
+
+// operation tracks a single call against the API server for logging, auditing and metrics.
+type operation struct {
+	ctx       context.Context
+	span      trace.Span
+	method    string
+	verb      string
+	kind      string
+	namespace string
+	name      string
+	start     time.Time
+	end       time.Time
+	diff      []byte
+}
+
+func (op *operation) duration() time.Duration {
+	if op.end.IsZero() {
+		return time.Since(op.start)
+	}
+	return op.end.Sub(op.start)
+}
+
+func (kapi *KubAPI) SetLogger(lg *slog.Logger) {
+	kapi.Logger = lg
+}
+
+func (kapi *KubAPI) SetLogHandler(handler slog.Handler) {
+	kapi.Logger = slog.New(handler)
+}
+
+// log returns the configured logger; KubAPI is silent unless one was set.
+func (kapi *KubAPI) log() *slog.Logger {
+	if kapi.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return kapi.Logger
+}
+
+// setDiff records the object or patch body sent by a mutation for the audit trail.
+func (op *operation) setDiff(src any) {
+	if data, ok := src.([]byte); ok {
+		op.diff = data
+		return
+	}
+	data, err := json.Marshal(src)
+	if err == nil {
+		op.diff = data
+	}
+}
+
+func (kapi *KubAPI) startOperation(ctx context.Context, verb, kind, name string) *operation {
+	op := &operation{ctx: ctx, verb: verb, kind: kind, name: name, start: time.Now()}
+	// The calling KubAPI method names the operation, e.g. "CreateJob" for both CreateJob and createJob.
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		funcName := runtime.FuncForPC(pc).Name()
+		funcName = funcName[strings.LastIndex(funcName, ".")+1:]
+		op.method = strings.ToUpper(funcName[:1]) + funcName[1:]
+	}
+	if kind != "Namespace" && kapi.Namespace != nil {
+		op.namespace = *kapi.Namespace
+	}
+	kapi.startSpan(op)
+	return op
+}
+
+func (kapi *KubAPI) finishOperation(op *operation, err error, attrs ...slog.Attr) {
+	op.end = time.Now()
+	endSpan(op.span, err)
+	kapi.audit(op, err)
+	if kapi.Metrics != nil {
+		kapi.Metrics.observeOperation(op, err)
+	}
+
+	attrs = append(attrs,
+		slog.String(LogFieldNamespace, op.namespace),
+		slog.String(LogFieldKind, op.kind),
+		slog.String(LogFieldName, op.name),
+		slog.Duration(LogFieldDuration, op.duration()),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.String(LogFieldError, err.Error()))
+		kapi.log().LogAttrs(op.ctx, slog.LevelError, op.verb+" "+op.kind+" failed", attrs...)
+		return
+	}
+
+	level := slog.LevelInfo
+	switch op.verb {
+	case "get", "list", "watch":
+		level = slog.LevelDebug
+	}
+	kapi.log().LogAttrs(op.ctx, level, op.verb+" "+op.kind, attrs...)
+}
+
+// goCommonHandler adapts a go_common logger to slog.Handler.
+type goCommonHandler struct {
+	lg     *logger.Logger
+	attrs  []slog.Attr
+	groups []string
+}
+
+func NewGoCommonLogHandler(lg *logger.Logger) slog.Handler {
+	return &goCommonHandler{lg: lg}
+}
+
+func (handler *goCommonHandler) Enabled(_ context.Context, level slog.Level) bool {
+	switch {
+	case level >= slog.LevelError:
+		return handler.lg.Level <= logger.ERROR
+	case level >= slog.LevelWarn:
+		return handler.lg.Level <= logger.WARNING
+	case level >= slog.LevelInfo:
+		return handler.lg.Level <= logger.INFO
+	default:
+		return handler.lg.Level <= logger.DEBUG
+	}
+}
+
+func (handler *goCommonHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := map[string]any{"Message": record.Message}
+	for _, attr := range handler.attrs {
+		addLogField(fields, "", attr)
+	}
+	prefix := ""
+	for _, group := range handler.groups {
+		prefix += group + "."
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addLogField(fields, prefix, attr)
+		return true
+	})
+
+	if record.Level >= slog.LevelInfo && record.Level < slog.LevelWarn {
+		handler.lg.InfoM(fields)
+		return nil
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	switch {
+	case record.Level >= slog.LevelError:
+		handler.lg.Errorf("%s", data)
+	case record.Level >= slog.LevelWarn:
+		handler.lg.Warningf("%s", data)
+	default:
+		handler.lg.Debugf("%s", data)
+	}
+	return nil
+}
+
+func (handler *goCommonHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := ""
+	for _, group := range handler.groups {
+		prefix += group + "."
+	}
+	ret := &goCommonHandler{lg: handler.lg, groups: handler.groups}
+	ret.attrs = append(ret.attrs, handler.attrs...)
+	for _, attr := range attrs {
+		ret.attrs = append(ret.attrs, slog.Attr{Key: prefix + attr.Key, Value: attr.Value})
+	}
+	return ret
+}
+
+func (handler *goCommonHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	ret := &goCommonHandler{lg: handler.lg, attrs: handler.attrs}
+	ret.groups = append(append([]string{}, handler.groups...), name)
+	return ret
+}
+
+func addLogField(fields map[string]any, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, member := range value.Group() {
+			addLogField(fields, prefix+attr.Key+".", member)
+		}
+		return
+	}
+	if value.Kind() == slog.KindDuration {
+		fields[prefix+attr.Key] = value.Duration().String()
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
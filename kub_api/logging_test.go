@@ -0,0 +1,57 @@
+package kub_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/AlexeyBeley/go_common/logger"
+)
+
+func TestFinishOperation(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		buffer := bytes.Buffer{}
+		api := KubAPI{Namespace: &namespace}
+		api.SetLogHandler(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		op := api.startOperation(context.Background(), "create", "Job", "test")
+		api.finishOperation(op, errors.New("boom"), slog.String(LogFieldUID, "1234"))
+
+		record := map[string]any{}
+		err := json.Unmarshal(buffer.Bytes(), &record)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		for _, field := range []string{LogFieldNamespace, LogFieldKind, LogFieldName, LogFieldUID, LogFieldDuration, LogFieldError} {
+			if _, ok := record[field]; !ok {
+				t.Errorf("missing field %s in %v", field, record)
+			}
+		}
+		if record["level"] != "ERROR" {
+			t.Errorf("unexpected level %v", record["level"])
+		}
+	})
+
+	t.Run("Silent by default", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace}
+		op := api.startOperation(context.Background(), "list", "Pod", "")
+		api.finishOperation(op, nil)
+	})
+}
+
+func TestGoCommonLogHandler(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		handler := NewGoCommonLogHandler(&logger.Logger{Level: logger.WARNING})
+		if handler.Enabled(context.Background(), slog.LevelInfo) {
+			t.Errorf("info must be disabled for WARNING logger")
+		}
+		if !handler.Enabled(context.Background(), slog.LevelError) {
+			t.Errorf("error must be enabled for WARNING logger")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package kub_api
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const metricsNamespace = "kub_api"
+
+// Metrics holds the Prometheus collectors updated by KubAPI operations.
+type Metrics struct {
+	Requests        *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	Errors          *prometheus.CounterVec
+	JobsCreated     prometheus.Counter
+	JobsSucceeded   prometheus.Counter
+	JobsFailed      prometheus.Counter
+	PodsPruned      prometheus.Counter
+	WatchReconnects *prometheus.CounterVec
+}
+
+// MetricsNew creates the collectors and registers them with registerer,
+// e.g. prometheus.DefaultRegisterer or a dedicated prometheus.NewRegistry().
+func MetricsNew(registerer prometheus.Registerer) (*Metrics, error) {
+	ret := Metrics{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Number of API requests made by KubAPI.",
+		}, []string{"operation", "verb", "resource"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of API requests made by KubAPI.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "verb", "resource"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Number of failed API requests by reason.",
+		}, []string{"operation", "verb", "resource", "reason"}),
+		JobsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_created_total",
+			Help:      "Number of Jobs created.",
+		}),
+		JobsSucceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_succeeded_total",
+			Help:      "Number of watched Jobs that completed successfully.",
+		}),
+		JobsFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_failed_total",
+			Help:      "Number of watched Jobs that failed.",
+		}),
+		PodsPruned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "pods_pruned_total",
+			Help:      "Number of finished Pods deleted by PrunePods.",
+		}),
+		WatchReconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "watch_reconnects_total",
+			Help:      "Number of times a watch was re-established.",
+		}, []string{"resource"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		ret.Requests, ret.RequestDuration, ret.Errors, ret.JobsCreated,
+		ret.JobsSucceeded, ret.JobsFailed, ret.PodsPruned, ret.WatchReconnects,
+	} {
+		err := registerer.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ret, nil
+}
+
+func (metrics *Metrics) observeOperation(op *operation, err error) {
+	resource := strings.ToLower(op.kind)
+	metrics.Requests.WithLabelValues(op.method, op.verb, resource).Inc()
+	metrics.RequestDuration.WithLabelValues(op.method, op.verb, resource).Observe(op.duration().Seconds())
+	if err != nil {
+		reason := string(apierrors.ReasonForError(err))
+		if reason == "" {
+			reason = "Unknown"
+		}
+		metrics.Errors.WithLabelValues(op.method, op.verb, resource, reason).Inc()
+		return
+	}
+	if op.verb == "create" && op.kind == "Job" {
+		metrics.JobsCreated.Inc()
+	}
+}
+
+func (kapi *KubAPI) observeJobFinished(job *batchv1.Job) {
+	if kapi.Metrics == nil {
+		return
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			kapi.Metrics.JobsSucceeded.Inc()
+			return
+		case batchv1.JobFailed:
+			kapi.Metrics.JobsFailed.Inc()
+			return
+		}
+	}
+}
+
+func (kapi *KubAPI) observePodPruned() {
+	if kapi.Metrics != nil {
+		kapi.Metrics.PodsPruned.Inc()
+	}
+}
+
+func (kapi *KubAPI) observeWatchReconnect(kind string) {
+	if kapi.Metrics != nil {
+		kapi.Metrics.WatchReconnects.WithLabelValues(strings.ToLower(kind)).Inc()
+	}
+}
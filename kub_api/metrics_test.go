@@ -0,0 +1,52 @@
+package kub_api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		metrics, err := MetricsNew(prometheus.NewRegistry())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		api := KubAPI{Namespace: &namespace, Metrics: metrics}
+
+		op := api.startOperation(context.Background(), "create", "Job", "test")
+		api.finishOperation(op, nil)
+		op = api.startOperation(context.Background(), "create", "Job", "test")
+		api.finishOperation(op, apierrors.NewAlreadyExists(schema.GroupResource{Group: "batch", Resource: "jobs"}, "test"))
+		op = api.startOperation(context.Background(), "delete", "Pod", "test")
+		api.finishOperation(op, errors.New("connection refused"))
+
+		if count := testutil.ToFloat64(metrics.Requests.WithLabelValues("Func1", "create", "job")); count != 2 {
+			t.Errorf("unexpected request count %v", count)
+		}
+		if count := testutil.ToFloat64(metrics.Errors.WithLabelValues("Func1", "create", "job", "AlreadyExists")); count != 1 {
+			t.Errorf("unexpected error count %v", count)
+		}
+		if count := testutil.ToFloat64(metrics.Errors.WithLabelValues("Func1", "delete", "pod", "Unknown")); count != 1 {
+			t.Errorf("unexpected error count %v", count)
+		}
+		if count := testutil.ToFloat64(metrics.JobsCreated); count != 1 {
+			t.Errorf("unexpected jobs created %v", count)
+		}
+
+		api.observeJobFinished(&batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+		}}})
+		if count := testutil.ToFloat64(metrics.JobsFailed); count != 1 {
+			t.Errorf("unexpected jobs failed %v", count)
+		}
+	})
+}
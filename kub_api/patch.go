@@ -0,0 +1,235 @@
+package kub_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// Paths of the pod spec inside the objects accepted by AddTolerationPatch.
+const (
+	PodSpecPathPod = "/spec"
+	PodSpecPathJob = "/spec/template/spec"
+)
+
+// Patch is a serialized patch body together with its content type.
+type Patch struct {
+	Type types.PatchType
+	Data []byte
+}
+
+// PatchOperation is a single RFC 6902 JSON Patch operation.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+func NewJSONPatch(operations ...PatchOperation) (*Patch, error) {
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("json patch has no operations")
+	}
+	for _, operation := range operations {
+		switch operation.Op {
+		case "add", "replace", "test":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("json patch operation %s %s requires a value", operation.Op, operation.Path)
+			}
+		case "remove":
+		case "move", "copy":
+			if operation.From == "" {
+				return nil, fmt.Errorf("json patch operation %s %s requires from", operation.Op, operation.Path)
+			}
+		default:
+			return nil, fmt.Errorf("unknown json patch operation: %s", operation.Op)
+		}
+		if !strings.HasPrefix(operation.Path, "/") {
+			return nil, fmt.Errorf("json patch path must start with '/': %s", operation.Path)
+		}
+	}
+
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: types.JSONPatchType, Data: data}, nil
+}
+
+func NewMergePatch(src any) (*Patch, error) {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: types.MergePatchType, Data: data}, nil
+}
+
+func NewStrategicMergePatch(src any) (*Patch, error) {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: types.StrategicMergePatchType, Data: data}, nil
+}
+
+// CreateStrategicMergePatch computes the strategic merge patch turning original into modified.
+// Both must be of the same built-in type, e.g. two *batchv1.Job.
+func CreateStrategicMergePatch(original, modified any) (*Patch, error) {
+	originalData, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	modifiedData, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+	data, err := strategicpatch.CreateTwoWayMergePatch(originalData, modifiedData, original)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: types.StrategicMergePatchType, Data: data}, nil
+}
+
+// EscapeJSONPointer escapes a single path segment, e.g. a label key containing '/'.
+func EscapeJSONPointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
+
+func AddLabelPatch(key, value string) (*Patch, error) {
+	return NewMergePatch(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]string{key: value},
+		},
+	})
+}
+
+func RemoveLabelPatch(key string) (*Patch, error) {
+	return NewMergePatch(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]any{key: nil},
+		},
+	})
+}
+
+func SetAnnotationPatch(key, value string) (*Patch, error) {
+	return NewMergePatch(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{key: value},
+		},
+	})
+}
+
+func ScaleParallelismPatch(parallelism int32) (*Patch, error) {
+	if parallelism < 0 {
+		return nil, fmt.Errorf("parallelism must not be negative: %d", parallelism)
+	}
+	return NewMergePatch(map[string]any{
+		"spec": map[string]any{
+			"parallelism": parallelism,
+		},
+	})
+}
+
+// AddTolerationPatch appends a toleration to the pod spec at podSpecPath.
+// Tolerations have no merge key, so a JSON patch is used to keep the existing ones;
+// current is the list already set on the object.
+func AddTolerationPatch(podSpecPath string, current []corev1.Toleration, toleration corev1.Toleration) (*Patch, error) {
+	for _, existing := range current {
+		if existing.MatchToleration(&toleration) {
+			return nil, fmt.Errorf("toleration %s already present", toleration.Key)
+		}
+	}
+
+	path := strings.TrimSuffix(podSpecPath, "/") + "/tolerations"
+	if len(current) == 0 {
+		return NewJSONPatch(PatchOperation{Op: "add", Path: path, Value: []corev1.Toleration{toleration}})
+	}
+	return NewJSONPatch(PatchOperation{Op: "add", Path: path + "/-", Value: toleration})
+}
+
+func (kapi *KubAPI) PatchJob(ctx context.Context, name string, patch *Patch) (*batchv1.Job, error) {
+	op := kapi.startOperation(ctx, "patch", "Job", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchPod(ctx context.Context, name string, patch *Patch) (*corev1.Pod, error) {
+	op := kapi.startOperation(ctx, "patch", "Pod", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchService(ctx context.Context, name string, patch *Patch) (*corev1.Service, error) {
+	op := kapi.startOperation(ctx, "patch", "Service", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchIngress(ctx context.Context, name string, patch *Patch) (*networkingv1.Ingress, error) {
+	op := kapi.startOperation(ctx, "patch", "Ingress", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.NetworkingV1().Ingresses(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchServiceAccount(ctx context.Context, name string, patch *Patch) (*corev1.ServiceAccount, error) {
+	op := kapi.startOperation(ctx, "patch", "ServiceAccount", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.CoreV1().ServiceAccounts(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchRole(ctx context.Context, name string, patch *Patch) (*rbacv1.Role, error) {
+	op := kapi.startOperation(ctx, "patch", "Role", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.RbacV1().Roles(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) PatchRoleBinding(ctx context.Context, name string, patch *Patch) (*rbacv1.RoleBinding, error) {
+	op := kapi.startOperation(ctx, "patch", "RoleBinding", name)
+	op.setDiff(patch.Data)
+	ret, err := kapi.clientset.RbacV1().RoleBindings(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
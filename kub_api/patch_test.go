@@ -0,0 +1,124 @@
+package kub_api
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestNewJSONPatch(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		patch, err := NewJSONPatch(
+			PatchOperation{Op: "add", Path: "/metadata/labels/" + EscapeJSONPointer("app.kubernetes.io/name"), Value: "test"},
+			PatchOperation{Op: "remove", Path: "/metadata/annotations/old"},
+		)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if patch.Type != types.JSONPatchType {
+			t.Errorf("unexpected patch type %s", patch.Type)
+		}
+		expected := `[{"op":"add","path":"/metadata/labels/app.kubernetes.io~1name","value":"test"},{"op":"remove","path":"/metadata/annotations/old"}]`
+		if string(patch.Data) != expected {
+			t.Errorf("unexpected patch %s", patch.Data)
+		}
+	})
+
+	t.Run("Missing value", func(t *testing.T) {
+		_, err := NewJSONPatch(PatchOperation{Op: "replace", Path: "/spec/parallelism"})
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestAddLabelPatch(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		patch, err := AddLabelPatch("team", "batch")
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if patch.Type != types.MergePatchType || string(patch.Data) != `{"metadata":{"labels":{"team":"batch"}}}` {
+			t.Errorf("unexpected patch %s %s", patch.Type, patch.Data)
+		}
+	})
+}
+
+func TestScaleParallelismPatch(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		patch, err := ScaleParallelismPatch(4)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if string(patch.Data) != `{"spec":{"parallelism":4}}` {
+			t.Errorf("unexpected patch %s", patch.Data)
+		}
+	})
+}
+
+func TestAddTolerationPatch(t *testing.T) {
+	toleration := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "batch", Effect: corev1.TaintEffectNoSchedule}
+
+	t.Run("Empty list", func(t *testing.T) {
+		patch, err := AddTolerationPatch(PodSpecPathJob, nil, toleration)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		operations := []PatchOperation{}
+		if err = json.Unmarshal(patch.Data, &operations); err != nil {
+			t.Errorf("%v", err)
+		}
+		if operations[0].Path != "/spec/template/spec/tolerations" {
+			t.Errorf("unexpected path %s", operations[0].Path)
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		current := []corev1.Toleration{{Key: "other", Operator: corev1.TolerationOpExists}}
+		patch, err := AddTolerationPatch(PodSpecPathPod, current, toleration)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		operations := []PatchOperation{}
+		if err = json.Unmarshal(patch.Data, &operations); err != nil {
+			t.Errorf("%v", err)
+		}
+		if operations[0].Path != "/spec/tolerations/-" {
+			t.Errorf("unexpected path %s", operations[0].Path)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		_, err := AddTolerationPatch(PodSpecPathPod, []corev1.Toleration{toleration}, toleration)
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestCreateStrategicMergePatch(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		name := "test"
+		containerImage := "busybox:1.28"
+		containerCommand := []string{"/bin/sh", "-c", "echo Hello"}
+		job := Job{JobName: &name, ContainerName: &name, ContainerImage: &containerImage, ContainerCommand: &containerCommand}
+
+		original, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		modified := original.DeepCopy()
+		parallelism := int32(3)
+		modified.Spec.Parallelism = &parallelism
+
+		patch, err := CreateStrategicMergePatch(original, modified)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if string(patch.Data) != `{"spec":{"parallelism":3}}` {
+			t.Errorf("unexpected patch %s", patch.Data)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels and environment set on the pods of a pod group.
+const (
+	PodGroupLabelName    = "kub-api/pod-group"
+	PodGroupLabelOrdinal = "kub-api/pod-ordinal"
+	PodGroupEnvOrdinal   = "POD_ORDINAL"
+	PodGroupEnvSize      = "POD_GROUP_SIZE"
+)
+
+// PodGroup is a fixed number of ordinal pods named <job>-<ordinal> that run the pod spec of Job.
+// Every pod gets the stable hostname <job>-<ordinal>.<job>.<namespace>.svc through a headless
+// Service named after the job.
+type PodGroup struct {
+	Job  *Job
+	Size int
+}
+
+type PodGroupStatus struct {
+	Name      string                  `json:"name"`
+	Size      int                     `json:"size"`
+	Pending   int                     `json:"pending"`
+	Running   int                     `json:"running"`
+	Ready     int                     `json:"ready"`
+	Succeeded int                     `json:"succeeded"`
+	Failed    int                     `json:"failed"`
+	Phases    map[int]corev1.PodPhase `json:"phases"`
+	Missing   []int                   `json:"missing,omitempty"`
+}
+
+// Complete tells whether every ordinal of the group has succeeded.
+func (status *PodGroupStatus) Complete() bool {
+	return status.Size > 0 && status.Succeeded == status.Size
+}
+
+func PodGroupPodName(groupName string, ordinal int) string {
+	return fmt.Sprintf("%s-%d", groupName, ordinal)
+}
+
+// CreatePodGroup creates the owner Job, the headless Service and the missing ordinal pods.
+// It is idempotent: existing objects of the group are kept, so it can be re-run to recreate
+// deleted pods. The owner Job is created suspended so the job controller never starts pods of
+// its own, deleting it garbage collects the group.
+func (kapi *KubAPI) CreatePodGroup(ctx context.Context, group *PodGroup) (*PodGroupStatus, error) {
+	if group.Job == nil || group.Job.JobName == nil {
+		return nil, fmt.Errorf("pod group job name is required")
+	}
+	if group.Size <= 0 {
+		return nil, fmt.Errorf("pod group %s: size must be positive", *group.Job.JobName)
+	}
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := kapi.ensurePodGroupOwner(ctx, group.Job)
+	if err != nil {
+		return nil, err
+	}
+	err = kapi.ensurePodGroupService(ctx, *group.Job.JobName)
+	if err != nil {
+		return nil, err
+	}
+	for ordinal := range group.Size {
+		err = kapi.createPodGroupPod(ctx, owner, ordinal, group.Size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kapi.GetPodGroupStatus(ctx, *group.Job.JobName, group.Size)
+}
+
+func (kapi *KubAPI) ensurePodGroupOwner(ctx context.Context, job *Job) (*batchv1.Job, error) {
+	owner, err := kapi.Getbatchv1Job(job)
+	if err == nil {
+		return owner, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	ownerJob := *job
+	suspend := true
+	ownerJob.Suspend = &suspend
+	err = kapi.createJob(ctx, &ownerJob)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return kapi.Getbatchv1Job(job)
+}
+
+func (kapi *KubAPI) ensurePodGroupService(ctx context.Context, name string) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: *kapi.Namespace,
+			Labels:    map[string]string{PodGroupLabelName: name},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  map[string]string{PodGroupLabelName: name},
+			// Peers must resolve each other before they become ready.
+			PublishNotReadyAddresses: true,
+		},
+	}
+	op := kapi.startOperation(ctx, "create", "Service", name)
+	op.setDiff(service)
+	_, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Create(op.ctx, service, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (kapi *KubAPI) createPodGroupPod(ctx context.Context, owner *batchv1.Job, ordinal int, size int) error {
+	groupName := owner.Name
+	podName := PodGroupPodName(groupName, ordinal)
+
+	labels := maps.Clone(owner.Spec.Template.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	// The job controller selects pods by controller-uid; leaving it out keeps the suspended
+	// owner from adopting and terminating the group pods.
+	delete(labels, batchv1.ControllerUidLabel)
+	delete(labels, "controller-uid")
+	labels["job-name"] = groupName
+	labels[PodGroupLabelName] = groupName
+	labels[PodGroupLabelOrdinal] = strconv.Itoa(ordinal)
+
+	spec := *owner.Spec.Template.Spec.DeepCopy()
+	spec.Hostname = podName
+	spec.Subdomain = groupName
+	for index := range spec.Containers {
+		spec.Containers[index].Env = append(spec.Containers[index].Env,
+			corev1.EnvVar{Name: PodGroupEnvOrdinal, Value: strconv.Itoa(ordinal)},
+		)
+		if size > 0 {
+			spec.Containers[index].Env = append(spec.Containers[index].Env,
+				corev1.EnvVar{Name: PodGroupEnvSize, Value: strconv.Itoa(size)},
+			)
+		}
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podName,
+			Namespace:   *kapi.Namespace,
+			Labels:      labels,
+			Annotations: maps.Clone(owner.Spec.Template.Annotations),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: batchv1.SchemeGroupVersion.String(),
+				Kind:       "Job",
+				Name:       owner.Name,
+				UID:        owner.UID,
+			}},
+		},
+		Spec: spec,
+	}
+
+	op := kapi.startOperation(ctx, "create", "Pod", podName)
+	op.setDiff(pod)
+	_, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Create(op.ctx, pod, metav1.CreateOptions{})
+	kapi.finishOperation(op, err)
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	op = kapi.startOperation(ctx, "get", "Pod", podName)
+	existing, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Get(op.ctx, podName, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return err
+	}
+	if existing.Labels[PodGroupLabelName] != groupName || existing.Labels[PodGroupLabelOrdinal] != strconv.Itoa(ordinal) {
+		return fmt.Errorf("pod %s already exists and does not belong to pod group %s", podName, groupName)
+	}
+	return nil
+}
+
+// GetPodGroupStatus aggregates the pod phases of the group. Ordinals below size without a pod
+// are reported as missing; size 0 skips that check.
+func (kapi *KubAPI) GetPodGroupStatus(ctx context.Context, name string, size int) (*PodGroupStatus, error) {
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: PodGroupLabelName + "=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	return AggregatePodGroupStatus(name, size, pods.Items), nil
+}
+
+func AggregatePodGroupStatus(name string, size int, pods []corev1.Pod) *PodGroupStatus {
+	ret := PodGroupStatus{Name: name, Size: size, Phases: map[int]corev1.PodPhase{}}
+	for _, pod := range pods {
+		ordinal, err := strconv.Atoi(pod.Labels[PodGroupLabelOrdinal])
+		if err != nil {
+			continue
+		}
+		ret.Phases[ordinal] = pod.Status.Phase
+		switch pod.Status.Phase {
+		case corev1.PodPending:
+			ret.Pending++
+		case corev1.PodRunning:
+			ret.Running++
+		case corev1.PodSucceeded:
+			ret.Succeeded++
+		case corev1.PodFailed:
+			ret.Failed++
+		}
+		if isPodReady(&pod) {
+			ret.Ready++
+		}
+	}
+	if ret.Size == 0 {
+		ret.Size = len(ret.Phases)
+	}
+	for ordinal := range size {
+		if _, ok := ret.Phases[ordinal]; !ok {
+			ret.Missing = append(ret.Missing, ordinal)
+		}
+	}
+	sort.Ints(ret.Missing)
+	return &ret
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// DeletePodGroup deletes the owner Job, the pods of the group and the headless Service.
+func (kapi *KubAPI) DeletePodGroup(ctx context.Context, name string) error {
+	err := kapi.deleteJob(ctx, name, metav1.DeletePropagationBackground)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: PodGroupLabelName + "=" + name})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		op = kapi.startOperation(ctx, "delete", "Pod", pod.Name)
+		err = kapi.clientset.CoreV1().Pods(*kapi.Namespace).Delete(op.ctx, pod.Name, metav1.DeleteOptions{})
+		kapi.finishOperation(op, err)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	op = kapi.startOperation(ctx, "delete", "Service", name)
+	err = kapi.clientset.CoreV1().Services(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
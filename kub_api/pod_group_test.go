@@ -0,0 +1,103 @@
+package kub_api
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreatePodGroup(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset()
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		group := PodGroup{Job: testQueueJob("test", map[string]string{"team": "data"}), Size: 3}
+		status, err := api.CreatePodGroup(context.Background(), &group)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if status.Size != 3 || len(status.Phases) != 3 || len(status.Missing) != 0 {
+			t.Errorf("unexpected status %+v", status)
+		}
+
+		owner, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if err != nil || !IsJobSuspended(owner) {
+			t.Fatalf("expected suspended owner job: %v", err)
+		}
+		service, err := clientset.CoreV1().Services(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+		if err != nil || service.Spec.ClusterIP != corev1.ClusterIPNone {
+			t.Fatalf("expected headless service: %v", err)
+		}
+
+		pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), "test-2", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if pod.Labels[PodGroupLabelOrdinal] != "2" || pod.Labels["team"] != "data" || pod.Labels[batchv1.ControllerUidLabel] != "" {
+			t.Errorf("unexpected labels %v", pod.Labels)
+		}
+		if pod.Spec.Hostname != "test-2" || pod.Spec.Subdomain != "test" {
+			t.Errorf("unexpected hostname %s.%s", pod.Spec.Hostname, pod.Spec.Subdomain)
+		}
+		env := map[string]string{}
+		for _, envVar := range pod.Spec.Containers[0].Env {
+			env[envVar.Name] = envVar.Value
+		}
+		if env[PodGroupEnvOrdinal] != "2" || env[PodGroupEnvSize] != "3" {
+			t.Errorf("unexpected env %v", env)
+		}
+		if len(pod.OwnerReferences) != 1 || pod.OwnerReferences[0].Name != "test" {
+			t.Errorf("unexpected owner references %v", pod.OwnerReferences)
+		}
+
+		err = clientset.CoreV1().Pods(namespace).Delete(context.Background(), "test-1", metav1.DeleteOptions{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		status, err = api.CreatePodGroup(context.Background(), &group)
+		if err != nil {
+			t.Fatalf("re-creation: %v", err)
+		}
+		if len(status.Missing) != 0 {
+			t.Errorf("expected recreated pod, missing %v", status.Missing)
+		}
+
+		err = api.DeletePodGroup(context.Background(), "test")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		status, err = api.GetPodGroupStatus(context.Background(), "test", 3)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(status.Missing) != 3 {
+			t.Errorf("expected deleted group, got %+v", status)
+		}
+	})
+}
+
+func TestAggregatePodGroupStatus(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		pod := func(ordinal string, phase corev1.PodPhase) corev1.Pod {
+			return corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{PodGroupLabelName: "test", PodGroupLabelOrdinal: ordinal}},
+				Status:     corev1.PodStatus{Phase: phase},
+			}
+		}
+		pods := []corev1.Pod{pod("0", corev1.PodSucceeded), pod("1", corev1.PodRunning), pod("3", corev1.PodFailed)}
+		pods[1].Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+
+		status := AggregatePodGroupStatus("test", 4, pods)
+		if status.Succeeded != 1 || status.Running != 1 || status.Ready != 1 || status.Failed != 1 {
+			t.Errorf("unexpected status %+v", status)
+		}
+		if len(status.Missing) != 1 || status.Missing[0] != 2 || status.Complete() {
+			t.Errorf("unexpected missing %v", status.Missing)
+		}
+	})
+}
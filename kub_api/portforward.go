@@ -0,0 +1,259 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+const (
+	portForwardMinBackoff = time.Second
+	portForwardMaxBackoff = 30 * time.Second
+)
+
+// podPortForwarder forwards localPort on 127.0.0.1 to remotePort of pod until stop is closed,
+// calling ready with the bound local port once listening. Tests replace it.
+type podPortForwarder func(namespace, pod string, localPort, remotePort int, stop <-chan struct{}, ready func(localPort int)) error
+
+// PortForwardSession is a running port forward started by PortForward.
+type PortForwardSession struct {
+	// LocalPort is the bound local port, chosen by the system when 0 was requested.
+	LocalPort int
+	target    string
+	pod       string
+	done      chan struct{}
+}
+
+// Done is closed once the context passed to PortForward is cancelled and forwarding stopped.
+func (session *PortForwardSession) Done() <-chan struct{} {
+	return session.done
+}
+
+// Address is the local address to connect to, e.g. 127.0.0.1:8080.
+func (session *PortForwardSession) Address() string {
+	return fmt.Sprintf("127.0.0.1:%d", session.LocalPort)
+}
+
+// PortForward forwards localPort on 127.0.0.1 to remotePort of target until ctx is cancelled.
+// The target is pod/<name>, service/<name> or svc/<name>, a bare name is a pod. For a Service,
+// remotePort is a service port, forwarded to the target port of a ready backing pod. When the
+// pod goes away the target is resolved again and forwarding resumes on the same local port.
+// PortForward returns once the first connection listens; localPort 0 picks a free port.
+func (kapi *KubAPI) PortForward(ctx context.Context, target string, localPort, remotePort int) (*PortForwardSession, error) {
+	pod, podPort, err := kapi.resolvePortForwardTarget(ctx, target, remotePort)
+	if err != nil {
+		return nil, err
+	}
+
+	session := PortForwardSession{target: target, pod: pod, done: make(chan struct{})}
+	ready := make(chan int, 1)
+	stopped := make(chan error, 1)
+	stop := make(chan struct{})
+	cancelStop := context.AfterFunc(ctx, func() { close(stop) })
+	go func() {
+		stopped <- kapi.forwardPodPort(ctx, pod, localPort, podPort, stop, func(port int) { ready <- port })
+	}()
+
+	select {
+	case session.LocalPort = <-ready:
+	case err = <-stopped:
+		cancelStop()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("port forward to %s: %w", target, err)
+	}
+
+	go func() {
+		defer close(session.done)
+		err := <-stopped
+		cancelStop()
+		kapi.keepPortForward(ctx, &session, remotePort, err)
+	}()
+	return &session, nil
+}
+
+// keepPortForward reconnects after the forwarded pod went away until ctx is cancelled.
+func (kapi *KubAPI) keepPortForward(ctx context.Context, session *PortForwardSession, remotePort int, err error) {
+	backoff := portForwardMinBackoff
+	connected := atomic.Bool{}
+	for ctx.Err() == nil {
+		if connected.Swap(false) {
+			backoff = portForwardMinBackoff
+		}
+		kapi.log().Warn("port forward lost, reconnecting",
+			slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, session.pod),
+			slog.String("target", session.target), slog.Any(LogFieldError, err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, portForwardMaxBackoff)
+
+		pod, podPort, resolveErr := kapi.resolvePortForwardTarget(ctx, session.target, remotePort)
+		if resolveErr != nil {
+			err = resolveErr
+			continue
+		}
+		session.pod = pod
+		stop := make(chan struct{})
+		cancelStop := context.AfterFunc(ctx, func() { close(stop) })
+		err = kapi.forwardPodPort(ctx, pod, session.LocalPort, podPort, stop, func(int) { connected.Store(true) })
+		cancelStop()
+	}
+}
+
+func (kapi *KubAPI) forwardPodPort(ctx context.Context, pod string, localPort, remotePort int, stop <-chan struct{}, ready func(localPort int)) error {
+	forwarder := kapi.portForwarder
+	if forwarder == nil {
+		forwarder = kapi.spdyPortForward
+	}
+	op := kapi.startOperation(ctx, "create", "Pod/portforward", pod)
+	finish := sync.Once{}
+	err := forwarder(*kapi.Namespace, pod, localPort, remotePort, stop, func(boundPort int) {
+		finish.Do(func() {
+			kapi.finishOperation(op, nil, slog.Int("localPort", boundPort), slog.Int("remotePort", remotePort))
+		})
+		ready(boundPort)
+	})
+	finish.Do(func() { kapi.finishOperation(op, err) })
+	return err
+}
+
+func (kapi *KubAPI) spdyPortForward(namespace, pod string, localPort, remotePort int, stop <-chan struct{}, ready func(localPort int)) error {
+	if kapi.restConfig == nil {
+		return fmt.Errorf("port forward requires a KubAPI created with KubAPINew")
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(kapi.restConfig)
+	if err != nil {
+		return err
+	}
+	url := kapi.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", url)
+
+	readyChan := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("%d:%d", localPort, remotePort)}, stop, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-readyChan:
+		case <-stop:
+			return
+		}
+		ports, err := forwarder.GetPorts()
+		if err == nil && len(ports) == 1 {
+			ready(int(ports[0].Local))
+		}
+	}()
+	return forwarder.ForwardPorts()
+}
+
+// resolvePortForwardTarget returns the pod and pod port to forward remotePort of target to.
+func (kapi *KubAPI) resolvePortForwardTarget(ctx context.Context, target string, remotePort int) (string, int, error) {
+	kind, name, ok := strings.Cut(target, "/")
+	if !ok {
+		kind, name = "pod", target
+	}
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+		return name, remotePort, nil
+	case "service", "services", "svc":
+	default:
+		return "", 0, fmt.Errorf("port forward target %s: unsupported kind %s", target, kind)
+	}
+
+	op := kapi.startOperation(ctx, "get", "Service", name)
+	service, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(service.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s has no selector", name)
+	}
+
+	op = kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String()})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return "", 0, err
+	}
+	pod := selectReadyPod(pods.Items)
+	if pod == nil {
+		return "", 0, fmt.Errorf("service %s has no ready pod", name)
+	}
+	podPort, err := ServiceTargetPort(service, pod, remotePort)
+	if err != nil {
+		return "", 0, err
+	}
+	return pod.Name, podPort, nil
+}
+
+// selectReadyPod picks the oldest running, ready pod that is not being deleted.
+func selectReadyPod(pods []corev1.Pod) *corev1.Pod {
+	candidates := []*corev1.Pod{}
+	for index := range pods {
+		pod := &pods[index]
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning && isPodReady(pod) {
+			candidates = append(candidates, pod)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].CreationTimestamp.Equal(&candidates[j].CreationTimestamp) {
+			return candidates[i].CreationTimestamp.Before(&candidates[j].CreationTimestamp)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0]
+}
+
+// ServiceTargetPort maps servicePort of service to the container port of pod, resolving named
+// target ports against the pod containers.
+func ServiceTargetPort(service *corev1.Service, pod *corev1.Pod, servicePort int) (int, error) {
+	for _, port := range service.Spec.Ports {
+		if int(port.Port) != servicePort {
+			continue
+		}
+		switch {
+		case port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "":
+			for _, container := range pod.Spec.Containers {
+				for _, containerPort := range container.Ports {
+					if containerPort.Name == port.TargetPort.StrVal {
+						return int(containerPort.ContainerPort), nil
+					}
+				}
+			}
+			return 0, fmt.Errorf("pod %s has no port named %s", pod.Name, port.TargetPort.StrVal)
+		case port.TargetPort.IntValue() != 0:
+			return port.TargetPort.IntValue(), nil
+		}
+		return servicePort, nil
+	}
+	return 0, fmt.Errorf("service %s has no port %d", service.Name, servicePort)
+}
@@ -0,0 +1,117 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testServicePod(name string, created time.Time, ready bool) *corev1.Pod {
+	pod := testJobPod(name, "", corev1.PodRunning)
+	pod.Labels = map[string]string{"app": "test"}
+	pod.CreationTimestamp = metav1.NewTime(created)
+	pod.Spec.Containers = []corev1.Container{{Name: "test", Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}}}
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	return pod
+}
+
+func TestPortForward(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		now := time.Now()
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "test"},
+				Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromString("http")}},
+			},
+		}
+		clientset := fake.NewSimpleClientset(
+			service,
+			testServicePod("test-a", now.Add(-time.Hour), true),
+			testServicePod("test-b", now, true),
+			testServicePod("test-c", now.Add(-2*time.Hour), false),
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		forwarded := make(chan string, 4)
+		lost := make(chan struct{})
+		api.portForwarder = func(namespace, pod string, localPort, remotePort int, stop <-chan struct{}, ready func(localPort int)) error {
+			if localPort == 0 {
+				localPort = 40000
+			}
+			forwarded <- fmt.Sprintf("%d->%s:%d", localPort, pod, remotePort)
+			ready(localPort)
+			select {
+			case <-stop:
+				return nil
+			case <-lost:
+				return fmt.Errorf("lost connection to pod")
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		session, err := api.PortForward(ctx, "svc/test", 0, 80)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if session.Address() != "127.0.0.1:40000" || <-forwarded != "40000->test-a:8080" {
+			t.Fatalf("unexpected session %s", session.Address())
+		}
+
+		err = clientset.CoreV1().Pods(namespace).Delete(context.Background(), "test-a", metav1.DeleteOptions{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		close(lost)
+		select {
+		case reconnected := <-forwarded:
+			if reconnected != "40000->test-b:8080" {
+				t.Errorf("unexpected reconnect %s", reconnected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("port forward did not reconnect")
+		}
+
+		cancel()
+		select {
+		case <-session.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("port forward did not stop")
+		}
+	})
+}
+
+func TestServiceTargetPort(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "test"},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Port: 80, TargetPort: intstr.FromString("http")},
+				{Port: 443, TargetPort: intstr.FromInt32(8443)},
+				{Port: 9090},
+			}},
+		}
+		pod := testServicePod("test", time.Now(), true)
+		for servicePort, expected := range map[int]int{80: 8080, 443: 8443, 9090: 9090} {
+			podPort, err := ServiceTargetPort(service, pod, servicePort)
+			if err != nil || podPort != expected {
+				t.Errorf("port %d: expected %d, got %d: %v", servicePort, expected, podPort, err)
+			}
+		}
+		_, err := ServiceTargetPort(service, pod, 81)
+		if err == nil {
+			t.Errorf("expected error for unknown port")
+		}
+	})
+}
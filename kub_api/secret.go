@@ -0,0 +1,184 @@
+package kub_api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SecretNew builds an Opaque secret from the sources.
+func SecretNew(name string, sources ConfigSources) (*corev1.Secret, error) {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("secret %s: invalid name: %v", name, errs)
+	}
+	data, err := LoadConfigSources(sources)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", name, err)
+	}
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}, Type: corev1.SecretTypeOpaque, Data: data}, nil
+}
+
+// DockerRegistrySecretNew builds an image pull secret for server, as kubectl create secret
+// docker-registry does.
+func DockerRegistrySecretNew(name, server, username, password, email string) (*corev1.Secret, error) {
+	if server == "" || username == "" || password == "" {
+		return nil, fmt.Errorf("secret %s: registry server, username and password are required", name)
+	}
+	auth := map[string]any{
+		"username": username,
+		"password": password,
+		"auth":     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	if email != "" {
+		auth["email"] = email
+	}
+	config, err := json.Marshal(map[string]any{"auths": map[string]any{server: auth}})
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: config},
+	}, nil
+}
+
+// TLSSecretNew builds a TLS secret after checking that the key matches the certificate.
+func TLSSecretNew(name string, certPEM, keyPEM []byte) (*corev1.Secret, error) {
+	_, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", name, err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+	}, nil
+}
+
+func BasicAuthSecretNew(name, username, password string) (*corev1.Secret, error) {
+	if username == "" && password == "" {
+		return nil, fmt.Errorf("secret %s: username or password is required", name)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data:       map[string][]byte{corev1.BasicAuthUsernameKey: []byte(username), corev1.BasicAuthPasswordKey: []byte(password)},
+	}, nil
+}
+
+// redactSecret keeps the keys of the secret for the audit trail and drops the values.
+func redactSecret(secret *corev1.Secret) *corev1.Secret {
+	ret := secret.DeepCopy()
+	for key := range ret.Data {
+		ret.Data[key] = nil
+	}
+	for key := range ret.StringData {
+		ret.StringData[key] = ""
+	}
+	return ret
+}
+
+func (kapi *KubAPI) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	op := kapi.startOperation(ctx, "create", "Secret", secret.Name)
+	op.setDiff(redactSecret(secret))
+	ret, err := kapi.clientset.CoreV1().Secrets(*kapi.Namespace).Create(op.ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		kapi.finishOperation(op, err)
+		return nil, err
+	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(ret.UID)))
+	return ret, nil
+}
+
+// ApplySecret creates the secret or replaces the data of an existing one. The type of a
+// secret is immutable, so changing it is an error.
+func (kapi *KubAPI) ApplySecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	if secret.ResourceVersion == "" {
+		op := kapi.startOperation(ctx, "get", "Secret", secret.Name)
+		existing, err := kapi.clientset.CoreV1().Secrets(*kapi.Namespace).Get(op.ctx, secret.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Not a failure, the secret is created.
+			kapi.finishOperation(op, nil)
+			return kapi.CreateSecret(ctx, secret)
+		}
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+		if secret.Type != "" && existing.Type != secret.Type {
+			return nil, fmt.Errorf("secret %s: type %s can not be changed to %s", secret.Name, existing.Type, secret.Type)
+		}
+		secret = secret.DeepCopy()
+		secret.ResourceVersion = existing.ResourceVersion
+	}
+
+	op := kapi.startOperation(ctx, "update", "Secret", secret.Name)
+	op.setDiff(redactSecret(secret))
+	ret, err := kapi.clientset.CoreV1().Secrets(*kapi.Namespace).Update(op.ctx, secret, metav1.UpdateOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	op := kapi.startOperation(ctx, "get", "Secret", name)
+	ret, err := kapi.clientset.CoreV1().Secrets(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) DeleteSecret(ctx context.Context, name string) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "delete", "Secret", name)
+	err = kapi.clientset.CoreV1().Secrets(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	kapi.finishOperation(op, err)
+	return err
+}
+
+// MountSecret mounts the secret read-only at mountPath in the job container, see MountConfigMap.
+func (job *Job) MountSecret(name, mountPath string, items ...string) {
+	source := &corev1.SecretVolumeSource{SecretName: name}
+	for _, key := range items {
+		source.Items = append(source.Items, corev1.KeyToPath{Key: key, Path: key})
+	}
+	job.addVolume(corev1.Volume{Name: jobVolumeName("secret", name), VolumeSource: corev1.VolumeSource{Secret: source}}, mountPath)
+}
+
+// EnvFromSecret exposes every key of the secret as an environment variable, prefixed by prefix.
+func (job *Job) EnvFromSecret(name, prefix string) {
+	job.addEnvFrom(corev1.EnvFromSource{Prefix: prefix, SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}})
+}
+
+// EnvFromSecretKey sets the environment variable envName to one key of the secret.
+func (job *Job) EnvFromSecretKey(envName, name, key string) {
+	job.addEnv(corev1.EnvVar{Name: envName, ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key},
+	}})
+}
+
+// UseImagePullSecret makes the job pods pull their images with the docker-registry secret.
+func (job *Job) UseImagePullSecret(name string) {
+	if job.ImagePullSecrets == nil {
+		job.ImagePullSecrets = &[]corev1.LocalObjectReference{}
+	}
+	*job.ImagePullSecrets = append(*job.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+}
@@ -0,0 +1,110 @@
+package kub_api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTypedSecrets(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		registry, err := DockerRegistrySecretNew("registry", "registry.example.com", "ci", "hunter2", "")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		config := map[string]map[string]map[string]string{}
+		err = json.Unmarshal(registry.Data[corev1.DockerConfigJsonKey], &config)
+		if err != nil || config["auths"]["registry.example.com"]["auth"] != "Y2k6aHVudGVyMg==" || registry.Type != corev1.SecretTypeDockerConfigJson {
+			t.Errorf("unexpected registry secret %s: %v", registry.Data[corev1.DockerConfigJsonKey], err)
+		}
+
+		basicAuth, err := BasicAuthSecretNew("basic", "admin", "secret")
+		if err != nil || string(basicAuth.Data[corev1.BasicAuthPasswordKey]) != "secret" {
+			t.Errorf("unexpected basic auth secret %+v: %v", basicAuth, err)
+		}
+
+		certificate := testTLSSecret("tls", time.Now().Add(time.Hour), "app.example.com").Data[corev1.TLSCertKey]
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		keyDER, _ := x509.MarshalECPrivateKey(otherKey)
+		_, err = TLSSecretNew("tls", certificate, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+		if err == nil {
+			t.Errorf("expected a key mismatch")
+		}
+	})
+}
+
+func TestSecretLifecycle(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		sink := MemoryAuditSink{}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(), Auditor: &Auditor{Sinks: []AuditSink{&sink}}}
+
+		secret, err := SecretNew("app-credentials", ConfigSources{Literals: []string{"password=hunter2"}})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = api.CreateSecret(context.Background(), secret)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		secret.Data["password"] = []byte("correct-horse")
+		_, err = api.ApplySecret(context.Background(), secret)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		fetched, err := api.GetSecret(context.Background(), "app-credentials")
+		if err != nil || string(fetched.Data["password"]) != "correct-horse" {
+			t.Fatalf("unexpected secret %+v: %v", fetched, err)
+		}
+
+		basicAuth, _ := BasicAuthSecretNew("app-credentials", "admin", "secret")
+		_, err = api.ApplySecret(context.Background(), basicAuth)
+		if err == nil || !strings.Contains(err.Error(), "can not be changed") {
+			t.Errorf("expected a type change error, got %v", err)
+		}
+
+		records := sink.Records()
+		for _, record := range records {
+			if strings.Contains(string(record.Diff), "aHVudGVyMg") || strings.Contains(string(record.Diff), "Y29ycmVjdC1ob3JzZQ") {
+				t.Errorf("audit record leaks the secret value: %s", record.Diff)
+			}
+		}
+		if len(records) == 0 || !strings.Contains(string(records[0].Diff), "password") {
+			t.Errorf("expected audited keys, got %+v", records)
+		}
+		for _, record := range records {
+			if record.Result == AuditResultFailure {
+				t.Errorf("unexpected failed audit record %+v", record)
+			}
+		}
+
+		err = api.DeleteSecret(context.Background(), "app-credentials")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	})
+
+	t.Run("Default namespace", func(t *testing.T) {
+		namespace := "default"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+
+		secret, err := SecretNew("app-credentials", ConfigSources{Literals: []string{"password=hunter2"}})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = api.ApplySecret(context.Background(), secret)
+		if err == nil {
+			t.Errorf("expected apply in the default namespace to fail")
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Service describes a Service to provision, unset fields keep the server defaults.
+type Service struct {
+	ServiceName *string
+	// Type defaults to ClusterIP.
+	Type *corev1.ServiceType
+	// Ports need unique names when there is more than one. TargetPort defaults to Port and may
+	// name a container port, Protocol defaults to TCP.
+	Ports    *[]corev1.ServicePort
+	Selector *map[string]string
+	// Headless sets clusterIP None, for ClusterIP services only.
+	Headless                      *bool
+	ExternalName                  *string
+	SessionAffinity               *corev1.ServiceAffinity
+	SessionAffinityTimeoutSeconds *int32
+	ExternalTrafficPolicy         *corev1.ServiceExternalTrafficPolicy
+	InternalTrafficPolicy         *corev1.ServiceInternalTrafficPolicy
+	IPFamilies                    *[]corev1.IPFamily
+	IPFamilyPolicy                *corev1.IPFamilyPolicy
+	LoadBalancerClass             *string
+	LoadBalancerSourceRanges      *[]string
+	PublishNotReadyAddresses      *bool
+	Labels                        *map[string]string
+	Annotations                   *map[string]string
+}
+
+// ServicePortNew returns a port named name forwarding port to targetPort, either a number or a
+// container port name; an empty targetPort forwards to port.
+func ServicePortNew(name string, port int32, targetPort string, protocol corev1.Protocol) corev1.ServicePort {
+	ret := corev1.ServicePort{Name: name, Port: port, Protocol: protocol}
+	if targetPort != "" {
+		ret.TargetPort = intstr.Parse(targetPort)
+	}
+	return ret
+}
+
+func (service *Service) GenerateService() (*corev1.Service, error) {
+	if service.ServiceName == nil || *service.ServiceName == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	name := *service.ServiceName
+	if errs := validation.IsDNS1035Label(name); len(errs) > 0 {
+		return nil, fmt.Errorf("service %s: invalid name: %v", name, errs)
+	}
+
+	serviceType := corev1.ServiceTypeClusterIP
+	if service.Type != nil {
+		serviceType = *service.Type
+	}
+	ret := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.ServiceSpec{Type: serviceType},
+	}
+
+	switch serviceType {
+	case corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+	case corev1.ServiceTypeExternalName:
+		if service.ExternalName == nil || *service.ExternalName == "" {
+			return nil, fmt.Errorf("service %s: ExternalName type requires an external name", name)
+		}
+		if service.Selector != nil && len(*service.Selector) > 0 {
+			return nil, fmt.Errorf("service %s: ExternalName type does not select pods", name)
+		}
+		ret.Spec.ExternalName = *service.ExternalName
+	default:
+		return nil, fmt.Errorf("service %s: unknown type %s", name, serviceType)
+	}
+	if service.ExternalName != nil && serviceType != corev1.ServiceTypeExternalName {
+		return nil, fmt.Errorf("service %s: external name requires the ExternalName type", name)
+	}
+
+	if service.Headless != nil && *service.Headless {
+		if serviceType != corev1.ServiceTypeClusterIP {
+			return nil, fmt.Errorf("service %s: headless requires the ClusterIP type", name)
+		}
+		ret.Spec.ClusterIP = corev1.ClusterIPNone
+	}
+
+	if service.Ports != nil {
+		ports, err := generateServicePorts(name, serviceType, *service.Ports)
+		if err != nil {
+			return nil, err
+		}
+		ret.Spec.Ports = ports
+	}
+	if len(ret.Spec.Ports) == 0 && serviceType != corev1.ServiceTypeExternalName && ret.Spec.ClusterIP != corev1.ClusterIPNone {
+		return nil, fmt.Errorf("service %s: at least one port is required", name)
+	}
+
+	if service.Selector != nil {
+		ret.Spec.Selector = maps.Clone(*service.Selector)
+	}
+
+	if service.SessionAffinity != nil {
+		ret.Spec.SessionAffinity = *service.SessionAffinity
+	}
+	if service.SessionAffinityTimeoutSeconds != nil {
+		if ret.Spec.SessionAffinity != corev1.ServiceAffinityClientIP {
+			return nil, fmt.Errorf("service %s: session affinity timeout requires ClientIP affinity", name)
+		}
+		ret.Spec.SessionAffinityConfig = &corev1.SessionAffinityConfig{
+			ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: service.SessionAffinityTimeoutSeconds},
+		}
+	}
+
+	if service.ExternalTrafficPolicy != nil {
+		if serviceType != corev1.ServiceTypeNodePort && serviceType != corev1.ServiceTypeLoadBalancer {
+			return nil, fmt.Errorf("service %s: external traffic policy requires the NodePort or LoadBalancer type", name)
+		}
+		ret.Spec.ExternalTrafficPolicy = *service.ExternalTrafficPolicy
+	}
+	ret.Spec.InternalTrafficPolicy = service.InternalTrafficPolicy
+
+	if service.IPFamilies != nil {
+		if len(*service.IPFamilies) > 2 {
+			return nil, fmt.Errorf("service %s: at most two IP families are allowed", name)
+		}
+		ret.Spec.IPFamilies = append([]corev1.IPFamily{}, *service.IPFamilies...)
+	}
+	ret.Spec.IPFamilyPolicy = service.IPFamilyPolicy
+
+	if service.LoadBalancerClass != nil || service.LoadBalancerSourceRanges != nil {
+		if serviceType != corev1.ServiceTypeLoadBalancer {
+			return nil, fmt.Errorf("service %s: load balancer settings require the LoadBalancer type", name)
+		}
+		ret.Spec.LoadBalancerClass = service.LoadBalancerClass
+		if service.LoadBalancerSourceRanges != nil {
+			ret.Spec.LoadBalancerSourceRanges = append([]string{}, *service.LoadBalancerSourceRanges...)
+		}
+	}
+	if service.PublishNotReadyAddresses != nil {
+		ret.Spec.PublishNotReadyAddresses = *service.PublishNotReadyAddresses
+	}
+
+	if service.Labels != nil {
+		ret.ObjectMeta.Labels = maps.Clone(*service.Labels)
+	}
+	if service.Annotations != nil {
+		ret.ObjectMeta.Annotations = maps.Clone(*service.Annotations)
+	}
+	return ret, nil
+}
+
+func generateServicePorts(name string, serviceType corev1.ServiceType, ports []corev1.ServicePort) ([]corev1.ServicePort, error) {
+	ret := []corev1.ServicePort{}
+	names := map[string]bool{}
+	for _, port := range ports {
+		if port.Port < 1 || port.Port > 65535 {
+			return nil, fmt.Errorf("service %s: port %d out of range", name, port.Port)
+		}
+		if len(ports) > 1 {
+			if port.Name == "" {
+				return nil, fmt.Errorf("service %s: port %d needs a name, the service has several ports", name, port.Port)
+			}
+			if names[port.Name] {
+				return nil, fmt.Errorf("service %s: port name %s used twice", name, port.Name)
+			}
+			names[port.Name] = true
+		}
+		if port.Protocol == "" {
+			port.Protocol = corev1.ProtocolTCP
+		}
+		switch port.Protocol {
+		case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		default:
+			return nil, fmt.Errorf("service %s: port %d has unknown protocol %s", name, port.Port, port.Protocol)
+		}
+		if port.TargetPort.Type == intstr.String {
+			if errs := validation.IsValidPortName(port.TargetPort.StrVal); port.TargetPort.StrVal != "" && len(errs) > 0 {
+				return nil, fmt.Errorf("service %s: target port %s: %v", name, port.TargetPort.StrVal, errs)
+			}
+		}
+		if port.NodePort != 0 && serviceType != corev1.ServiceTypeNodePort && serviceType != corev1.ServiceTypeLoadBalancer {
+			return nil, fmt.Errorf("service %s: node port %d requires the NodePort or LoadBalancer type", name, port.NodePort)
+		}
+		ret = append(ret, port)
+	}
+	return ret, nil
+}
+
+// ProvisionService creates the service in the active namespace.
+func (kapi *KubAPI) ProvisionService(ctx context.Context, service *Service) (*corev1.Service, error) {
+	namespace, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	return kapi.provisionService(ctx, *namespace, service)
+}
+
+// provisionService creates the service in namespace without the active namespace check, for
+// CreateService which has always allowed any namespace.
+func (kapi *KubAPI) provisionService(ctx context.Context, namespace string, service *Service) (*corev1.Service, error) {
+	k8sService, err := service.GenerateService()
+	if err != nil {
+		return nil, err
+	}
+	k8sService.Namespace = namespace
+
+	op := kapi.startOperation(ctx, "create", "Service", k8sService.Name)
+	op.setDiff(k8sService)
+	createdService, err := kapi.clientset.CoreV1().Services(namespace).Create(op.ctx, k8sService, metav1.CreateOptions{})
+	if err != nil {
+		kapi.finishOperation(op, err)
+		return nil, err
+	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(createdService.UID)))
+	return createdService, nil
+}
+
+func (kapi *KubAPI) GetService(ctx context.Context, name string) (*corev1.Service, error) {
+	op := kapi.startOperation(ctx, "get", "Service", name)
+	ret, err := kapi.clientset.CoreV1().Services(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	kapi.finishOperation(op, err)
+	return ret, err
+}
+
+func (kapi *KubAPI) DeleteService(ctx context.Context, name string) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "delete", "Service", name)
+	err = kapi.clientset.CoreV1().Services(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	kapi.finishOperation(op, err)
+	return err
+}
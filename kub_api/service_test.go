@@ -0,0 +1,134 @@
+package kub_api
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGenerateService(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		name := "test"
+		serviceType := corev1.ServiceTypeLoadBalancer
+		ports := []corev1.ServicePort{
+			ServicePortNew("http", 80, "web", ""),
+			ServicePortNew("metrics", 9090, "9091", corev1.ProtocolTCP),
+			ServicePortNew("dns", 53, "", corev1.ProtocolUDP),
+		}
+		affinity := corev1.ServiceAffinityClientIP
+		timeout := int32(600)
+		trafficPolicy := corev1.ServiceExternalTrafficPolicyLocal
+		families := []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+		familyPolicy := corev1.IPFamilyPolicyPreferDualStack
+		annotations := map[string]string{"service.beta.kubernetes.io/aws-load-balancer-type": "nlb"}
+		service := Service{
+			ServiceName: &name, Type: &serviceType, Ports: &ports, Selector: &map[string]string{"app": "test"},
+			SessionAffinity: &affinity, SessionAffinityTimeoutSeconds: &timeout, ExternalTrafficPolicy: &trafficPolicy,
+			IPFamilies: &families, IPFamilyPolicy: &familyPolicy, Annotations: &annotations,
+		}
+
+		k8sService, err := service.GenerateService()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		spec := k8sService.Spec
+		if spec.Ports[0].TargetPort != intstr.FromString("web") || spec.Ports[1].TargetPort != intstr.FromInt32(9091) || spec.Ports[0].Protocol != corev1.ProtocolTCP || spec.Ports[2].Protocol != corev1.ProtocolUDP {
+			t.Errorf("unexpected ports %+v", spec.Ports)
+		}
+		if *spec.SessionAffinityConfig.ClientIP.TimeoutSeconds != 600 || spec.ExternalTrafficPolicy != trafficPolicy || len(spec.IPFamilies) != 2 {
+			t.Errorf("unexpected spec %+v", spec)
+		}
+		if k8sService.Annotations["service.beta.kubernetes.io/aws-load-balancer-type"] != "nlb" {
+			t.Errorf("unexpected annotations %v", k8sService.Annotations)
+		}
+
+		headless := true
+		k8sService, err = (&Service{ServiceName: &name, Headless: &headless}).GenerateService()
+		if err != nil || k8sService.Spec.ClusterIP != corev1.ClusterIPNone {
+			t.Errorf("expected headless service: %v", err)
+		}
+
+		externalType := corev1.ServiceTypeExternalName
+		externalName := "db.example.com"
+		k8sService, err = (&Service{ServiceName: &name, Type: &externalType, ExternalName: &externalName}).GenerateService()
+		if err != nil || k8sService.Spec.ExternalName != externalName {
+			t.Errorf("expected external name service: %v", err)
+		}
+	})
+
+	t.Run("Invalid services", func(t *testing.T) {
+		name := "test"
+		clusterIP := corev1.ServiceTypeClusterIP
+		headless := true
+		nodePortType := corev1.ServiceTypeNodePort
+		unnamed := []corev1.ServicePort{{Port: 80}, {Port: 443}}
+		nodePort := []corev1.ServicePort{{Port: 80, NodePort: 30080}}
+		single := []corev1.ServicePort{{Port: 80}}
+		trafficPolicy := corev1.ServiceExternalTrafficPolicyLocal
+		timeout := int32(10)
+		invalidName := "Test_Service"
+		for description, service := range map[string]Service{
+			"missing ports":          {ServiceName: &name},
+			"unnamed ports":          {ServiceName: &name, Ports: &unnamed},
+			"node port on ClusterIP": {ServiceName: &name, Type: &clusterIP, Ports: &nodePort},
+			"headless NodePort":      {ServiceName: &name, Type: &nodePortType, Headless: &headless, Ports: &single},
+			"traffic policy":         {ServiceName: &name, Ports: &single, ExternalTrafficPolicy: &trafficPolicy},
+			"affinity timeout":       {ServiceName: &name, Ports: &single, SessionAffinityTimeoutSeconds: &timeout},
+			"invalid name":           {ServiceName: &invalidName, Ports: &single},
+		} {
+			_, err := service.GenerateService()
+			if err == nil {
+				t.Errorf("%s: expected error", description)
+			}
+		}
+	})
+}
+
+func TestProvisionService(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+
+		name := "test"
+		err := api.CreateService(&name, 80, map[string]string{"app": "test"})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		service, err := api.GetService(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if service.Spec.Type != corev1.ServiceTypeClusterIP || service.Spec.Ports[0].Name != "http" || service.Spec.Ports[0].Port != 80 {
+			t.Errorf("unexpected service %+v", service.Spec)
+		}
+
+		err = api.DeleteService(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		_, err = api.GetService(context.Background(), name)
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("expected deleted service, got %v", err)
+		}
+	})
+
+	t.Run("Default namespace", func(t *testing.T) {
+		namespace := "default"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+
+		name := "test"
+		err := api.CreateService(&name, 80, map[string]string{"app": "test"})
+		if err != nil {
+			t.Errorf("CreateService keeps working in the default namespace, got %v", err)
+		}
+		ports := []corev1.ServicePort{ServicePortNew("http", 80, "", corev1.ProtocolTCP)}
+		_, err = api.ProvisionService(context.Background(), &Service{ServiceName: &name, Ports: &ports})
+		if err == nil {
+			t.Errorf("expected ProvisionService to require an active namespace")
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package kub_api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Certificate states, from healthy to broken.
+const (
+	CertificateOK       = "OK"
+	CertificateExpiring = "Expiring"
+	CertificateExpired  = "Expired"
+	CertificateInvalid  = "Invalid"
+	CertificateMissing  = "Missing"
+)
+
+// CertificateReport describes the leaf certificate of a TLS secret and how the ingresses
+// referencing the secret are covered by it.
+type CertificateReport struct {
+	Namespace string    `json:"namespace"`
+	Secret    string    `json:"secret"`
+	Status    string    `json:"status"`
+	Subject   string    `json:"subject,omitempty"`
+	DNSNames  []string  `json:"dnsNames,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	NotBefore time.Time `json:"notBefore,omitempty"`
+	NotAfter  time.Time `json:"notAfter,omitempty"`
+	DaysLeft  int       `json:"daysLeft"`
+	// Ingresses are the ingresses referencing the secret.
+	Ingresses []string `json:"ingresses,omitempty"`
+	// UncoveredHosts are TLS hosts of those ingresses the certificate is not valid for.
+	UncoveredHosts []string `json:"uncoveredHosts,omitempty"`
+	Error          string   `json:"error,omitempty"`
+
+	certificate *x509.Certificate
+}
+
+// Healthy reports whether the certificate is valid for longer than the warning window and
+// covers all of its hosts.
+func (report *CertificateReport) Healthy() bool {
+	return report.Status == CertificateOK && len(report.UncoveredHosts) == 0
+}
+
+// ScanTLSCertificates reports the certificates of the TLS secrets of the active namespace and of
+// the secrets referenced by its ingresses. Certificates expiring within warnDays are Expiring.
+func (kapi *KubAPI) ScanTLSCertificates(ctx context.Context, warnDays int) ([]CertificateReport, error) {
+	ingresses, err := kapi.GetIngresses()
+	if err != nil {
+		return nil, err
+	}
+
+	op := kapi.startOperation(ctx, "list", "Secret", "")
+	secrets, err := kapi.clientset.CoreV1().Secrets(*kapi.Namespace).List(op.ctx, metav1.ListOptions{FieldSelector: "type=" + string(corev1.SecretTypeTLS)})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	tlsSecrets := []corev1.Secret{}
+	for _, secret := range secrets.Items {
+		if secret.Type == corev1.SecretTypeTLS {
+			tlsSecrets = append(tlsSecrets, secret)
+		}
+	}
+	return BuildCertificateReports(tlsSecrets, ingresses, time.Now(), warnDays), nil
+}
+
+// BuildCertificateReports reports every secret and every ingress TLS secret that is not in secrets.
+func BuildCertificateReports(secrets []corev1.Secret, ingresses []networkingv1.Ingress, now time.Time, warnDays int) []CertificateReport {
+	reports := map[string]*CertificateReport{}
+	for index := range secrets {
+		report := CertificateReportFromSecret(&secrets[index], now, warnDays)
+		reports[report.Namespace+"/"+report.Secret] = &report
+	}
+
+	for _, ingress := range ingresses {
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == "" {
+				continue
+			}
+			key := ingress.Namespace + "/" + tls.SecretName
+			report, ok := reports[key]
+			if !ok {
+				report = &CertificateReport{Namespace: ingress.Namespace, Secret: tls.SecretName, Status: CertificateMissing, Error: "secret does not exist"}
+				reports[key] = report
+			}
+			if !slices.Contains(report.Ingresses, ingress.Name) {
+				report.Ingresses = append(report.Ingresses, ingress.Name)
+			}
+			if report.certificate == nil {
+				continue
+			}
+			for _, host := range tls.Hosts {
+				if report.certificate.VerifyHostname(host) == nil {
+					continue
+				}
+				if !slices.Contains(report.UncoveredHosts, host) {
+					report.UncoveredHosts = append(report.UncoveredHosts, host)
+				}
+			}
+		}
+	}
+
+	ret := []CertificateReport{}
+	for _, report := range reports {
+		ret = append(ret, *report)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Secret < ret[j].Secret
+	})
+	return ret
+}
+
+// CertificateReportFromSecret parses the leaf certificate, the first one of tls.crt.
+func CertificateReportFromSecret(secret *corev1.Secret, now time.Time, warnDays int) CertificateReport {
+	ret := CertificateReport{Namespace: secret.Namespace, Secret: secret.Name, Status: CertificateInvalid}
+	certificate, err := parseLeafCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+	ret.certificate = certificate
+	ret.Subject = certificate.Subject.String()
+	ret.DNSNames = certificate.DNSNames
+	ret.Issuer = certificate.Issuer.String()
+	ret.NotBefore = certificate.NotBefore
+	ret.NotAfter = certificate.NotAfter
+	ret.DaysLeft = int(certificate.NotAfter.Sub(now).Hours() / 24)
+
+	switch {
+	case !now.Before(certificate.NotAfter):
+		ret.Status = CertificateExpired
+	case now.Before(certificate.NotBefore):
+		ret.Error = "certificate is not valid yet"
+	case certificate.NotAfter.Sub(now) < time.Duration(warnDays)*24*time.Hour:
+		ret.Status = CertificateExpiring
+	default:
+		ret.Status = CertificateOK
+	}
+	return ret
+}
+
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("secret has no %s", corev1.TLSCertKey)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s has no PEM certificate", corev1.TLSCertKey)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", corev1.TLSCertKey, err)
+		}
+		return certificate, nil
+	}
+}
+
+// String renders the report as one line, e.g. for a cron mail.
+func (report *CertificateReport) String() string {
+	parts := []string{report.Namespace + "/" + report.Secret, report.Status}
+	if !report.NotAfter.IsZero() {
+		parts = append(parts, fmt.Sprintf("expires %s (%d days)", report.NotAfter.Format(time.RFC3339), report.DaysLeft))
+	}
+	if len(report.UncoveredHosts) > 0 {
+		parts = append(parts, "uncovered hosts "+strings.Join(report.UncoveredHosts, ","))
+	}
+	if report.Error != "" {
+		parts = append(parts, report.Error)
+	}
+	return strings.Join(parts, ": ")
+}
@@ -0,0 +1,104 @@
+package kub_api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testTLSSecret(name string, notAfter time.Time, dnsNames ...string) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})},
+	}
+}
+
+func TestBuildCertificateReports(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		now := time.Now()
+		invalid := testTLSSecret("invalid", now, "invalid.example.com")
+		invalid.Data[corev1.TLSCertKey] = []byte("not a certificate")
+		secrets := []corev1.Secret{
+			*testTLSSecret("wildcard", now.Add(60*24*time.Hour), "*.example.com"),
+			*testTLSSecret("soon", now.Add(10*24*time.Hour), "soon.example.com"),
+			*testTLSSecret("expired", now.Add(-time.Hour), "old.example.com"),
+			*invalid,
+		}
+		app := testInventoryIngress("test", "app", "", "app.example.com", "web", "80", "wildcard")
+		app.Spec.TLS[0].Hosts = append(app.Spec.TLS[0].Hosts, "example.com")
+		ingresses := []networkingv1.Ingress{*app, *testInventoryIngress("test", "lost", "", "lost.example.com", "web", "80", "lost-tls")}
+
+		reports := BuildCertificateReports(secrets, ingresses, now, 30)
+		statuses := map[string]*CertificateReport{}
+		for index := range reports {
+			statuses[reports[index].Secret] = &reports[index]
+		}
+		for secret, expected := range map[string]string{
+			"wildcard": CertificateOK, "soon": CertificateExpiring, "expired": CertificateExpired,
+			"invalid": CertificateInvalid, "lost-tls": CertificateMissing,
+		} {
+			if statuses[secret] == nil || statuses[secret].Status != expected {
+				t.Errorf("%s: expected %s, got %+v", secret, expected, statuses[secret])
+			}
+		}
+
+		wildcard := statuses["wildcard"]
+		if wildcard.DaysLeft != 59 || wildcard.Ingresses[0] != "app" || wildcard.Healthy() {
+			t.Errorf("unexpected report %+v", wildcard)
+		}
+		if len(wildcard.UncoveredHosts) != 1 || wildcard.UncoveredHosts[0] != "example.com" {
+			t.Errorf("expected example.com to be uncovered, got %v", wildcard.UncoveredHosts)
+		}
+		if !strings.Contains(wildcard.String(), "uncovered hosts example.com") {
+			t.Errorf("unexpected line %s", wildcard.String())
+		}
+	})
+}
+
+func TestScanTLSCertificates(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(
+			testTLSSecret("app-tls", time.Now().Add(100*24*time.Hour), "app.example.com"),
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "opaque"}},
+			testInventoryIngress("test", "app", "", "app.example.com", "web", "80", "app-tls"),
+		)}
+
+		reports, err := api.ScanTLSCertificates(context.Background(), 30)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if len(reports) != 1 || !reports[0].Healthy() || reports[0].Ingresses[0] != "app" {
+			t.Errorf("unexpected reports %+v", reports)
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const tracerName = "github.com/AlexeyBeley/k8s_go/kub_api"
+
+// TraceAnnotationPrefix prefixes the W3C trace context keys injected into Job annotations.
+const TraceAnnotationPrefix = "kub-api.trace/"
+
+// Span attribute keys.
+const (
+	TraceAttrNamespace = attribute.Key("k8s.namespace.name")
+	TraceAttrKind      = attribute.Key("k8s.kind")
+	TraceAttrName      = attribute.Key("k8s.object.name")
+	TraceAttrVerb      = attribute.Key("k8s.verb")
+	TraceAttrJobName   = attribute.Key("k8s.job.name")
+)
+
+// tracer returns a tracer of the configured provider, or of the global one which is a no-op
+// unless the application installed a provider.
+func (kapi *KubAPI) tracer() trace.Tracer {
+	if kapi.TracerProvider != nil {
+		return kapi.TracerProvider.Tracer(tracerName)
+	}
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+func (kapi *KubAPI) startSpan(op *operation) {
+	spanName := op.method
+	if spanName == "" {
+		spanName = op.verb + " " + op.kind
+	}
+	op.ctx, op.span = kapi.tracer().Start(op.ctx, spanName, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		TraceAttrVerb.String(op.verb),
+		TraceAttrKind.String(op.kind),
+		TraceAttrNamespace.String(op.namespace),
+		TraceAttrName.String(op.name),
+	))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracerProviderNewOTLP exports spans over OTLP/HTTP to endpoint, e.g. "localhost:4318".
+func TracerProviderNewOTLP(ctx context.Context, endpoint string, insecure bool) (*sdktrace.TracerProvider, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter)), nil
+}
+
+// TracerProviderNewWriter writes spans as JSON to dst, e.g. os.Stdout or a file.
+func TracerProviderNewWriter(dst io.Writer) (*sdktrace.TracerProvider, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(dst))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil
+}
+
+// InjectTraceContext propagates the span in ctx to the workload: as annotations on the Job
+// and as TRACEPARENT/TRACESTATE environment variables of its container.
+func InjectTraceContext(ctx context.Context, job *Job) {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return
+	}
+
+	if job.Annotations == nil {
+		job.Annotations = &map[string]string{}
+	}
+	if job.ContainerEnv == nil {
+		job.ContainerEnv = &[]corev1.EnvVar{}
+	}
+	for _, key := range carrier.Keys() {
+		(*job.Annotations)[TraceAnnotationPrefix+key] = carrier.Get(key)
+		*job.ContainerEnv = setEnvVar(*job.ContainerEnv, strings.ToUpper(key), carrier.Get(key))
+	}
+}
+
+// ExtractTraceContext returns ctx carrying the remote span stored in the Job annotations.
+func ExtractTraceContext(ctx context.Context, batchJob *batchv1.Job) context.Context {
+	carrier := propagation.MapCarrier{}
+	for key, value := range batchJob.Annotations {
+		if strings.HasPrefix(key, TraceAnnotationPrefix) {
+			carrier[strings.TrimPrefix(key, TraceAnnotationPrefix)] = value
+		}
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+func setEnvVar(env []corev1.EnvVar, name, value string) []corev1.EnvVar {
+	for index := range env {
+		if env[index].Name == name {
+			env[index].Value = value
+			env[index].ValueFrom = nil
+			return env
+		}
+	}
+	return append(env, corev1.EnvVar{Name: name, Value: value})
+}
+
+// JobRunResult is the outcome of RunJob.
+type JobRunResult struct {
+	Job  *batchv1.Job
+	Logs map[string]string
+}
+
+// RunJob creates the job and follows it through scheduling, running, completion, log collection
+// and cleanup under a single parent span with one child span per phase. When a phase fails the
+// job is still cleaned up.
+func (kapi *KubAPI) RunJob(ctx context.Context, job *Job) (ret *JobRunResult, err error) {
+	ctx, span := kapi.tracer().Start(ctx, "JobLifecycle", trace.WithAttributes(
+		TraceAttrNamespace.String(*kapi.Namespace),
+		TraceAttrJobName.String(*job.JobName),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ret = &JobRunResult{}
+	err = kapi.runJobPhase(ctx, "JobCreate", func(ctx context.Context) error {
+		InjectTraceContext(ctx, job)
+		return kapi.createJob(ctx, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		// Cleanup also runs when ctx was cancelled, so a failed run leaves no job behind.
+		return kapi.runJobPhase(context.WithoutCancel(ctx), "JobCleanup", func(ctx context.Context) error {
+			return kapi.deleteJob(ctx, *job.JobName, metav1.DeletePropagationBackground)
+		})
+	}
+
+	err = kapi.runJobPhase(ctx, "JobPodScheduling", func(ctx context.Context) error {
+		return kapi.waitForJobPod(ctx, *job.JobName, isPodScheduled)
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	err = kapi.runJobPhase(ctx, "JobRunning", func(ctx context.Context) error {
+		return kapi.waitForJobPod(ctx, *job.JobName, func(pod *corev1.Pod) bool {
+			return pod.Status.Phase != corev1.PodPending
+		})
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	err = kapi.runJobPhase(ctx, "JobCompletion", func(ctx context.Context) error {
+		batchJob, err := kapi.WaitForJob(ctx, *job.JobName)
+		ret.Job = batchJob
+		return err
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	err = kapi.runJobPhase(ctx, "JobLogCollection", func(ctx context.Context) error {
+		logs, err := kapi.GetJobLogs(ctx, *job.JobName)
+		ret.Logs = logs
+		return err
+	})
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	err = cleanup()
+	if err != nil {
+		return nil, err
+	}
+	if !IsJobSucceeded(ret.Job) {
+		span.SetStatus(codes.Error, fmt.Sprintf("job %s failed", *job.JobName))
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) runJobPhase(ctx context.Context, name string, phase func(ctx context.Context) error) error {
+	ctx, span := kapi.tracer().Start(ctx, name)
+	err := phase(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func isPodScheduled(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForJobPod blocks until any pod of the job satisfies condition. It fails when the job
+// fails or is suspended first, e.g. a job whose pods never start because of image pull errors.
+func (kapi *KubAPI) waitForJobPod(ctx context.Context, jobName string, condition func(pod *corev1.Pod) bool) error {
+	podOptions := metav1.ListOptions{LabelSelector: "job-name=" + jobName}
+	jobOptions := metav1.ListOptions{FieldSelector: "metadata.name=" + jobName}
+	for {
+		podWatch, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).Watch(ctx, podOptions)
+		if err != nil {
+			return err
+		}
+		jobWatch, err := kapi.clientset.BatchV1().Jobs(*kapi.Namespace).Watch(ctx, jobOptions)
+		if err != nil {
+			podWatch.Stop()
+			return err
+		}
+		done, err := waitForJobPodEvent(podWatch, jobWatch, jobName, condition)
+		podWatch.Stop()
+		jobWatch.Stop()
+		if done || err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		kapi.observeWatchReconnect("Pod")
+	}
+}
+
+// waitForJobPodEvent reads both watches until the pod condition is met, the job ends the wait or
+// a watch closes, which returns false for a reconnect.
+func waitForJobPodEvent(podWatch, jobWatch watch.Interface, jobName string, condition func(pod *corev1.Pod) bool) (bool, error) {
+	for {
+		select {
+		case event, ok := <-podWatch.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			pod, ok := event.Object.(*corev1.Pod)
+			if ok && condition(pod) {
+				return true, nil
+			}
+		case event, ok := <-jobWatch.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			batchJob, ok := event.Object.(*batchv1.Job)
+			if !ok || batchJob.Name != jobName {
+				continue
+			}
+			if IsJobSucceeded(batchJob) {
+				return true, nil
+			}
+			for _, jobCondition := range batchJob.Status.Conditions {
+				if jobCondition.Type == batchv1.JobFailed && jobCondition.Status == corev1.ConditionTrue {
+					return true, fmt.Errorf("job %s failed before its pods ran: %s: %s", jobName, jobCondition.Reason, jobCondition.Message)
+				}
+			}
+			if batchJob.Spec.Suspend != nil && *batchJob.Spec.Suspend {
+				return true, fmt.Errorf("job %s is suspended", jobName)
+			}
+		}
+	}
+}
+
+func IsJobSucceeded(batchJob *batchv1.Job) bool {
+	if batchJob == nil {
+		return false
+	}
+	for _, condition := range batchJob.Status.Conditions {
+		if condition.Type == batchv1.JobComplete && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJobLogs returns the logs of every pod of the job keyed by pod name.
+func (kapi *KubAPI) GetJobLogs(ctx context.Context, jobName string) (map[string]string, error) {
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]string{}
+	for _, pod := range pods.Items {
+		op := kapi.startOperation(ctx, "get", "PodLog", pod.Name)
+		data, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(op.ctx)
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+		ret[pod.Name] = string(data)
+	}
+	return ret, nil
+}
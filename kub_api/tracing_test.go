@@ -0,0 +1,148 @@
+package kub_api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestOperationSpan(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		exporter := tracetest.NewInMemoryExporter()
+		api := KubAPI{Namespace: &namespace, TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+
+		op := api.startOperation(context.Background(), "delete", "Job", "test")
+		api.finishOperation(op, errors.New("not found"))
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(spans))
+		}
+		if spans[0].Status.Code != codes.Error {
+			t.Errorf("unexpected status %v", spans[0].Status)
+		}
+		attributes := map[string]string{}
+		for _, attr := range spans[0].Attributes {
+			attributes[string(attr.Key)] = attr.Value.AsString()
+		}
+		if attributes[string(TraceAttrNamespace)] != "test" || attributes[string(TraceAttrKind)] != "Job" {
+			t.Errorf("unexpected attributes %v", attributes)
+		}
+	})
+}
+
+func TestInjectTraceContext(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		provider := sdktrace.NewTracerProvider()
+		ctx, span := provider.Tracer("test").Start(context.Background(), "parent")
+		defer span.End()
+
+		name := "test"
+		containerImage := "busybox:1.28"
+		containerCommand := []string{"/bin/sh", "-c", "echo Hello"}
+		job := Job{JobName: &name, ContainerName: &name, ContainerImage: &containerImage, ContainerCommand: &containerCommand}
+		InjectTraceContext(ctx, &job)
+
+		batchJob, err := job.GenerateBatchJob()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if batchJob.Annotations[TraceAnnotationPrefix+"traceparent"] == "" {
+			t.Errorf("missing traceparent annotation %v", batchJob.Annotations)
+		}
+		env := batchJob.Spec.Template.Spec.Containers[0].Env
+		if len(env) == 0 || env[0].Name != "TRACEPARENT" {
+			t.Errorf("missing TRACEPARENT env %v", env)
+		}
+
+		extracted := ExtractTraceContext(context.Background(), batchJob)
+		if trace.SpanContextFromContext(extracted).TraceID() != span.SpanContext().TraceID() {
+			t.Errorf("extracted trace does not match")
+		}
+	})
+}
+
+func TestRunJob(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		realConfig := loadRealConfig()
+
+		api, err := KubAPINew()
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		api.Namespace = realConfig.Namespace
+		exporter := tracetest.NewInMemoryExporter()
+		api.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		name := "test-traced"
+		containerImage := "busybox:1.28"
+		containerCommand := []string{"/bin/sh", "-c", "echo $TRACEPARENT"}
+		job := Job{JobName: &name, ContainerName: &name, ContainerImage: &containerImage, ContainerCommand: &containerCommand}
+
+		ret, err := api.RunJob(context.Background(), &job)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if len(ret.Logs) == 0 {
+			t.Errorf("no logs collected")
+		}
+	})
+}
+
+func TestRunJobFailsBeforePodStarts(t *testing.T) {
+	for description, status := range map[string]func(batchJob *batchv1.Job){
+		"failed": func(batchJob *batchv1.Job) {
+			batchJob.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+		},
+		"suspended": func(batchJob *batchv1.Job) {
+			suspend := true
+			batchJob.Spec.Suspend = &suspend
+		},
+	} {
+		t.Run(description, func(t *testing.T) {
+			namespace := "test"
+			clientset := fake.NewSimpleClientset()
+			jobWatch := watch.NewFakeWithChanSize(1, false)
+			clientset.PrependWatchReactor("jobs", func(action k8stesting.Action) (bool, watch.Interface, error) {
+				batchJob := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace}}
+				status(batchJob)
+				jobWatch.Modify(batchJob)
+				return true, jobWatch, nil
+			})
+			exporter := tracetest.NewInMemoryExporter()
+			api := KubAPI{Namespace: &namespace, clientset: clientset, TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+
+			_, err := api.RunJob(context.Background(), testQueueJob("test", map[string]string{}))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			phases := map[string]codes.Code{}
+			for _, span := range exporter.GetSpans() {
+				phases[span.Name] = span.Status.Code
+			}
+			if phases["JobPodScheduling"] != codes.Error {
+				t.Errorf("expected failed scheduling span, got %v", phases)
+			}
+			if _, ok := phases["JobCleanup"]; !ok {
+				t.Errorf("cleanup did not run: %v", phases)
+			}
+			_, err = clientset.BatchV1().Jobs(namespace).Get(context.Background(), "test", metav1.GetOptions{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("expected the job to be deleted, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package kub_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Phases of a workflow step.
+const (
+	WorkflowStepPending   = "Pending"
+	WorkflowStepRunning   = "Running"
+	WorkflowStepSucceeded = "Succeeded"
+	WorkflowStepFailed    = "Failed"
+	WorkflowStepSkipped   = "Skipped"
+)
+
+// Labels put on every object created by the workflow runner.
+const (
+	WorkflowLabel     = "kub-api/workflow"
+	WorkflowStepLabel = "kub-api/workflow-step"
+)
+
+// WorkflowStateKey is the ConfigMap data key holding the serialized WorkflowState.
+const WorkflowStateKey = "state"
+
+// WorkflowStep runs Job once its dependencies succeeded or were skipped.
+//
+// A step publishes outputs by writing KEY=VALUE lines to its termination message
+// (/dev/termination-log). The runner stores them in the ConfigMap "<workflow>-<step>-outputs"
+// and exposes them to dependent steps as environment variables prefixed with the
+// upper-cased step name, e.g. PREPARE_SHARDS.
+type WorkflowStep struct {
+	Name      string
+	Job       Job
+	DependsOn []string
+	// When decides from the outputs of finished steps whether the step runs or is skipped.
+	When    func(outputs map[string]map[string]string) bool
+	Retries int
+}
+
+type Workflow struct {
+	Name  string
+	Steps []*WorkflowStep
+	// MaxConcurrency limits the number of steps running at once, unlimited when 0.
+	MaxConcurrency int
+}
+
+type WorkflowStepState struct {
+	Phase    string `json:"phase"`
+	Attempts int    `json:"attempts,omitempty"`
+	JobName  string `json:"jobName,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type WorkflowState struct {
+	Steps map[string]*WorkflowStepState `json:"steps"`
+}
+
+// Validate checks step names and dependencies and returns the steps in topological order.
+func (workflow *Workflow) Validate() ([]*WorkflowStep, error) {
+	if workflow.Name == "" {
+		return nil, fmt.Errorf("workflow name is required")
+	}
+	steps := map[string]*WorkflowStep{}
+	for _, step := range workflow.Steps {
+		if step.Name == "" {
+			return nil, fmt.Errorf("workflow %s: step name is required", workflow.Name)
+		}
+		if _, ok := steps[step.Name]; ok {
+			return nil, fmt.Errorf("workflow %s: step %s declared twice", workflow.Name, step.Name)
+		}
+		if step.Job.ContainerImage == nil {
+			return nil, fmt.Errorf("workflow %s: step %s has no container image", workflow.Name, step.Name)
+		}
+		steps[step.Name] = step
+	}
+	for _, step := range workflow.Steps {
+		for _, dependency := range step.DependsOn {
+			if _, ok := steps[dependency]; !ok {
+				return nil, fmt.Errorf("workflow %s: step %s depends on unknown step %s", workflow.Name, step.Name, dependency)
+			}
+		}
+	}
+
+	ret := []*WorkflowStep{}
+	visited := map[string]int{} // 1 - in progress, 2 - done
+	var visit func(step *WorkflowStep) error
+	visit = func(step *WorkflowStep) error {
+		switch visited[step.Name] {
+		case 1:
+			return fmt.Errorf("workflow %s: dependency cycle through step %s", workflow.Name, step.Name)
+		case 2:
+			return nil
+		}
+		visited[step.Name] = 1
+		for _, dependency := range step.DependsOn {
+			err := visit(steps[dependency])
+			if err != nil {
+				return err
+			}
+		}
+		visited[step.Name] = 2
+		ret = append(ret, step)
+		return nil
+	}
+	for _, step := range workflow.Steps {
+		err := visit(step)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (workflow *Workflow) stateConfigMapName() string {
+	return workflow.Name + "-workflow-state"
+}
+
+func (workflow *Workflow) outputsConfigMapName(step string) string {
+	return workflow.Name + "-" + step + "-outputs"
+}
+
+func workflowOutputsEnvPrefix(step string) string {
+	return strings.ToUpper(strings.ReplaceAll(step, "-", "_")) + "_"
+}
+
+// ParseWorkflowOutputs reads KEY=VALUE lines of a termination message.
+func ParseWorkflowOutputs(message string) map[string]string {
+	ret := map[string]string{}
+	for _, line := range strings.Split(message, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && key != "" {
+			ret[key] = value
+		}
+	}
+	return ret
+}
+
+type workflowStepResult struct {
+	step    *WorkflowStep
+	outputs map[string]string
+	err     error
+}
+
+type workflowRunner struct {
+	kapi      *KubAPI
+	workflow  *Workflow
+	order     []*WorkflowStep
+	state     *WorkflowState
+	outputs   map[string]map[string]string
+	configMap *corev1.ConfigMap
+}
+
+// RunWorkflow runs the workflow to completion. Its state is kept in a ConfigMap, so calling
+// RunWorkflow again after a restart continues where the previous runner left off; steps that
+// failed are retried with one more attempt.
+func (kapi *KubAPI) RunWorkflow(ctx context.Context, workflow *Workflow) (*WorkflowState, error) {
+	order, err := workflow.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	runner := workflowRunner{kapi: kapi, workflow: workflow, order: order, outputs: map[string]map[string]string{}}
+	err = runner.loadState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = runner.run(ctx)
+	return runner.state, err
+}
+
+func (runner *workflowRunner) loadState(ctx context.Context) error {
+	kapi := runner.kapi
+	runner.state = &WorkflowState{Steps: map[string]*WorkflowStepState{}}
+
+	op := kapi.startOperation(ctx, "get", "ConfigMap", runner.workflow.stateConfigMapName())
+	configMap, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Get(op.ctx, runner.workflow.stateConfigMapName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		kapi.finishOperation(op, nil)
+	} else {
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return err
+		}
+		runner.configMap = configMap
+		err = json.Unmarshal([]byte(configMap.Data[WorkflowStateKey]), runner.state)
+		if err != nil {
+			return fmt.Errorf("workflow %s: corrupted state: %w", runner.workflow.Name, err)
+		}
+	}
+
+	for _, step := range runner.order {
+		stepState, ok := runner.state.Steps[step.Name]
+		if !ok {
+			runner.state.Steps[step.Name] = &WorkflowStepState{Phase: WorkflowStepPending}
+			continue
+		}
+		if stepState.Phase == WorkflowStepFailed {
+			// Running the workflow again retries the steps that failed in an earlier run.
+			stepState.Phase = WorkflowStepPending
+			continue
+		}
+		if stepState.Phase != WorkflowStepSucceeded {
+			continue
+		}
+		outputs, err := kapi.getConfigMapData(ctx, runner.workflow.outputsConfigMapName(step.Name))
+		if err != nil {
+			return err
+		}
+		runner.outputs[step.Name] = outputs
+	}
+	return nil
+}
+
+func (runner *workflowRunner) saveState(ctx context.Context) error {
+	data, err := json.Marshal(runner.state)
+	if err != nil {
+		return err
+	}
+	if runner.configMap == nil {
+		runner.configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      runner.workflow.stateConfigMapName(),
+				Namespace: *runner.kapi.Namespace,
+				Labels:    map[string]string{WorkflowLabel: runner.workflow.Name},
+			},
+		}
+	}
+	runner.configMap.Data = map[string]string{WorkflowStateKey: string(data)}
+	configMap, err := runner.kapi.ApplyConfigMap(ctx, runner.configMap)
+	if err != nil {
+		return err
+	}
+	runner.configMap = configMap
+	return nil
+}
+
+// ready reports whether every dependency of step succeeded or was skipped.
+func (runner *workflowRunner) ready(step *WorkflowStep) bool {
+	for _, dependency := range step.DependsOn {
+		switch runner.state.Steps[dependency].Phase {
+		case WorkflowStepSucceeded, WorkflowStepSkipped:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (runner *workflowRunner) run(ctx context.Context) error {
+	results := make(chan workflowStepResult)
+	launched := map[string]bool{}
+	running := 0
+	var failure error
+
+	for {
+		for _, step := range runner.order {
+			if failure != nil || ctx.Err() != nil {
+				break
+			}
+			if runner.workflow.MaxConcurrency > 0 && running >= runner.workflow.MaxConcurrency {
+				break
+			}
+			stepState := runner.state.Steps[step.Name]
+			resume := false
+			switch stepState.Phase {
+			case WorkflowStepRunning:
+				// Left running by a previous runner, wait for its job again.
+				if launched[step.Name] {
+					continue
+				}
+				resume = true
+			case WorkflowStepPending:
+				if !runner.ready(step) {
+					continue
+				}
+				if step.When != nil && !step.When(runner.outputs) {
+					stepState.Phase = WorkflowStepSkipped
+					failure = runner.saveState(ctx)
+					continue
+				}
+				stepState.Phase = WorkflowStepRunning
+				stepState.Attempts++
+				stepState.JobName = fmt.Sprintf("%s-%s-%d", runner.workflow.Name, step.Name, stepState.Attempts)
+				stepState.Message = ""
+				failure = runner.saveState(ctx)
+				if failure != nil {
+					continue
+				}
+			default:
+				continue
+			}
+
+			launched[step.Name] = true
+			running++
+			go func(step *WorkflowStep, jobName string, resume bool) {
+				outputs, err := runner.runStep(ctx, step, jobName, resume)
+				results <- workflowStepResult{step: step, outputs: outputs, err: err}
+			}(step, stepState.JobName, resume)
+		}
+
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		launched[result.step.Name] = false
+		err := runner.finishStep(ctx, result)
+		if err != nil && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return failure
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	notRun := []string{}
+	for _, step := range runner.order {
+		switch runner.state.Steps[step.Name].Phase {
+		case WorkflowStepSucceeded, WorkflowStepSkipped:
+		default:
+			notRun = append(notRun, step.Name)
+		}
+	}
+	if len(notRun) > 0 {
+		return fmt.Errorf("workflow %s: steps could not run: %s", runner.workflow.Name, strings.Join(notRun, ", "))
+	}
+	return nil
+}
+
+func (runner *workflowRunner) finishStep(ctx context.Context, result workflowStepResult) error {
+	kapi := runner.kapi
+	stepState := runner.state.Steps[result.step.Name]
+	var failure error
+
+	switch {
+	case result.err == nil:
+		stepState.Phase = WorkflowStepSucceeded
+		runner.outputs[result.step.Name] = result.outputs
+	case ctx.Err() != nil:
+		// Interrupted, the step stays Running and is resumed by the next runner.
+		return nil
+	case stepState.Attempts <= result.step.Retries:
+		kapi.log().Warn("workflow step failed, retrying", slog.String("workflow", runner.workflow.Name), slog.String("step", result.step.Name), slog.Int("attempt", stepState.Attempts), slog.String(LogFieldError, result.err.Error()))
+		stepState.Phase = WorkflowStepPending
+		stepState.Message = result.err.Error()
+		err := kapi.deleteJob(ctx, stepState.JobName, metav1.DeletePropagationBackground)
+		if err != nil && !apierrors.IsNotFound(err) {
+			failure = err
+		}
+	default:
+		stepState.Phase = WorkflowStepFailed
+		stepState.Message = result.err.Error()
+		failure = fmt.Errorf("workflow %s: step %s failed after %d attempts: %w", runner.workflow.Name, result.step.Name, stepState.Attempts, result.err)
+	}
+
+	err := runner.saveState(ctx)
+	if err != nil && failure == nil {
+		failure = err
+	}
+	return failure
+}
+
+// runStep creates the job of the step, unless resuming, waits for it and collects its outputs.
+func (runner *workflowRunner) runStep(ctx context.Context, step *WorkflowStep, jobName string, resume bool) (map[string]string, error) {
+	kapi := runner.kapi
+	if !resume {
+		job := runner.stepJob(step, jobName)
+		err := kapi.createJob(ctx, &job)
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+	}
+
+	batchJob, err := kapi.WaitForJob(ctx, jobName)
+	if err != nil {
+		return nil, err
+	}
+	if !IsJobSucceeded(batchJob) {
+		return nil, fmt.Errorf("job %s failed", jobName)
+	}
+
+	outputs, err := kapi.getJobTerminationOutputs(ctx, jobName)
+	if err != nil {
+		return nil, err
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      runner.workflow.outputsConfigMapName(step.Name),
+			Namespace: *kapi.Namespace,
+			Labels:    map[string]string{WorkflowLabel: runner.workflow.Name, WorkflowStepLabel: step.Name},
+		},
+		Data: outputs,
+	}
+	_, err = kapi.ApplyConfigMap(ctx, configMap)
+	if err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// stepJob copies the step Job, names it and wires the outputs of the dependencies into it.
+func (runner *workflowRunner) stepJob(step *WorkflowStep, jobName string) Job {
+	job := step.Job
+	job.JobName = &jobName
+	if job.ContainerName == nil {
+		job.ContainerName = &step.Name
+	}
+	if job.ContainerCommand == nil {
+		job.ContainerCommand = &[]string{}
+	}
+
+	labels := map[string]string{}
+	if step.Job.Labels != nil {
+		labels = maps.Clone(*step.Job.Labels)
+	}
+	labels[WorkflowLabel] = runner.workflow.Name
+	labels[WorkflowStepLabel] = step.Name
+	job.Labels = &labels
+
+	envFrom := []corev1.EnvFromSource{}
+	if step.Job.ContainerEnvFrom != nil {
+		envFrom = append(envFrom, *step.Job.ContainerEnvFrom...)
+	}
+	for _, dependency := range step.DependsOn {
+		if runner.state.Steps[dependency].Phase != WorkflowStepSucceeded {
+			continue
+		}
+		envFrom = append(envFrom, corev1.EnvFromSource{
+			Prefix: workflowOutputsEnvPrefix(dependency),
+			ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: runner.workflow.outputsConfigMapName(dependency)},
+			},
+		})
+	}
+	job.ContainerEnvFrom = &envFrom
+	job.UID = nil
+	return job
+}
+
+// getJobTerminationOutputs parses the termination message of the succeeded pod of the job.
+func (kapi *KubAPI) getJobTerminationOutputs(ctx context.Context, jobName string) (map[string]string, error) {
+	op := kapi.startOperation(ctx, "list", "Pod", "")
+	pods, err := kapi.clientset.CoreV1().Pods(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]string{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				maps.Copy(ret, ParseWorkflowOutputs(status.State.Terminated.Message))
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) getConfigMapData(ctx context.Context, name string) (map[string]string, error) {
+	op := kapi.startOperation(ctx, "get", "ConfigMap", name)
+	configMap, err := kapi.clientset.CoreV1().ConfigMaps(*kapi.Namespace).Get(op.ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		kapi.finishOperation(op, nil)
+		return map[string]string{}, nil
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	return configMap.Data, nil
+}
@@ -0,0 +1,209 @@
+package kub_api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testWorkflowStep(name string, dependsOn ...string) *WorkflowStep {
+	containerImage := "busybox:1.28"
+	return &WorkflowStep{Name: name, DependsOn: dependsOn, Job: Job{ContainerImage: &containerImage}}
+}
+
+// fakeJobClientset completes every created job and its pod, failing the jobs listed in failJobs.
+func fakeJobClientset(failJobs map[string]bool, messages map[string]string) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		batchJob := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		condition := batchv1.JobComplete
+		phase := corev1.PodSucceeded
+		if failJobs[batchJob.Name] {
+			condition = batchv1.JobFailed
+			phase = corev1.PodFailed
+		}
+		batchJob.Status.Conditions = append(batchJob.Status.Conditions, batchv1.JobCondition{Type: condition, Status: corev1.ConditionTrue})
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: batchJob.Name + "-pod", Namespace: batchJob.Namespace, Labels: map[string]string{"job-name": batchJob.Name}},
+			Spec:       batchJob.Spec.Template.Spec,
+			Status: corev1.PodStatus{Phase: phase, ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: messages[batchJob.Name]}},
+			}}},
+		}
+		err := clientset.Tracker().Add(pod)
+		return false, nil, err
+	})
+	return clientset
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{
+			testWorkflowStep("aggregate", "fan-out-a", "fan-out-b"),
+			testWorkflowStep("fan-out-a", "prepare"),
+			testWorkflowStep("fan-out-b", "prepare"),
+			testWorkflowStep("prepare"),
+		}}
+		order, err := workflow.Validate()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		names := []string{}
+		for _, step := range order {
+			names = append(names, step.Name)
+		}
+		if strings.Join(names, ",") != "prepare,fan-out-a,fan-out-b,aggregate" {
+			t.Errorf("unexpected order %v", names)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{
+			testWorkflowStep("a", "b"),
+			testWorkflowStep("b", "a"),
+		}}
+		if _, err := workflow.Validate(); err == nil {
+			t.Errorf("expected cycle error")
+		}
+	})
+
+	t.Run("Unknown dependency", func(t *testing.T) {
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{testWorkflowStep("a", "missing")}}
+		if _, err := workflow.Validate(); err == nil {
+			t.Errorf("expected unknown dependency error")
+		}
+	})
+}
+
+func TestRunWorkflow(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fakeJobClientset(
+			map[string]bool{"wf-work-1": true},
+			map[string]string{"wf-prepare-1": "SHARDS=4\nMODE=full"},
+		)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		work := testWorkflowStep("work", "prepare")
+		work.Retries = 1
+		optional := testWorkflowStep("optional", "prepare")
+		optional.When = func(outputs map[string]map[string]string) bool {
+			return outputs["prepare"]["MODE"] == "incremental"
+		}
+		workflow := Workflow{Name: "wf", MaxConcurrency: 1, Steps: []*WorkflowStep{
+			testWorkflowStep("prepare"),
+			work,
+			optional,
+			testWorkflowStep("aggregate", "work", "optional"),
+		}}
+
+		state, err := api.RunWorkflow(context.Background(), &workflow)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		expected := map[string]string{"prepare": WorkflowStepSucceeded, "work": WorkflowStepSucceeded, "optional": WorkflowStepSkipped, "aggregate": WorkflowStepSucceeded}
+		for name, phase := range expected {
+			if state.Steps[name].Phase != phase {
+				t.Errorf("step %s: expected %s, got %+v", name, phase, state.Steps[name])
+			}
+		}
+		if state.Steps["work"].Attempts != 2 {
+			t.Errorf("expected work to be retried, got %+v", state.Steps["work"])
+		}
+
+		outputs, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.Background(), "wf-prepare-outputs", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if outputs.Data["SHARDS"] != "4" {
+			t.Errorf("unexpected outputs %v", outputs.Data)
+		}
+		workJob, err := clientset.BatchV1().Jobs(namespace).Get(context.Background(), "wf-work-2", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		envFrom := workJob.Spec.Template.Spec.Containers[0].EnvFrom
+		if len(envFrom) != 1 || envFrom[0].Prefix != "PREPARE_" || envFrom[0].ConfigMapRef.Name != "wf-prepare-outputs" {
+			t.Errorf("unexpected envFrom %+v", envFrom)
+		}
+
+		// A second runner finds the state in the cluster and has nothing left to do.
+		created := 0
+		clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			created++
+			return false, nil, nil
+		})
+		_, err = api.RunWorkflow(context.Background(), &workflow)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if created != 0 {
+			t.Errorf("resumed workflow created %d jobs", created)
+		}
+	})
+
+	t.Run("Failed step", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fakeJobClientset(map[string]bool{"wf-prepare-1": true}, nil)}
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{testWorkflowStep("prepare"), testWorkflowStep("aggregate", "prepare")}}
+
+		state, err := api.RunWorkflow(context.Background(), &workflow)
+		if err == nil {
+			t.Errorf("expected workflow failure")
+		}
+		if state.Steps["prepare"].Phase != WorkflowStepFailed || state.Steps["aggregate"].Phase != WorkflowStepPending {
+			t.Errorf("unexpected state %+v %+v", state.Steps["prepare"], state.Steps["aggregate"])
+		}
+	})
+
+	t.Run("Resume after failure", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fakeJobClientset(map[string]bool{"wf-prepare-1": true, "wf-prepare-2": true}, nil)}
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{testWorkflowStep("prepare"), testWorkflowStep("aggregate", "prepare")}}
+
+		_, err := api.RunWorkflow(context.Background(), &workflow)
+		if err == nil {
+			t.Fatalf("expected workflow failure")
+		}
+		// The failed step is retried, fails again and is reported.
+		state, err := api.RunWorkflow(context.Background(), &workflow)
+		if err == nil || !strings.Contains(err.Error(), "step prepare failed") {
+			t.Errorf("expected failure of step prepare, got %v", err)
+		}
+		if state.Steps["prepare"].Phase != WorkflowStepFailed || state.Steps["prepare"].Attempts != 2 {
+			t.Errorf("unexpected state %+v", state.Steps["prepare"])
+		}
+		// The third attempt succeeds and the dependents run.
+		state, err = api.RunWorkflow(context.Background(), &workflow)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if state.Steps["prepare"].Phase != WorkflowStepSucceeded || state.Steps["aggregate"].Phase != WorkflowStepSucceeded {
+			t.Errorf("unexpected state %+v %+v", state.Steps["prepare"], state.Steps["aggregate"])
+		}
+	})
+
+	t.Run("Blocked steps", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fakeJobClientset(nil, nil)}
+		workflow := Workflow{Name: "wf", Steps: []*WorkflowStep{testWorkflowStep("prepare"), testWorkflowStep("aggregate", "prepare")}}
+		runner := workflowRunner{kapi: &api, workflow: &workflow, outputs: map[string]map[string]string{}}
+		runner.order, _ = workflow.Validate()
+		runner.state = &WorkflowState{Steps: map[string]*WorkflowStepState{
+			"prepare":   {Phase: "Unknown"},
+			"aggregate": {Phase: WorkflowStepPending},
+		}}
+		err := runner.run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "prepare, aggregate") {
+			t.Errorf("expected steps that could not run, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,645 @@
+package kub_api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	WorkloadDeployment  = "Deployment"
+	WorkloadStatefulSet = "StatefulSet"
+	WorkloadDaemonSet   = "DaemonSet"
+)
+
+// WorkloadLabelName selects the pods of a workload; it is set on the pod template and used as the
+// immutable selector.
+const WorkloadLabelName = "kub-api/workload"
+
+// Annotations maintained by the Kubernetes controllers and kubectl for rollouts.
+const (
+	DeploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	RestartedAtAnnotation        = "kubectl.kubernetes.io/restartedAt"
+)
+
+// Workload describes a Deployment, StatefulSet or DaemonSet. The pods are described by Template
+// with the container options of a Job: ContainerName, ContainerImage, ContainerCommand,
+// ContainerEnv, ContainerEnvFrom, ContainerResources, ContainerVolumeMounts, Volumes,
+// ImagePullSecrets and Labels; the job-only fields are ignored.
+type Workload struct {
+	Kind         string
+	WorkloadName *string
+	Template     *Job
+	// Replicas is ignored for DaemonSets.
+	Replicas             *int32
+	MinReadySeconds      *int32
+	RevisionHistoryLimit *int32
+	// ProgressDeadlineSeconds is for Deployments only.
+	ProgressDeadlineSeconds *int32
+	// ServiceName is the governing headless Service of a StatefulSet.
+	ServiceName *string
+	Labels      *map[string]string
+	Annotations *map[string]string
+}
+
+// WorkloadStatus summarizes a workload for listings.
+type WorkloadStatus struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Desired   int32  `json:"desired"`
+	Ready     int32  `json:"ready"`
+	Updated   int32  `json:"updated"`
+	Available int32  `json:"available"`
+	Revision  string `json:"revision,omitempty"`
+}
+
+// RolloutState is the progress of a rollout. Failed is set when the controller gave up, e.g. a
+// Deployment exceeding its progress deadline.
+type RolloutState struct {
+	Done    bool
+	Failed  bool
+	Message string
+}
+
+func (workload *Workload) generatePodTemplate() (*metav1.ObjectMeta, *corev1.PodTemplateSpec, *metav1.LabelSelector, error) {
+	if workload.WorkloadName == nil || *workload.WorkloadName == "" {
+		return nil, nil, nil, fmt.Errorf("workload name is required")
+	}
+	name := *workload.WorkloadName
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, nil, nil, fmt.Errorf("%s %s: invalid name: %v", workload.Kind, name, errs)
+	}
+	if workload.Template == nil || workload.Template.ContainerName == nil || workload.Template.ContainerImage == nil {
+		return nil, nil, nil, fmt.Errorf("%s %s: template container name and image are required", workload.Kind, name)
+	}
+
+	selector := map[string]string{WorkloadLabelName: name}
+	template := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: maps.Clone(selector)},
+		Spec:       workload.Template.generatePodSpec(),
+	}
+	if workload.Template.Labels != nil {
+		maps.Copy(template.Labels, *workload.Template.Labels)
+		template.Labels[WorkloadLabelName] = name
+	}
+	if workload.Template.Annotations != nil {
+		template.Annotations = maps.Clone(*workload.Template.Annotations)
+	}
+
+	meta := &metav1.ObjectMeta{Name: name}
+	if workload.Labels != nil {
+		meta.Labels = maps.Clone(*workload.Labels)
+	}
+	if workload.Annotations != nil {
+		meta.Annotations = maps.Clone(*workload.Annotations)
+	}
+	return meta, template, &metav1.LabelSelector{MatchLabels: selector}, nil
+}
+
+// GenerateWorkload returns a *appsv1.Deployment, *appsv1.StatefulSet or *appsv1.DaemonSet.
+func (workload *Workload) GenerateWorkload() (runtime.Object, error) {
+	meta, template, selector, err := workload.generatePodTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if workload.Replicas != nil && *workload.Replicas < 0 {
+		return nil, fmt.Errorf("%s %s: replicas must not be negative", workload.Kind, meta.Name)
+	}
+	if workload.ProgressDeadlineSeconds != nil && workload.Kind != WorkloadDeployment {
+		return nil, fmt.Errorf("%s %s: progress deadline is for Deployments only", workload.Kind, meta.Name)
+	}
+	if workload.ServiceName != nil && workload.Kind != WorkloadStatefulSet {
+		return nil, fmt.Errorf("%s %s: service name is for StatefulSets only", workload.Kind, meta.Name)
+	}
+	minReadySeconds := int32(0)
+	if workload.MinReadySeconds != nil {
+		minReadySeconds = *workload.MinReadySeconds
+	}
+
+	switch workload.Kind {
+	case WorkloadDeployment:
+		return &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: WorkloadDeployment},
+			ObjectMeta: *meta,
+			Spec: appsv1.DeploymentSpec{
+				Replicas:                workload.Replicas,
+				Selector:                selector,
+				Template:                *template,
+				MinReadySeconds:         minReadySeconds,
+				RevisionHistoryLimit:    workload.RevisionHistoryLimit,
+				ProgressDeadlineSeconds: workload.ProgressDeadlineSeconds,
+			},
+		}, nil
+	case WorkloadStatefulSet:
+		serviceName := ""
+		if workload.ServiceName != nil {
+			serviceName = *workload.ServiceName
+		}
+		return &appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: WorkloadStatefulSet},
+			ObjectMeta: *meta,
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:             workload.Replicas,
+				Selector:             selector,
+				Template:             *template,
+				ServiceName:          serviceName,
+				MinReadySeconds:      minReadySeconds,
+				RevisionHistoryLimit: workload.RevisionHistoryLimit,
+			},
+		}, nil
+	case WorkloadDaemonSet:
+		if workload.Replicas != nil {
+			return nil, fmt.Errorf("%s %s: DaemonSets run one pod per node and have no replicas", workload.Kind, meta.Name)
+		}
+		return &appsv1.DaemonSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: WorkloadDaemonSet},
+			ObjectMeta: *meta,
+			Spec: appsv1.DaemonSetSpec{
+				Selector:             selector,
+				Template:             *template,
+				MinReadySeconds:      minReadySeconds,
+				RevisionHistoryLimit: workload.RevisionHistoryLimit,
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown workload kind %s", workload.Kind)
+}
+
+// CreateWorkload creates the workload in the active namespace.
+func (kapi *KubAPI) CreateWorkload(ctx context.Context, workload *Workload) (runtime.Object, error) {
+	namespace, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := workload.GenerateWorkload()
+	if err != nil {
+		return nil, err
+	}
+	op := kapi.startOperation(ctx, "create", workload.Kind, *workload.WorkloadName)
+	op.setDiff(obj)
+	var ret runtime.Object
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		ret, err = kapi.clientset.AppsV1().Deployments(*namespace).Create(op.ctx, obj, metav1.CreateOptions{})
+	case *appsv1.StatefulSet:
+		ret, err = kapi.clientset.AppsV1().StatefulSets(*namespace).Create(op.ctx, obj, metav1.CreateOptions{})
+	case *appsv1.DaemonSet:
+		ret, err = kapi.clientset.AppsV1().DaemonSets(*namespace).Create(op.ctx, obj, metav1.CreateOptions{})
+	}
+	if err != nil {
+		kapi.finishOperation(op, err)
+		return nil, err
+	}
+	kapi.finishOperation(op, nil, slog.String(LogFieldUID, string(ret.(metav1.Object).GetUID())))
+	return ret, nil
+}
+
+// ApplyWorkload creates the workload or replaces the spec, labels and annotations of an existing
+// one, which starts a rollout when the pod template changed.
+func (kapi *KubAPI) ApplyWorkload(ctx context.Context, workload *Workload) (runtime.Object, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := workload.GenerateWorkload()
+	if err != nil {
+		return nil, err
+	}
+	op := kapi.startOperation(ctx, "get", workload.Kind, *workload.WorkloadName)
+	existing, err := kapi.getWorkload(op.ctx, workload.Kind, *workload.WorkloadName)
+	if apierrors.IsNotFound(err) {
+		// Not a failure, the workload is created.
+		kapi.finishOperation(op, nil)
+		return kapi.CreateWorkload(ctx, workload)
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without explicit replicas the current count is kept, so apply does not undo a scale.
+	var ret runtime.Object
+	op = kapi.startOperation(ctx, "update", workload.Kind, *workload.WorkloadName)
+	switch existing := existing.(type) {
+	case *appsv1.Deployment:
+		desired := obj.(*appsv1.Deployment)
+		if desired.Spec.Replicas == nil {
+			desired.Spec.Replicas = existing.Spec.Replicas
+		}
+		existing.Spec, existing.Labels, existing.Annotations = desired.Spec, desired.Labels, desired.Annotations
+		op.setDiff(existing)
+		ret, err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).Update(op.ctx, existing, metav1.UpdateOptions{})
+	case *appsv1.StatefulSet:
+		desired := obj.(*appsv1.StatefulSet)
+		if desired.Spec.Replicas == nil {
+			desired.Spec.Replicas = existing.Spec.Replicas
+		}
+		existing.Spec, existing.Labels, existing.Annotations = desired.Spec, desired.Labels, desired.Annotations
+		op.setDiff(existing)
+		ret, err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).Update(op.ctx, existing, metav1.UpdateOptions{})
+	case *appsv1.DaemonSet:
+		desired := obj.(*appsv1.DaemonSet)
+		existing.Spec, existing.Labels, existing.Annotations = desired.Spec, desired.Labels, desired.Annotations
+		op.setDiff(existing)
+		ret, err = kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).Update(op.ctx, existing, metav1.UpdateOptions{})
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetWorkload returns a *appsv1.Deployment, *appsv1.StatefulSet or *appsv1.DaemonSet.
+func (kapi *KubAPI) GetWorkload(ctx context.Context, kind, name string) (runtime.Object, error) {
+	op := kapi.startOperation(ctx, "get", kind, name)
+	ret, err := kapi.getWorkload(op.ctx, kind, name)
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (kapi *KubAPI) getWorkload(ctx context.Context, kind, name string) (runtime.Object, error) {
+	switch kind {
+	case WorkloadDeployment:
+		return kapi.clientset.AppsV1().Deployments(*kapi.Namespace).Get(ctx, name, metav1.GetOptions{})
+	case WorkloadStatefulSet:
+		return kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).Get(ctx, name, metav1.GetOptions{})
+	case WorkloadDaemonSet:
+		return kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	return nil, fmt.Errorf("unknown workload kind %s", kind)
+}
+
+func (kapi *KubAPI) DeleteWorkload(ctx context.Context, kind, name string) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "delete", kind, name)
+	switch kind {
+	case WorkloadDeployment:
+		err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	case WorkloadStatefulSet:
+		err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	case WorkloadDaemonSet:
+		err = kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).Delete(op.ctx, name, metav1.DeleteOptions{})
+	default:
+		err = fmt.Errorf("unknown workload kind %s", kind)
+	}
+	kapi.finishOperation(op, err)
+	return err
+}
+
+// ListWorkloads summarizes the workloads of kind in the active namespace, sorted by name.
+func (kapi *KubAPI) ListWorkloads(ctx context.Context, kind string) ([]WorkloadStatus, error) {
+	op := kapi.startOperation(ctx, "list", kind, "")
+	ret := []WorkloadStatus{}
+	var err error
+	switch kind {
+	case WorkloadDeployment:
+		var list *appsv1.DeploymentList
+		list, err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+		for index := 0; err == nil && index < len(list.Items); index++ {
+			ret = append(ret, WorkloadStatusOf(&list.Items[index]))
+		}
+	case WorkloadStatefulSet:
+		var list *appsv1.StatefulSetList
+		list, err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+		for index := 0; err == nil && index < len(list.Items); index++ {
+			ret = append(ret, WorkloadStatusOf(&list.Items[index]))
+		}
+	case WorkloadDaemonSet:
+		var list *appsv1.DaemonSetList
+		list, err = kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).List(op.ctx, metav1.ListOptions{})
+		for index := 0; err == nil && index < len(list.Items); index++ {
+			ret = append(ret, WorkloadStatusOf(&list.Items[index]))
+		}
+	default:
+		err = fmt.Errorf("unknown workload kind %s", kind)
+	}
+	kapi.finishOperation(op, err)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+func WorkloadStatusOf(obj runtime.Object) WorkloadStatus {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return WorkloadStatus{Kind: WorkloadDeployment, Name: obj.Name, Desired: replicasOf(obj.Spec.Replicas), Ready: obj.Status.ReadyReplicas,
+			Updated: obj.Status.UpdatedReplicas, Available: obj.Status.AvailableReplicas, Revision: obj.Annotations[DeploymentRevisionAnnotation]}
+	case *appsv1.StatefulSet:
+		return WorkloadStatus{Kind: WorkloadStatefulSet, Name: obj.Name, Desired: replicasOf(obj.Spec.Replicas), Ready: obj.Status.ReadyReplicas,
+			Updated: obj.Status.UpdatedReplicas, Available: obj.Status.AvailableReplicas, Revision: obj.Status.UpdateRevision}
+	case *appsv1.DaemonSet:
+		return WorkloadStatus{Kind: WorkloadDaemonSet, Name: obj.Name, Desired: obj.Status.DesiredNumberScheduled, Ready: obj.Status.NumberReady,
+			Updated: obj.Status.UpdatedNumberScheduled, Available: obj.Status.NumberAvailable}
+	}
+	return WorkloadStatus{}
+}
+
+// replicasOf applies the API default of one replica.
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// Scale sets the replicas of a Deployment or StatefulSet through the scale subresource.
+func (kapi *KubAPI) Scale(ctx context.Context, kind, name string, replicas int32) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	if replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+	op := kapi.startOperation(ctx, "update", kind, name)
+	scale := &autoscalingv1.Scale{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: *kapi.Namespace}, Spec: autoscalingv1.ScaleSpec{Replicas: replicas}}
+	op.setDiff(scale)
+	switch kind {
+	case WorkloadDeployment:
+		_, err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).UpdateScale(op.ctx, name, scale, metav1.UpdateOptions{})
+	case WorkloadStatefulSet:
+		_, err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).UpdateScale(op.ctx, name, scale, metav1.UpdateOptions{})
+	default:
+		err = fmt.Errorf("%s can not be scaled", kind)
+	}
+	kapi.finishOperation(op, err, slog.Int("replicas", int(replicas)))
+	return err
+}
+
+// RolloutRestart restarts all pods of the workload with a rollout, as kubectl rollout restart
+// does, by stamping the pod template.
+func (kapi *KubAPI) RolloutRestart(ctx context.Context, kind, name string) error {
+	patch, err := NewStrategicMergePatch(map[string]any{"spec": map[string]any{"template": map[string]any{"metadata": map[string]any{
+		"annotations": map[string]string{RestartedAtAnnotation: time.Now().Format(time.RFC3339)},
+	}}}})
+	if err != nil {
+		return err
+	}
+	return kapi.patchWorkload(ctx, kind, name, patch)
+}
+
+func (kapi *KubAPI) patchWorkload(ctx context.Context, kind, name string, patch *Patch) error {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return err
+	}
+	op := kapi.startOperation(ctx, "patch", kind, name)
+	op.setDiff(patch.Data)
+	switch kind {
+	case WorkloadDeployment:
+		_, err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	case WorkloadStatefulSet:
+		_, err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	case WorkloadDaemonSet:
+		_, err = kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).Patch(op.ctx, name, patch.Type, patch.Data, metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unknown workload kind %s", kind)
+	}
+	kapi.finishOperation(op, err, slog.String("patchType", string(patch.Type)))
+	return err
+}
+
+// EvaluateRollout reports the rollout progress of the workload the way kubectl rollout status does.
+// A partitioned StatefulSet is done once the pods above the partition are updated, and workloads
+// with the OnDelete strategy are reported as failed since they only roll out as pods are deleted.
+func EvaluateRollout(obj runtime.Object) RolloutState {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		if obj.Status.ObservedGeneration < obj.Generation {
+			return RolloutState{Message: "waiting for the deployment spec update to be observed"}
+		}
+		for _, condition := range obj.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				return RolloutState{Failed: true, Message: fmt.Sprintf("deployment %s exceeded its progress deadline", obj.Name)}
+			}
+		}
+		replicas := replicasOf(obj.Spec.Replicas)
+		switch {
+		case obj.Status.UpdatedReplicas < replicas:
+			return RolloutState{Message: fmt.Sprintf("%d out of %d new replicas have been updated", obj.Status.UpdatedReplicas, replicas)}
+		case obj.Status.Replicas > obj.Status.UpdatedReplicas:
+			return RolloutState{Message: fmt.Sprintf("%d old replicas are pending termination", obj.Status.Replicas-obj.Status.UpdatedReplicas)}
+		case obj.Status.AvailableReplicas < obj.Status.UpdatedReplicas:
+			return RolloutState{Message: fmt.Sprintf("%d of %d updated replicas are available", obj.Status.AvailableReplicas, obj.Status.UpdatedReplicas)}
+		}
+		return RolloutState{Done: true, Message: fmt.Sprintf("deployment %s successfully rolled out", obj.Name)}
+	case *appsv1.StatefulSet:
+		if obj.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+			// Pods are only updated when they are deleted, the rollout would never finish by itself.
+			return RolloutState{Failed: true, Message: fmt.Sprintf("statefulset %s uses the OnDelete strategy, rollout status is only available for RollingUpdate", obj.Name)}
+		}
+		if obj.Status.ObservedGeneration < obj.Generation {
+			return RolloutState{Message: "waiting for the statefulset spec update to be observed"}
+		}
+		replicas := replicasOf(obj.Spec.Replicas)
+		if obj.Status.ReadyReplicas < replicas {
+			return RolloutState{Message: fmt.Sprintf("%d of %d pods are ready", obj.Status.ReadyReplicas, replicas)}
+		}
+		if rollingUpdate := obj.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+			// Pods below the partition keep the current revision.
+			partitioned := max(replicas-*rollingUpdate.Partition, 0)
+			if obj.Status.UpdatedReplicas < partitioned {
+				return RolloutState{Message: fmt.Sprintf("%d out of %d new pods of the partitioned rollout have been updated", obj.Status.UpdatedReplicas, partitioned)}
+			}
+			return RolloutState{Done: true, Message: fmt.Sprintf("statefulset %s partitioned rollout complete: %d new pods have been updated", obj.Name, obj.Status.UpdatedReplicas)}
+		}
+		if obj.Status.UpdateRevision != obj.Status.CurrentRevision {
+			return RolloutState{Message: fmt.Sprintf("%d of %d pods are updated to revision %s", obj.Status.UpdatedReplicas, replicas, obj.Status.UpdateRevision)}
+		}
+		return RolloutState{Done: true, Message: fmt.Sprintf("statefulset %s successfully rolled out", obj.Name)}
+	case *appsv1.DaemonSet:
+		if obj.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+			return RolloutState{Failed: true, Message: fmt.Sprintf("daemonset %s uses the OnDelete strategy, rollout status is only available for RollingUpdate", obj.Name)}
+		}
+		if obj.Status.ObservedGeneration < obj.Generation {
+			return RolloutState{Message: "waiting for the daemonset spec update to be observed"}
+		}
+		desired := obj.Status.DesiredNumberScheduled
+		if obj.Status.UpdatedNumberScheduled < desired {
+			return RolloutState{Message: fmt.Sprintf("%d of %d updated pods are scheduled", obj.Status.UpdatedNumberScheduled, desired)}
+		}
+		if obj.Status.NumberAvailable < desired {
+			return RolloutState{Message: fmt.Sprintf("%d of %d updated pods are available", obj.Status.NumberAvailable, desired)}
+		}
+		return RolloutState{Done: true, Message: fmt.Sprintf("daemonset %s successfully rolled out", obj.Name)}
+	}
+	return RolloutState{Failed: true, Message: fmt.Sprintf("unsupported workload %T", obj)}
+}
+
+// RolloutStatus blocks until the rollout of the workload completes or fails. A failed rollout is
+// returned together with an error.
+func (kapi *KubAPI) RolloutStatus(ctx context.Context, kind, name string) (*RolloutState, error) {
+	for {
+		obj, err := kapi.GetWorkload(ctx, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		state := EvaluateRollout(obj)
+		if state.Failed {
+			return &state, fmt.Errorf("%s", state.Message)
+		}
+		if state.Done {
+			return &state, nil
+		}
+		kapi.log().Debug("waiting for rollout", slog.String(LogFieldNamespace, *kapi.Namespace), slog.String(LogFieldName, name), slog.String("state", state.Message))
+
+		listOptions := metav1.ListOptions{FieldSelector: "metadata.name=" + name, ResourceVersion: obj.(metav1.Object).GetResourceVersion()}
+		op := kapi.startOperation(ctx, "watch", kind, name)
+		var watcher watch.Interface
+		switch kind {
+		case WorkloadDeployment:
+			watcher, err = kapi.clientset.AppsV1().Deployments(*kapi.Namespace).Watch(op.ctx, listOptions)
+		case WorkloadStatefulSet:
+			watcher, err = kapi.clientset.AppsV1().StatefulSets(*kapi.Namespace).Watch(op.ctx, listOptions)
+		case WorkloadDaemonSet:
+			watcher, err = kapi.clientset.AppsV1().DaemonSets(*kapi.Namespace).Watch(op.ctx, listOptions)
+		}
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+
+		closed := false
+		select {
+		case <-ctx.Done():
+			watcher.Stop()
+			return &state, ctx.Err()
+		case _, ok := <-watcher.ResultChan():
+			// Every change is re-evaluated from a fresh get.
+			closed = !ok
+		}
+		watcher.Stop()
+		if closed {
+			kapi.observeWatchReconnect(kind)
+		}
+	}
+}
+
+// RolloutUndo rolls the workload back to revision, the previous one when revision is 0, as
+// kubectl rollout undo does: from the owned ReplicaSets of a Deployment or the
+// ControllerRevisions of a StatefulSet or DaemonSet. It returns the revision rolled back to.
+func (kapi *KubAPI) RolloutUndo(ctx context.Context, kind, name string, revision int64) (int64, error) {
+	_, err := kapi.GetActiveNamespace()
+	if err != nil {
+		return 0, err
+	}
+	obj, err := kapi.GetWorkload(ctx, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	owner := obj.(metav1.Object)
+	selector, err := metav1.LabelSelectorAsSelector(workloadSelector(obj))
+	if err != nil {
+		return 0, err
+	}
+
+	// Templates by revision, the current one is the highest.
+	templates := map[int64]func() (*Patch, error){}
+	if kind == WorkloadDeployment {
+		op := kapi.startOperation(ctx, "list", "ReplicaSet", "")
+		replicaSets, err := kapi.clientset.AppsV1().ReplicaSets(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return 0, err
+		}
+		for index := range replicaSets.Items {
+			replicaSet := &replicaSets.Items[index]
+			number, err := strconv.ParseInt(replicaSet.Annotations[DeploymentRevisionAnnotation], 10, 64)
+			if err != nil || !isOwnedBy(replicaSet, owner.GetUID()) {
+				continue
+			}
+			templates[number] = func() (*Patch, error) {
+				// The whole template is replaced, a merge would keep containers added since.
+				template := replicaSet.Spec.Template.DeepCopy()
+				delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+				return NewJSONPatch(PatchOperation{Op: "replace", Path: "/spec/template", Value: template})
+			}
+		}
+	} else {
+		op := kapi.startOperation(ctx, "list", "ControllerRevision", "")
+		revisions, err := kapi.clientset.AppsV1().ControllerRevisions(*kapi.Namespace).List(op.ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		kapi.finishOperation(op, err)
+		if err != nil {
+			return 0, err
+		}
+		for index := range revisions.Items {
+			controllerRevision := &revisions.Items[index]
+			if !isOwnedBy(controllerRevision, owner.GetUID()) {
+				continue
+			}
+			// The revision data is the strategic merge patch restoring its template.
+			templates[controllerRevision.Revision] = func() (*Patch, error) {
+				if len(controllerRevision.Data.Raw) == 0 {
+					return nil, fmt.Errorf("controller revision %s has no patch data", controllerRevision.Name)
+				}
+				return &Patch{Type: types.StrategicMergePatchType, Data: controllerRevision.Data.Raw}, nil
+			}
+		}
+	}
+
+	numbers := []int64{}
+	for number := range templates {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] > numbers[j] })
+	if revision == 0 {
+		if len(numbers) < 2 {
+			return 0, fmt.Errorf("%s %s has no previous revision", kind, name)
+		}
+		revision = numbers[1]
+	} else if _, ok := templates[revision]; !ok {
+		return 0, fmt.Errorf("%s %s has no revision %d", kind, name, revision)
+	} else if revision == numbers[0] {
+		return 0, fmt.Errorf("%s %s already runs revision %d", kind, name, revision)
+	}
+
+	patch, err := templates[revision]()
+	if err != nil {
+		return 0, err
+	}
+	return revision, kapi.patchWorkload(ctx, kind, name, patch)
+}
+
+func workloadSelector(obj runtime.Object) *metav1.LabelSelector {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Selector
+	case *appsv1.StatefulSet:
+		return obj.Spec.Selector
+	case *appsv1.DaemonSet:
+		return obj.Spec.Selector
+	}
+	return nil
+}
+
+func isOwnedBy(obj metav1.Object, uid types.UID) bool {
+	for _, reference := range obj.GetOwnerReferences() {
+		if reference.UID == uid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+package kub_api
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testWorkload(kind, name string) *Workload {
+	return &Workload{Kind: kind, WorkloadName: &name, Template: testQueueJob(name, map[string]string{"team": "web"})}
+}
+
+func TestGenerateWorkload(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		workload := testWorkload(WorkloadDeployment, "web")
+		replicas := int32(3)
+		workload.Replicas = &replicas
+		workload.Template.MountConfigMap("web-config", "/etc/web")
+
+		obj, err := workload.GenerateWorkload()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		deployment := obj.(*appsv1.Deployment)
+		if *deployment.Spec.Replicas != 3 || deployment.Spec.Selector.MatchLabels[WorkloadLabelName] != "web" {
+			t.Errorf("unexpected deployment spec %+v", deployment.Spec)
+		}
+		template := deployment.Spec.Template
+		if template.Labels["team"] != "web" || template.Labels[WorkloadLabelName] != "web" {
+			t.Errorf("unexpected template labels %v", template.Labels)
+		}
+		if template.Spec.Containers[0].Image != "busybox:1.28" || len(template.Spec.Volumes) != 1 || template.Spec.RestartPolicy != "" {
+			t.Errorf("unexpected pod spec %+v", template.Spec)
+		}
+
+		serviceName := "db-headless"
+		workload = testWorkload(WorkloadStatefulSet, "db")
+		workload.ServiceName = &serviceName
+		obj, err = workload.GenerateWorkload()
+		if err != nil || obj.(*appsv1.StatefulSet).Spec.ServiceName != serviceName {
+			t.Errorf("unexpected statefulset %+v: %v", obj, err)
+		}
+		obj, err = testWorkload(WorkloadDaemonSet, "agent").GenerateWorkload()
+		if err != nil || obj.(*appsv1.DaemonSet).Spec.Template.Spec.Containers[0].Name != "agent" {
+			t.Errorf("unexpected daemonset %+v: %v", obj, err)
+		}
+	})
+
+	t.Run("Invalid workloads", func(t *testing.T) {
+		replicas := int32(2)
+		serviceName := "web"
+		daemonSet := testWorkload(WorkloadDaemonSet, "agent")
+		daemonSet.Replicas = &replicas
+		deployment := testWorkload(WorkloadDeployment, "web")
+		deployment.ServiceName = &serviceName
+		noTemplate := testWorkload(WorkloadDeployment, "web")
+		noTemplate.Template = nil
+		for description, workload := range map[string]*Workload{
+			"unknown kind":         testWorkload("ReplicaSet", "web"),
+			"invalid name":         testWorkload(WorkloadDeployment, "Web_App"),
+			"daemonset replicas":   daemonSet,
+			"deployment service":   deployment,
+			"missing pod template": noTemplate,
+		} {
+			_, err := workload.GenerateWorkload()
+			if err == nil {
+				t.Errorf("%s: expected error", description)
+			}
+		}
+	})
+}
+
+func TestWorkloadLifecycle(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+
+		for _, kind := range []string{WorkloadDeployment, WorkloadStatefulSet, WorkloadDaemonSet} {
+			workload := testWorkload(kind, "app")
+			_, err := api.CreateWorkload(context.Background(), workload)
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			image := "busybox:1.36"
+			workload.Template.ContainerImage = &image
+			_, err = api.ApplyWorkload(context.Background(), workload)
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			obj, err := api.GetWorkload(context.Background(), kind, "app")
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			if workloadImage(obj) != image {
+				t.Errorf("%s: expected image %s, got %s", kind, image, workloadImage(obj))
+			}
+
+			err = api.RolloutRestart(context.Background(), kind, "app")
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			obj, _ = api.GetWorkload(context.Background(), kind, "app")
+			if workloadTemplateAnnotations(obj)[RestartedAtAnnotation] == "" {
+				t.Errorf("%s: restart annotation missing", kind)
+			}
+
+			workloads, err := api.ListWorkloads(context.Background(), kind)
+			if err != nil || len(workloads) != 1 || workloads[0].Name != "app" {
+				t.Errorf("%s: unexpected list %+v: %v", kind, workloads, err)
+			}
+			err = api.DeleteWorkload(context.Background(), kind, "app")
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+		}
+	})
+
+	t.Run("Default namespace", func(t *testing.T) {
+		namespace := "default"
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace}}
+		clientset := fake.NewSimpleClientset(deployment)
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+
+		if err := api.Scale(context.Background(), WorkloadDeployment, "app", 3); err == nil {
+			t.Errorf("expected scale in the default namespace to fail")
+		}
+		if err := api.RolloutRestart(context.Background(), WorkloadDeployment, "app"); err == nil {
+			t.Errorf("expected restart in the default namespace to fail")
+		}
+		if _, err := api.RolloutUndo(context.Background(), WorkloadDeployment, "app", 0); err == nil {
+			t.Errorf("expected undo in the default namespace to fail")
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("unexpected actions %+v", actions)
+		}
+	})
+}
+
+func workloadImage(obj runtime.Object) string {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Template.Spec.Containers[0].Image
+	case *appsv1.StatefulSet:
+		return obj.Spec.Template.Spec.Containers[0].Image
+	case *appsv1.DaemonSet:
+		return obj.Spec.Template.Spec.Containers[0].Image
+	}
+	return ""
+}
+
+func workloadTemplateAnnotations(obj runtime.Object) map[string]string {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Template.Annotations
+	case *appsv1.StatefulSet:
+		return obj.Spec.Template.Annotations
+	case *appsv1.DaemonSet:
+		return obj.Spec.Template.Annotations
+	}
+	return nil
+}
+
+func TestScale(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		clientset := fake.NewSimpleClientset()
+		api := KubAPI{Namespace: &namespace, clientset: clientset}
+		_, err := api.CreateWorkload(context.Background(), testWorkload(WorkloadDeployment, "web"))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = api.Scale(context.Background(), WorkloadDeployment, "web", 5)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		actions := clientset.Actions()
+		last := actions[len(actions)-1]
+		if last.GetVerb() != "update" || last.GetSubresource() != "scale" {
+			t.Errorf("unexpected action %+v", last)
+		}
+	})
+
+	t.Run("Apply after scale", func(t *testing.T) {
+		namespace := "test"
+		sink := MemoryAuditSink{}
+		clientset := fake.NewSimpleClientset()
+		// The fake tracker stores the Scale itself, apply it to the deployment like the API server does.
+		clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "scale" {
+				return false, nil, nil
+			}
+			scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+			obj, err := clientset.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), action.GetNamespace(), scale.Name)
+			if err != nil {
+				return true, nil, err
+			}
+			deployment := obj.(*appsv1.Deployment)
+			deployment.Spec.Replicas = &scale.Spec.Replicas
+			return true, scale, clientset.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), deployment, action.GetNamespace())
+		})
+		api := KubAPI{Namespace: &namespace, clientset: clientset, Auditor: &Auditor{Sinks: []AuditSink{&sink}}}
+		workload := testWorkload(WorkloadDeployment, "web")
+		_, err := api.ApplyWorkload(context.Background(), workload)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		err = api.Scale(context.Background(), WorkloadDeployment, "web", 5)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		image := "busybox:1.36"
+		workload.Template.ContainerImage = &image
+		_, err = api.ApplyWorkload(context.Background(), workload)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		obj, err := api.GetWorkload(context.Background(), WorkloadDeployment, "web")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if replicas := obj.(*appsv1.Deployment).Spec.Replicas; replicas == nil || *replicas != 5 {
+			t.Errorf("expected apply to keep 5 replicas, got %v", replicas)
+		}
+		for _, record := range sink.Records() {
+			if record.Result == AuditResultFailure {
+				t.Errorf("unexpected failed audit record %+v", record)
+			}
+		}
+	})
+
+	t.Run("Invalid scale", func(t *testing.T) {
+		namespace := "test"
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset()}
+		if err := api.Scale(context.Background(), WorkloadDaemonSet, "agent", 1); err == nil {
+			t.Errorf("expected error for daemonset")
+		}
+		if err := api.Scale(context.Background(), WorkloadDeployment, "web", -1); err == nil {
+			t.Errorf("expected error for negative replicas")
+		}
+	})
+}
+
+func TestEvaluateRollout(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		replicas := int32(2)
+		deployment := func(updated, available, total int32, conditions ...appsv1.DeploymentCondition) *appsv1.Deployment {
+			return &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: updated, AvailableReplicas: available, Replicas: total,
+					Conditions: conditions},
+			}
+		}
+		stale := deployment(2, 2, 2)
+		stale.Status.ObservedGeneration = 1
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 2, CurrentRevision: "db-1", UpdateRevision: "db-2"},
+		}
+		daemonSet := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent"},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3},
+		}
+		partition := func(partition, updated int32) *appsv1.StatefulSet {
+			ret := statefulSet.DeepCopy()
+			ret.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: &partition}
+			ret.Status.UpdatedReplicas = updated
+			return ret
+		}
+		onDeleteStatefulSet := statefulSet.DeepCopy()
+		onDeleteStatefulSet.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+		onDeleteDaemonSet := daemonSet.DeepCopy()
+		onDeleteDaemonSet.Spec.UpdateStrategy.Type = appsv1.OnDeleteDaemonSetStrategyType
+
+		if message := EvaluateRollout(deployment(1, 1, 3)).Message; message != "1 out of 2 new replicas have been updated" {
+			t.Errorf("unexpected message %q", message)
+		}
+		for description, test := range map[string]struct {
+			obj          runtime.Object
+			done, failed bool
+		}{
+			"deployment complete":     {obj: deployment(2, 2, 2), done: true},
+			"deployment stale":        {obj: stale},
+			"deployment updating":     {obj: deployment(1, 1, 3)},
+			"deployment old replicas": {obj: deployment(2, 2, 3)},
+			"deployment unavailable":  {obj: deployment(2, 1, 2)},
+			"deployment deadline": {obj: deployment(1, 1, 2, appsv1.DeploymentCondition{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}),
+				failed: true},
+			"statefulset updating":              {obj: statefulSet},
+			"statefulset partition updating":    {obj: partition(1, 0)},
+			"statefulset partition complete":    {obj: partition(1, 1), done: true},
+			"statefulset partition above total": {obj: partition(3, 0), done: true},
+			"statefulset on delete":             {obj: onDeleteStatefulSet, failed: true},
+			"daemonset complete":                {obj: daemonSet, done: true},
+			"daemonset on delete":               {obj: onDeleteDaemonSet, failed: true},
+		} {
+			state := EvaluateRollout(test.obj)
+			if state.Done != test.done || state.Failed != test.failed {
+				t.Errorf("%s: unexpected state %+v", description, state)
+			}
+		}
+	})
+}
+
+func TestRolloutStatus(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		replicas := int32(1)
+		failed := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+			}},
+		}
+		complete := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "complete", Namespace: namespace},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(failed, complete)}
+
+		state, err := api.RolloutStatus(context.Background(), WorkloadDeployment, "complete")
+		if err != nil || !state.Done {
+			t.Errorf("unexpected state %+v: %v", state, err)
+		}
+		state, err = api.RolloutStatus(context.Background(), WorkloadDeployment, "failed")
+		if err == nil || !state.Failed {
+			t.Errorf("expected failed rollout, got %+v", state)
+		}
+	})
+}
+
+func TestRolloutUndo(t *testing.T) {
+	t.Run("Valid run", func(t *testing.T) {
+		namespace := "test"
+		deployment, _ := testWorkload(WorkloadDeployment, "web").GenerateWorkload()
+		current := deployment.(*appsv1.Deployment)
+		current.Namespace, current.UID = namespace, "deployment-uid"
+		current.Spec.Template.Spec.Containers[0].Image = "web:3"
+		owner := []metav1.OwnerReference{{UID: "deployment-uid"}}
+		replicaSet := func(name, revision, image string, ownerReferences []metav1.OwnerReference) *appsv1.ReplicaSet {
+			template := current.Spec.Template.DeepCopy()
+			template.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = name
+			template.Spec.Containers[0].Image = image
+			return &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: template.Labels, OwnerReferences: ownerReferences,
+					Annotations: map[string]string{DeploymentRevisionAnnotation: revision}},
+				Spec: appsv1.ReplicaSetSpec{Template: *template},
+			}
+		}
+
+		statefulSet, _ := testWorkload(WorkloadStatefulSet, "db").GenerateWorkload()
+		db := statefulSet.(*appsv1.StatefulSet)
+		db.Namespace, db.UID = namespace, "statefulset-uid"
+		db.Spec.Template.Spec.Containers[0].Image = "db:2"
+		controllerRevision := func(name string, revision int64, image string) *appsv1.ControllerRevision {
+			return &appsv1.ControllerRevision{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: db.Spec.Template.Labels,
+					OwnerReferences: []metav1.OwnerReference{{UID: "statefulset-uid"}}},
+				Revision: revision,
+				Data:     runtime.RawExtension{Raw: []byte(`{"spec":{"template":{"spec":{"containers":[{"name":"db","image":"` + image + `"}]}}}}`)},
+			}
+		}
+
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(
+			current,
+			replicaSet("web-1", "1", "web:1", owner),
+			replicaSet("web-2", "2", "web:2", owner),
+			replicaSet("web-3", "3", "web:3", owner),
+			replicaSet("other-1", "9", "other:1", nil),
+			db,
+			controllerRevision("db-1", 1, "db:1"),
+			controllerRevision("db-2", 2, "db:2"),
+		)}
+
+		revision, err := api.RolloutUndo(context.Background(), WorkloadDeployment, "web", 0)
+		if err != nil || revision != 2 {
+			t.Fatalf("unexpected revision %d: %v", revision, err)
+		}
+		obj, _ := api.GetWorkload(context.Background(), WorkloadDeployment, "web")
+		template := obj.(*appsv1.Deployment).Spec.Template
+		if template.Spec.Containers[0].Image != "web:2" || template.Labels[appsv1.DefaultDeploymentUniqueLabelKey] != "" {
+			t.Errorf("unexpected template %+v", template)
+		}
+		revision, err = api.RolloutUndo(context.Background(), WorkloadDeployment, "web", 1)
+		if err != nil || revision != 1 {
+			t.Fatalf("unexpected revision %d: %v", revision, err)
+		}
+
+		revision, err = api.RolloutUndo(context.Background(), WorkloadStatefulSet, "db", 0)
+		if err != nil || revision != 1 {
+			t.Fatalf("unexpected revision %d: %v", revision, err)
+		}
+		obj, _ = api.GetWorkload(context.Background(), WorkloadStatefulSet, "db")
+		if workloadImage(obj) != "db:1" {
+			t.Errorf("unexpected image %s", workloadImage(obj))
+		}
+	})
+
+	t.Run("Invalid revision", func(t *testing.T) {
+		namespace := "test"
+		deployment, _ := testWorkload(WorkloadDeployment, "web").GenerateWorkload()
+		deployment.(*appsv1.Deployment).Namespace = namespace
+		api := KubAPI{Namespace: &namespace, clientset: fake.NewSimpleClientset(deployment)}
+		_, err := api.RolloutUndo(context.Background(), WorkloadDeployment, "web", 0)
+		if err == nil {
+			t.Errorf("expected error without a previous revision")
+		}
+		_, err = api.RolloutUndo(context.Background(), WorkloadDeployment, "web", 7)
+		if err == nil {
+			t.Errorf("expected error for a missing revision")
+		}
+	})
+}